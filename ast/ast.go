@@ -0,0 +1,586 @@
+// Package ast описывает синтаксическое дерево программы на DPL.
+//
+// Дерево строится парсером и не зависит от интерпретатора:
+// его можно обходить (Walk, Inspect), анализировать и изменять,
+// а затем выполнять (dpl.CompileTree). Dump выводит дерево в JSON для отладки.
+package ast
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/suprunchuksergey/dpl/internal/pos"
+	"reflect"
+	"strings"
+)
+
+// позиция в исходном коде
+type Pos = pos.Pos
+
+// участок исходного кода
+type Span = pos.Span
+
+type Node interface {
+	// участок исходного кода, из которого получен узел;
+	// нулевой, если узел создан не парсером
+	Span() Span
+	setSpan(span Span)
+}
+
+type spanned struct{ span Span }
+
+func (n *spanned) Span() Span { return n.span }
+
+func (n *spanned) setSpan(span Span) { n.span = span }
+
+// привязывает узел к участку исходного кода
+func SetSpan(n Node, span Span) { n.setSpan(span) }
+
+// оператор
+type Op uint8
+
+const (
+	_ Op = iota
+
+	Add      // +
+	Sub      // -
+	Mul      // *
+	Div      // /
+	Mod      // %
+	Concat   // ||
+	Eq       // ==
+	Neq      // !=
+	Lt       // <
+	Gt       // >
+	Lte      // <=
+	Gte      // >=
+	And      // and
+	Or       // or
+	AndValue // &&
+	OrValue  // ?:
+
+	Neg // -x
+	Not // not x
+)
+
+var ops = [...]string{
+	Add:      "+",
+	Sub:      "-",
+	Mul:      "*",
+	Div:      "/",
+	Mod:      "%",
+	Concat:   "||",
+	Eq:       "==",
+	Neq:      "!=",
+	Lt:       "<",
+	Gt:       ">",
+	Lte:      "<=",
+	Gte:      ">=",
+	And:      "and",
+	Or:       "or",
+	AndValue: "&&",
+	OrValue:  "?:",
+	Neg:      "-",
+	Not:      "not",
+}
+
+func (op Op) String() string {
+	if int(op) < len(ops) {
+		return ops[op]
+	}
+	return "?"
+}
+
+func (op Op) MarshalText() ([]byte, error) { return []byte(op.String()), nil }
+
+// литералы
+
+type Null struct{ spanned }
+
+type Bool struct {
+	spanned
+	Value bool
+}
+
+type Int struct {
+	spanned
+	Value int64
+}
+
+type Real struct {
+	spanned
+	Value float64
+}
+
+type Text struct {
+	spanned
+	Value string
+}
+
+// строка с подстановками: части - текст и выражения
+type Interpolation struct {
+	spanned
+	Parts []Node
+}
+
+type Array struct {
+	spanned
+	Elems []Node
+}
+
+// пара объекта; у развертывания ...x ключ равен nil, значение - Spread
+type Pair struct{ Key, Value Node }
+
+type Object struct {
+	spanned
+	Pairs []Pair
+}
+
+// функция (params, ...rest) -> { body }
+type Function struct {
+	spanned
+	//идентификаторы, шаблоны и Default
+	Params []Node
+	//nil, если функция не принимает остаток аргументов
+	Rest Node
+	Body *Block
+}
+
+// выражения
+
+type Ident struct {
+	spanned
+	Name string
+}
+
+// бинарный оператор
+type Binary struct {
+	spanned
+	Op   Op
+	X, Y Node
+}
+
+// унарный оператор: Neg или Not
+type Unary struct {
+	spanned
+	Op Op
+	X  Node
+}
+
+// x[index]; index может быть Slice
+type Index struct {
+	spanned
+	X, Index Node
+}
+
+// срез start:end:step внутри Index; отсутствующие части равны nil
+type Slice struct {
+	spanned
+	Start, End, Step Node
+}
+
+// x.name
+type Member struct {
+	spanned
+	X    Node
+	Name string
+}
+
+type Call struct {
+	spanned
+	Fn   Node
+	Args []Node
+}
+
+// ...x в массиве, объекте или аргументах вызова
+type Spread struct {
+	spanned
+	X Node
+}
+
+// именованный аргумент name: value
+type Named struct {
+	spanned
+	Name  string
+	Value Node
+}
+
+// шаблоны деструктуризации
+
+// получатель со значением по умолчанию: target = value
+type Default struct {
+	spanned
+	Target, Value Node
+}
+
+// [elems..., ...rest]
+type ArrayPattern struct {
+	spanned
+	Elems []Node
+	Rest  Node
+}
+
+// свойство шаблона объекта key: target
+type Prop struct {
+	Key    string
+	Target Node
+}
+
+// {props..., ...rest}
+type ObjectPattern struct {
+	spanned
+	Props []Prop
+	Rest  Node
+}
+
+// присваивания
+
+// target := value
+type Create struct {
+	spanned
+	Target, Value Node
+}
+
+// target = value
+type Set struct {
+	spanned
+	Target, Value Node
+}
+
+// составное присваивание target op= value
+type Compound struct {
+	spanned
+	Op            Op
+	Target, Value Node
+}
+
+// конструкции
+
+type Block struct {
+	spanned
+	List []Node
+}
+
+type Branch struct {
+	Cond Node
+	Body *Block
+}
+
+// if ... elif ... else ...; Else равен nil, если ветки else нет
+type If struct {
+	spanned
+	Branches []Branch
+	Else     *Block
+}
+
+// [label:] for targets... in from { body }
+type For struct {
+	spanned
+	Label   string
+	Targets []Node
+	From    Node
+	Body    *Block
+}
+
+// [label:] while cond { body }
+type While struct {
+	spanned
+	Label string
+	Cond  Node
+	Body  *Block
+}
+
+type Return struct {
+	spanned
+	Value Node
+}
+
+type Break struct {
+	spanned
+	Label string
+}
+
+type Continue struct {
+	spanned
+	Label string
+}
+
+// try { body } catch name { catch } finally { finally };
+// отсутствующие части равны nil, Name может быть пустым
+type Try struct {
+	spanned
+	Body    *Block
+	Name    string
+	Catch   *Block
+	Finally *Block
+}
+
+type Throw struct {
+	spanned
+	Value Node
+}
+
+// import "path" as name
+type Import struct {
+	spanned
+	Path, Name string
+}
+
+// export target := value
+type Export struct {
+	spanned
+	Target, Value Node
+}
+
+// обход дерева
+
+// Visit вызывается для каждого узла; если возвращенный Visitor w не nil,
+// Walk обходит дочерние узлы с помощью w, а затем вызывает w.Visit(nil)
+type Visitor interface {
+	Visit(n Node) (w Visitor)
+}
+
+func walkList(v Visitor, list []Node) {
+	for _, n := range list {
+		Walk(v, n)
+	}
+}
+
+// обходит дерево в глубину; узлы, равные nil, пропускаются
+func Walk(v Visitor, n Node) {
+	if isNil(n) {
+		return
+	}
+	if v = v.Visit(n); v == nil {
+		return
+	}
+
+	switch n := n.(type) {
+	case *Null, *Bool, *Int, *Real, *Text, *Ident,
+		*Break, *Continue, *Import:
+
+	case *Interpolation:
+		walkList(v, n.Parts)
+	case *Array:
+		walkList(v, n.Elems)
+	case *Object:
+		for _, pair := range n.Pairs {
+			Walk(v, pair.Key)
+			Walk(v, pair.Value)
+		}
+	case *Function:
+		walkList(v, n.Params)
+		Walk(v, n.Rest)
+		Walk(v, n.Body)
+
+	case *Binary:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+	case *Unary:
+		Walk(v, n.X)
+	case *Index:
+		Walk(v, n.X)
+		Walk(v, n.Index)
+	case *Slice:
+		Walk(v, n.Start)
+		Walk(v, n.End)
+		Walk(v, n.Step)
+	case *Member:
+		Walk(v, n.X)
+	case *Call:
+		Walk(v, n.Fn)
+		walkList(v, n.Args)
+	case *Spread:
+		Walk(v, n.X)
+	case *Named:
+		Walk(v, n.Value)
+
+	case *Default:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+	case *ArrayPattern:
+		walkList(v, n.Elems)
+		Walk(v, n.Rest)
+	case *ObjectPattern:
+		for _, prop := range n.Props {
+			Walk(v, prop.Target)
+		}
+		Walk(v, n.Rest)
+
+	case *Create:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+	case *Set:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+	case *Compound:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+
+	case *Block:
+		walkList(v, n.List)
+	case *If:
+		for _, branch := range n.Branches {
+			Walk(v, branch.Cond)
+			Walk(v, branch.Body)
+		}
+		Walk(v, n.Else)
+	case *For:
+		walkList(v, n.Targets)
+		Walk(v, n.From)
+		Walk(v, n.Body)
+	case *While:
+		Walk(v, n.Cond)
+		Walk(v, n.Body)
+	case *Return:
+		Walk(v, n.Value)
+	case *Try:
+		Walk(v, n.Body)
+		Walk(v, n.Catch)
+		Walk(v, n.Finally)
+	case *Throw:
+		Walk(v, n.Value)
+	case *Export:
+		Walk(v, n.Target)
+		Walk(v, n.Value)
+
+	default:
+		panic("неизвестный узел " + reflect.TypeOf(n).String())
+	}
+
+	v.Visit(nil)
+}
+
+// узел равен nil, в том числе типизированный nil (*Block)(nil)
+func isNil(n Node) bool {
+	if n == nil {
+		return true
+	}
+	v := reflect.ValueOf(n)
+	return v.Kind() == reflect.Pointer && v.IsNil()
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(n Node) Visitor {
+	if f(n) {
+		return f
+	}
+	return nil
+}
+
+// обходит дерево в глубину, вызывая f для каждого узла;
+// если f возвращает true, обходятся дочерние узлы, а затем вызывается f(nil)
+func Inspect(n Node, f func(Node) bool) { Walk(inspector(f), n) }
+
+// вывод в JSON
+
+// поле объекта JSON; порядок полей сохраняется
+type field struct {
+	key   string
+	value any
+}
+
+type object []field
+
+func (o object) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, f := range o {
+		if i != 0 {
+			b.WriteByte(',')
+		}
+
+		key, err := json.Marshal(f.key)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+
+		value, err := json.Marshal(f.value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// имя поля в JSON: Value -> value, Elems -> elems
+func jsonName(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func span(s Span) object {
+	p := func(p Pos) object {
+		return object{{"line", p.Line}, {"column", p.Column}, {"offset", p.Offset}}
+	}
+	return object{{"start", p(s.Start)}, {"end", p(s.End)}}
+}
+
+// значение поля узла: узлы, списки узлов и вспомогательные структуры
+// (Pair, Prop, Branch) записываются объектами JSON
+func dump(v reflect.Value) any {
+	switch v.Kind() {
+	case reflect.Interface:
+		if v.IsNil() {
+			return nil
+		}
+		return dump(v.Elem())
+
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+
+		n := v.Interface().(Node)
+		o := object{{"node", v.Elem().Type().Name()}}
+		if s := n.Span(); s != (Span{}) {
+			o = append(o, field{"span", span(s)})
+		}
+		return append(o, fields(v.Elem())...)
+
+	case reflect.Slice:
+		list := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			list = append(list, dump(v.Index(i)))
+		}
+		return list
+
+	case reflect.Struct:
+		return fields(v)
+
+	default:
+		return v.Interface()
+	}
+}
+
+// экспортируемые поля структуры
+func fields(v reflect.Value) object {
+	o := object{}
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Type().Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		o = append(o, field{jsonName(f.Name), dump(v.Field(i))})
+	}
+	return o
+}
+
+// записывает дерево в JSON с отступами; каждый узел - объект
+// с типом узла в поле node, участком исходного кода в поле span
+// (если он известен) и полями узла
+func Dump(n Node) ([]byte, error) {
+	data, err := json.Marshal(dump(reflect.ValueOf(&n).Elem()))
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := json.Indent(&b, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
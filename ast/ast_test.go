@@ -0,0 +1,198 @@
+package ast
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Op_String(t *testing.T) {
+	tests := []struct {
+		op            Op
+		expectedValue string
+	}{
+		{Add, "+"},
+		{Concat, "||"},
+		{Lte, "<="},
+		{And, "and"},
+		{OrValue, "?:"},
+		{Neg, "-"},
+		{Not, "not"},
+		{Op(200), "?"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedValue, test.op.String())
+	}
+}
+
+// f := (x, ...rest) -> { if x > 0 { return [x, ...rest] } else { throw "e" } }
+func tree() Node {
+	return &Block{List: []Node{
+		&Create{
+			Target: &Ident{Name: "f"},
+			Value: &Function{
+				Params: []Node{&Ident{Name: "x"}},
+				Rest:   &Ident{Name: "rest"},
+				Body: &Block{List: []Node{
+					&If{
+						Branches: []Branch{{
+							Cond: &Binary{Op: Gt, X: &Ident{Name: "x"}, Y: &Int{Value: 0}},
+							Body: &Block{List: []Node{
+								&Return{Value: &Array{Elems: []Node{
+									&Ident{Name: "x"},
+									&Spread{X: &Ident{Name: "rest"}},
+								}}},
+							}},
+						}},
+						Else: &Block{List: []Node{&Throw{Value: &Text{Value: "e"}}}},
+					},
+				}},
+			},
+		},
+	}}
+}
+
+// имя узла для сравнения порядка обхода
+func name(n Node) string {
+	switch n := n.(type) {
+	case nil:
+		return "nil"
+	case *Ident:
+		return n.Name
+	case *Int:
+		return fmt.Sprint(n.Value)
+	case *Text:
+		return fmt.Sprintf("%q", n.Value)
+	case *Binary:
+		return n.Op.String()
+	default:
+		return fmt.Sprintf("%T", n)[len("*ast."):]
+	}
+}
+
+func Test_Inspect(t *testing.T) {
+	var order []string
+	Inspect(tree(), func(n Node) bool {
+		order = append(order, name(n))
+		return true
+	})
+
+	assert.Equal(t, []string{
+		"Block", "Create", "f", "nil",
+		"Function", "x", "nil", "rest", "nil",
+		"Block", "If", ">", "x", "nil", "0", "nil", "nil",
+		"Block", "Return", "Array", "x", "nil", "Spread", "rest", "nil", "nil", "nil", "nil", "nil",
+		"Block", "Throw", `"e"`, "nil", "nil", "nil",
+		"nil", "nil", "nil", "nil", "nil",
+	}, order)
+
+	//дочерние узлы функции не обходятся
+	var idents []string
+	Inspect(tree(), func(n Node) bool {
+		if id, ok := n.(*Ident); ok {
+			idents = append(idents, id.Name)
+		}
+		_, ok := n.(*Function)
+		return !ok
+	})
+	assert.Equal(t, []string{"f"}, idents)
+}
+
+type counter map[string]int
+
+func (c counter) Visit(n Node) Visitor {
+	if n != nil {
+		c[name(n)]++
+	}
+	return c
+}
+
+func Test_Walk(t *testing.T) {
+	c := counter{}
+	Walk(c, tree())
+
+	assert.Equal(t, counter{
+		"Block": 4, "Create": 1, "Function": 1, "If": 1, "Return": 1,
+		"Array": 1, "Spread": 1, "Throw": 1, ">": 1,
+		"f": 1, "x": 3, "rest": 2, "0": 1, `"e"`: 1,
+	}, c)
+
+	//пустые части узлов пропускаются
+	c = counter{}
+	Walk(c, &Try{Body: &Block{}, Finally: &Block{}})
+	Walk(c, &Index{X: &Ident{Name: "a"}, Index: &Slice{End: &Int{Value: 1}}})
+	assert.Equal(t, counter{"Try": 1, "Block": 2, "Index": 1, "a": 1, "Slice": 1, "1": 1}, c)
+}
+
+func Test_Dump(t *testing.T) {
+	x := &Ident{Name: "x"}
+	SetSpan(x, Span{
+		Start: Pos{Line: 1, Column: 1},
+		End:   Pos{Line: 1, Column: 2, Offset: 1},
+	})
+
+	data, err := Dump(&Block{List: []Node{
+		&Compound{Op: Add, Target: x, Value: &Int{Value: 1}},
+		&Object{Pairs: []Pair{{Key: &Text{Value: "a"}, Value: &Null{}}}},
+		&Try{Body: &Block{}, Name: "e"},
+	}})
+	assert.NoError(t, err)
+	assert.Equal(t, `{
+  "node": "Block",
+  "list": [
+    {
+      "node": "Compound",
+      "op": "+",
+      "target": {
+        "node": "Ident",
+        "span": {
+          "start": {
+            "line": 1,
+            "column": 1,
+            "offset": 0
+          },
+          "end": {
+            "line": 1,
+            "column": 2,
+            "offset": 1
+          }
+        },
+        "name": "x"
+      },
+      "value": {
+        "node": "Int",
+        "value": 1
+      }
+    },
+    {
+      "node": "Object",
+      "pairs": [
+        {
+          "key": {
+            "node": "Text",
+            "value": "a"
+          },
+          "value": {
+            "node": "Null"
+          }
+        }
+      ]
+    },
+    {
+      "node": "Try",
+      "body": {
+        "node": "Block",
+        "list": []
+      },
+      "name": "e",
+      "catch": null,
+      "finally": null
+    }
+  ]
+}`, string(data))
+
+	data, err = Dump(nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "null", string(data))
+}
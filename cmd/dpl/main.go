@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/suprunchuksergey/dpl"
+	"github.com/suprunchuksergey/dpl/ast"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const usage = `использование:
+	dpl run файл         выполняет программу
+	dpl fmt [-w] файлы   форматирует программы (без файлов - стандартный ввод)
+	dpl ast файл         выводит синтаксическое дерево программы в JSON
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = run(os.Args[2:])
+	case "fmt":
+		err = format(os.Args[2:])
+	case "ast":
+		err = dump(os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+// выполняет программу, модули загружаются из каталога программы
+func run(args []string) error {
+	if len(args) != 1 {
+		return errors.New("ожидался один файл программы")
+	}
+
+	program, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	dir, name := filepath.Split(args[0])
+	if dir == "" {
+		dir = "."
+	}
+
+	_, err = dpl.ExecWithLoader(name, string(program), nil, dpl.FSLoader(os.DirFS(dir)))
+	return err
+}
+
+// выводит синтаксическое дерево программы
+func dump(args []string) error {
+	if len(args) != 1 {
+		return errors.New("ожидался один файл программы")
+	}
+
+	program, err := os.ReadFile(args[0])
+	if err != nil {
+		return err
+	}
+
+	tree, err := dpl.ParseFile(args[0], string(program))
+	if err != nil {
+		return err
+	}
+
+	data, err := ast.Dump(tree)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Println(string(data))
+	return err
+}
+
+// форматирует файлы; с -w результат записывается в файлы, иначе в стандартный вывод
+func format(args []string) error {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := flags.Bool("w", false, "записать результат в исходный файл")
+	_ = flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		src, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+
+		res, err := dpl.FormatFile("<stdin>", string(src))
+		if err != nil {
+			return err
+		}
+
+		_, err = io.WriteString(os.Stdout, res)
+		return err
+	}
+
+	for _, filename := range flags.Args() {
+		src, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+
+		res, err := dpl.FormatFile(filename, string(src))
+		if err != nil {
+			return err
+		}
+
+		if !*write {
+			if _, err := io.WriteString(os.Stdout, res); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if res == string(src) {
+			continue
+		}
+		if err := os.WriteFile(filename, []byte(res), 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,26 +1,643 @@
+// Package dpl выполняет программы на DPL и встраивает язык в приложения на Go.
+//
+// Interpreter хранит глобальные переменные, функции Go, загрузчик модулей
+// и поток вывода; Exec и ExecFile выполняют программу с этими настройками.
+// Compile компилирует программу в байт-код один раз, а (*Program).Run выполняет ее
+// многократно, в том числе одновременно из нескольких горутин.
+// Значения языка имеют тип Value; конструкторы (Int, Text, Array, Object и
+// другие), ValueOf и Convert преобразуют значения между Go и DPL, Func
+// превращает обычную функцию Go в функцию языка. Ошибки разбора имеют тип
+// *SyntaxError, ошибки выполнения - *RuntimeError.
+//
+// Совместимость: API пакетов dpl и ast следует семантическому
+// версионированию - в пределах одной старшей версии модуля экспортируемые
+// имена не удаляются и не меняют сигнатуры, а тексты ошибок меняются
+// только вместе с младшей версией. Пакеты internal/... не входят в API
+// и могут меняться в любой версии.
 package dpl
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/suprunchuksergey/dpl/ast"
+	"github.com/suprunchuksergey/dpl/internal/compile"
+	"github.com/suprunchuksergey/dpl/internal/format"
 	"github.com/suprunchuksergey/dpl/internal/lexer"
 	"github.com/suprunchuksergey/dpl/internal/namespace"
+	"github.com/suprunchuksergey/dpl/internal/node"
 	"github.com/suprunchuksergey/dpl/internal/parser"
+	"github.com/suprunchuksergey/dpl/internal/pos"
 	"github.com/suprunchuksergey/dpl/internal/value"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
 )
 
-func Exec(program string, init map[string]value.Value) (value.Value, error) {
-	tokens, err := lexer.Tokenize(program)
+// имя файла, которое используется в сообщениях об ошибках Exec
+const DefaultFilename = "main.dpl"
+
+// ограничения одного выполнения программы: число инструкций, глубина
+// вызовов функций (по умолчанию DefaultDepth) и время выполнения;
+// нулевое поле - без ограничения
+type Limits = node.Limits
+
+// глубина вызовов функций, если Limits.Depth не задана
+const DefaultDepth = node.DefaultDepth
+
+// ошибки ограничений выполнения доступны через errors.As у *RuntimeError;
+// try не перехватывает их, finally при них не выполняется
+type (
+	//превышено Limits.Steps
+	StepLimitError = node.StepLimitError
+	//превышена Limits.Depth
+	DepthLimitError = node.DepthLimitError
+	//превышено Limits.Timeout
+	TimeoutError = node.TimeoutError
+	//контекст выполнения отменен; errors.Is находит ошибку контекста
+	CanceledError = node.CanceledError
+)
+
+// значение языка
+type Value = value.Value
+
+// типы значений (Value.Type)
+const (
+	IntType      = value.IntType
+	RealType     = value.RealType
+	TextType     = value.TextType
+	BoolType     = value.BoolType
+	ArrayType    = value.ArrayType
+	ObjectType   = value.ObjectType
+	FunctionType = value.FunctionType
+	NullType     = value.NullType
+	ErrorType    = value.ErrorType
+)
+
+// виды ошибок (RuntimeError.Kind и поле kind значения ошибки)
+const (
+	//внутренние ошибки: деление на ноль, выход за границы и т.п.
+	RuntimeErrorKind = value.RuntimeErrorKind
+	//ошибки, выброшенные throw без указания вида
+	ErrorKind = value.ErrorKind
+)
+
+func Int(v int64) Value    { return value.Int(v) }
+func Real(v float64) Value { return value.Real(v) }
+func Text(v string) Value  { return value.Text(v) }
+func Bool(v bool) Value    { return value.Bool(v) }
+func Null() Value          { return value.Null() }
+
+func Array(elems ...Value) Value { return value.Array(elems...) }
+
+// объект; поля добавляются в порядке возрастания ключей
+func Object(fields map[string]Value) Value {
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	pairs := make([]value.KV, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, value.KV{Key: value.Text(k), Value: fields[k]})
+	}
+	return value.Object(pairs...)
+}
+
+func Function(fn func(args ...Value) (Value, error)) Value { return value.Function(fn) }
+
+// значение ошибки, как у встроенной функции error(message, kind)
+func Error(message, kind string) Value { return value.Error(message, kind, 0, 0) }
+
+// значение из значения Go: чисел, строк, bool, nil, срезов и map,
+// в том числе вложенных; Value возвращается без изменений
+func ValueOf(v any) (Value, error) { return value.Of(v) }
+
+// значение Go типа T из значения: поддерживаются Value, any, целые и
+// вещественные числа, string, bool, срезы из массивов и map[string]... из объектов
+func Convert[T any](v Value) (T, error) {
+	var res T
+	x, err := value.To(v, reflect.TypeFor[T]())
+	if err != nil {
+		return res, err
+	}
+	if x.IsValid() && !x.IsZero() {
+		res = x.Interface().(T)
+	}
+	return res, nil
+}
+
+// функция языка из функции Go; аргументы преобразуются как в Convert,
+// результат - как в ValueOf. Функция может возвращать ничего, значение,
+// ошибку или значение и ошибку; ошибка прерывает выполнение программы
+// и доступна через errors.Is/errors.As у *RuntimeError
+func Func(fn any) (Value, error) { return value.FunctionOf(fn) }
+
+// ошибка, найденная до выполнения программы: синтаксическая ошибка
+// или повторное объявление переменной в одном пространстве
+type SyntaxError struct {
+	Filename string
+	//позиция ошибки; 0, если неизвестна
+	Line, Column int
+	//текст ошибки без позиции
+	Message string
+
+	err error
+}
+
+// текст ошибки с позицией и фрагментом исходного кода
+func (e *SyntaxError) Error() string { return e.err.Error() }
+
+func (e *SyntaxError) Unwrap() error { return e.err }
+
+func syntaxError(filename, program string, err error) error {
+	var se *SyntaxError
+	if errors.As(err, &se) {
+		return err
+	}
+
+	e := &SyntaxError{
+		Filename: filename,
+		Message:  err.Error(),
+		err:      pos.Report(filename, program, err),
+	}
+
+	var pe *pos.Error
+	if errors.As(err, &pe) {
+		e.Line, e.Column = pe.Pos.Line, pe.Pos.Column
+		e.Message = pe.Err.Error()
+	}
+	return e
+}
+
+// ошибка выполнения: внутренняя ошибка, ошибка функции Go
+// или ошибка, выброшенная throw и не пойманная программой
+type RuntimeError struct {
+	//файл, в котором произошла ошибка (модуль для ошибок в модулях)
+	Filename string
+	//позиция ошибки; 0, если неизвестна
+	Line, Column int
+	//текст ошибки без позиции
+	Message string
+	//вид ошибки: RuntimeErrorKind или вид, указанный в throw
+	Kind string
+
+	err error
+}
+
+// текст ошибки с позицией и фрагментом исходного кода
+func (e *RuntimeError) Error() string { return e.err.Error() }
+
+func (e *RuntimeError) Unwrap() error { return e.err }
+
+// оформляет ошибку выполнения; синтаксические ошибки
+// импортированных модулей возвращаются без изменений
+func runtimeError(err error) error {
+	var se *SyntaxError
+	var re *RuntimeError
+	if errors.As(err, &se) || errors.As(err, &re) {
+		return err
+	}
+
+	e := &RuntimeError{err: err}
+
+	var r *pos.ReportError
+	if errors.As(err, &r) {
+		e.Filename = r.Filename
+	}
+
+	v := node.ErrorOf(err)
+	field := func(name string) Value {
+		f, _ := v.ElByIndex(value.Text(name))
+		return f
+	}
+	line, _ := field("line").Int()
+	column, _ := field("column").Int()
+	e.Line, e.Column = int(line), int(column)
+	e.Message = field("message").Text()
+	e.Kind = field("kind").Text()
+	return e
+}
+
+// интерпретатор с настройками выполнения программ: глобальными переменными,
+// загрузчиком модулей и потоком вывода. Каждое выполнение получает собственное
+// пространство имен, поэтому переменные программы не сохраняются между вызовами
+// Exec. Настройка интерпретатора не безопасна для одновременного использования
+// из нескольких горутин
+type Interpreter struct {
+	globals map[string]Value
+	loader  Loader
+	output  io.Writer
+	limits  Limits
+}
+
+// интерпретатор без загрузчика модулей, print и println пишут в os.Stdout
+func NewInterpreter() *Interpreter {
+	return &Interpreter{
+		globals: make(map[string]Value),
+		output:  os.Stdout,
+	}
+}
+
+// задает глобальную переменную; переменная с именем встроенной функции
+// заменяет встроенную функцию
+func (in *Interpreter) Set(name string, v Value) { in.globals[name] = v }
+
+// задает глобальную функцию из функции Go (см. Func)
+func (in *Interpreter) Register(name string, fn any) error {
+	v, err := Func(fn)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	in.Set(name, v)
+	return nil
+}
+
+// задает загрузчик модулей для import; nil запрещает import
+func (in *Interpreter) SetLoader(loader Loader) { in.loader = loader }
+
+// задает поток вывода print и println
+func (in *Interpreter) SetOutput(w io.Writer) { in.output = w }
+
+// задает ограничения каждого выполнения программы
+func (in *Interpreter) SetLimits(limits Limits) { in.limits = limits }
+
+func (in *Interpreter) Exec(program string) (Value, error) {
+	return in.ExecFile(DefaultFilename, program)
+}
+
+// выполняет программу, пока не отменен контекст ctx
+func (in *Interpreter) ExecContext(ctx context.Context, program string) (Value, error) {
+	p, err := in.Compile(program)
 	if err != nil {
 		return nil, err
 	}
+	return p.Run(ctx, nil)
+}
 
-	n, err := parser.Parse(tokens)
+// выполняет программу и возвращает результат последней конструкции;
+// ошибки имеют тип *SyntaxError или *RuntimeError
+func (in *Interpreter) ExecFile(filename, program string) (Value, error) {
+	p, err := in.CompileFile(filename, program)
 	if err != nil {
 		return nil, err
 	}
+	return p.Run(context.Background(), nil)
+}
+
+func (in *Interpreter) Compile(program string) (*Program, error) {
+	return in.CompileFile(DefaultFilename, program)
+}
+
+// компилирует программу для многократного выполнения; программа получает
+// копию текущих настроек интерпретатора, их последующие изменения
+// на программу не влияют
+func (in *Interpreter) CompileFile(filename, program string) (*Program, error) {
+	code, err := compileFile(filename, program)
+	if err != nil {
+		return nil, err
+	}
+	return in.program(filename, program, code), nil
+}
+
+// компилирует синтаксическое дерево, например полученное из Parse
+// и измененное; исходного кода у дерева нет, поэтому ошибки содержат
+// только позицию filename:line:col из участков узлов
+func (in *Interpreter) CompileTree(filename string, tree *ast.Block) (*Program, error) {
+	if err := compile.Check(tree); err != nil {
+		return nil, syntaxError(filename, "", err)
+	}
+	code, err := build(tree)
+	if err != nil {
+		return nil, syntaxError(filename, "", err)
+	}
+	return in.program(filename, "", code), nil
+}
+
+// программа с копией текущих настроек интерпретатора
+func (in *Interpreter) program(filename, source string, code *node.Code) *Program {
+	return &Program{
+		filename: filename,
+		source:   source,
+		root:     code,
+		globals:  maps.Clone(in.globals),
+		loader:   in.loader,
+		output:   in.output,
+		limits:   in.limits,
+		modules:  make(map[string]*node.Code),
+	}
+}
+
+// программа, скомпилированная один раз для многократного выполнения.
+// Байт-код программы не изменяется при выполнении, поэтому Run можно вызывать
+// одновременно из нескольких горутин; каждое выполнение получает собственное
+// пространство имен и собственные экземпляры модулей. Значения глобальных
+// переменных (массивы, объекты) не копируются: если программа их изменяет,
+// изменения видны другим выполнениям с теми же значениями
+type Program struct {
+	filename string
+	source   string
+	root     *node.Code
+	globals  map[string]Value
+	loader   Loader
+	output   io.Writer
+	limits   Limits
+
+	mu sync.Mutex
+	//скомпилированные модули по исходному коду: модуль, загруженный
+	//в нескольких выполнениях, компилируется один раз
+	modules map[string]*node.Code
+}
+
+func Compile(program string) (*Program, error) {
+	return CompileFile(DefaultFilename, program)
+}
+
+// компилирует программу для многократного выполнения без глобальных
+// переменных и загрузчика модулей; print и println пишут в os.Stdout
+func CompileFile(filename, program string) (*Program, error) {
+	return NewInterpreter().CompileFile(filename, program)
+}
 
-	return n.Exec(initNamespace(init))
+// компилирует синтаксическое дерево без глобальных переменных
+// и загрузчика модулей
+func CompileTree(filename string, tree *ast.Block) (*Program, error) {
+	return NewInterpreter().CompileTree(filename, tree)
+}
+
+// выполняет программу; globals дополняют и заменяют глобальные переменные
+// интерпретатора только для этого выполнения. Выполнение не начинается
+// (и не загружает новые модули), если контекст отменен (*CanceledError),
+// и прерывается, если контекст отменен во время выполнения
+// или превышены ограничения интерпретатора (Limits).
+// Ошибки выполнения имеют тип *RuntimeError
+func (p *Program) Run(ctx context.Context, globals map[string]Value) (Value, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, &CanceledError{Err: err}
+	}
+
+	m := &modules{
+		ctx:     ctx,
+		program: p,
+		root:    initNamespace(p.output, p.globals, globals),
+		cache:   make(map[string]value.Value),
+		budget:  node.NewBudget(ctx, p.limits),
+	}
+	defer m.budget.Finish()
+
+	v, _, err := m.run(p.filename, p.source, p.root)
+	if err != nil {
+		return nil, runtimeError(err)
+	}
+	return v, nil
+}
+
+// компилирует модуль или возвращает ранее скомпилированный
+func (p *Program) module(filename, source string) (*node.Code, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if n, ok := p.modules[source]; ok {
+		return n, nil
+	}
+
+	code, err := compileFile(filename, source)
+	if err != nil {
+		return nil, err
+	}
+
+	p.modules[source] = code
+	return code, nil
+}
+
+// разбирает и компилирует программу в байт-код
+func compileFile(filename, program string) (*node.Code, error) {
+	tree, err := ParseFile(filename, program)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := build(tree)
+	if err != nil {
+		return nil, syntaxError(filename, program, err)
+	}
+	return code, nil
+}
+
+// компилирует синтаксическое дерево в байт-код; дерево упрощается
+// до компиляции, поэтому константные выражения не вычисляются
+// при каждом выполнении, а ошибки ищутся в неупрощенном дереве
+func build(tree *ast.Block) (*node.Code, error) {
+	return node.CompileOptimized(compile.Compile(tree))
+}
+
+func Exec(program string, init map[string]Value) (Value, error) {
+	return ExecFile(DefaultFilename, program, init)
+}
+
+// выполняет программу; ошибки содержат позицию в виде filename:line:col
+// и строку исходного кода с указателем на место ошибки
+func ExecFile(filename, program string, init map[string]Value) (Value, error) {
+	return ExecWithLoader(filename, program, init, nil)
+}
+
+// выполняет программу, модули для import загружаются через loader
+// (пути модулей считаются относительно каталога импортирующего модуля);
+// loader может быть nil, тогда import - ошибка
+func ExecWithLoader(
+	filename, program string,
+	init map[string]Value,
+	loader Loader,
+) (Value, error) {
+	in := NewInterpreter()
+	in.SetLoader(loader)
+
+	p, err := in.CompileFile(filename, program)
+	if err != nil {
+		return nil, err
+	}
+	return p.Run(context.Background(), init)
+}
+
+// загружает исходный код модуля по пути из import
+type Loader interface {
+	Load(path string) (string, error)
+}
+
+type LoaderFunc func(path string) (string, error)
+
+func (f LoaderFunc) Load(path string) (string, error) { return f(path) }
+
+type fsLoader struct{ fsys fs.FS }
+
+func (l fsLoader) Load(path string) (string, error) {
+	data, err := fs.ReadFile(l.fsys, path)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// загрузчик модулей из файловой системы fsys
+func FSLoader(fsys fs.FS) Loader { return fsLoader{fsys: fsys} }
+
+func cyclicImport(chain []string) error {
+	return fmt.Errorf("циклический импорт: %s", strings.Join(chain, " -> "))
+}
+
+func noLoader() error { return errors.New("загрузчик модулей не задан") }
+
+func loadFailed(path string, err error) error {
+	return fmt.Errorf("не удалось загрузить модуль %s: %w", path, err)
+}
+
+// модули одного выполнения программы: каждый модуль выполняется один раз,
+// повторный import возвращает тот же объект
+type modules struct {
+	ctx     context.Context
+	program *Program
+	//встроенные функции и глобальные переменные, общие для всех модулей
+	root  namespace.Namespace
+	cache map[string]value.Value
+	//модули, выполняющиеся в данный момент, в порядке импорта
+	loading []string
+	//ограничения, общие для программы и модулей
+	budget *node.Budget
+}
+
+// выполняет модуль в собственном пространстве имен;
+// возвращает результат последней конструкции и объект модуля
+func (m *modules) run(filename, source string, code *node.Code) (value.Value, value.Value, error) {
+	exports := value.Object()
+	scope := m.root.New(map[string]value.Value{
+		node.ImportName: value.Function(func(args ...value.Value) (value.Value, error) {
+			return m.load(path.Join(path.Dir(filename), args[0].Text()))
+		}),
+		node.ExportName: exports,
+	})
+
+	m.loading = append(m.loading, filename)
+	v, err := code.Run(scope, m.budget)
+	m.loading = m.loading[:len(m.loading)-1]
+	if err != nil {
+		return nil, nil, pos.Report(filename, source, err)
+	}
+
+	//в объект модуля попадают значения на момент окончания его выполнения
+	names, err := exports.Iter()
+	if err != nil {
+		return nil, nil, err
+	}
+	for name := range names {
+		current, err := scope.Get(name.Text())
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := exports.SetElByIndex(name, current); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return v, exports, nil
+}
+
+func (m *modules) load(filename string) (value.Value, error) {
+	if module, ok := m.cache[filename]; ok {
+		return module, nil
+	}
+
+	if i := slices.Index(m.loading, filename); i != -1 {
+		return nil, cyclicImport(append(slices.Clone(m.loading[i:]), filename))
+	}
+
+	if err := m.ctx.Err(); err != nil {
+		return nil, &CanceledError{Err: err}
+	}
+
+	loader := m.program.loader
+	if loader == nil {
+		return nil, noLoader()
+	}
+
+	source, err := loader.Load(filename)
+	if err != nil {
+		return nil, loadFailed(filename, err)
+	}
+
+	code, err := m.program.module(filename, source)
+	if err != nil {
+		return nil, err
+	}
+
+	_, module, err := m.run(filename, source, code)
+	if err != nil {
+		return nil, err
+	}
+
+	m.cache[filename] = module
+	return module, nil
+}
+
+func Parse(program string) (*ast.Block, error) { return ParseFile(DefaultFilename, program) }
+
+// разбирает программу в синтаксическое дерево без выполнения;
+// узлы дерева содержат участки исходного кода; ошибки имеют тип *SyntaxError
+func ParseFile(filename, program string) (*ast.Block, error) {
+	tokens, err := lexer.Tokenize(program)
+	if err != nil {
+		return nil, syntaxError(filename, program, err)
+	}
+
+	tree, err := parser.Parse(tokens)
+	if err != nil {
+		return nil, syntaxError(filename, program, err)
+	}
+	return tree, nil
+}
+
+func Check(program string) []error { return CheckFile(DefaultFilename, program) }
+
+// проверяет программу без выполнения;
+// в отличие от ExecFile, возвращает все синтаксические ошибки (*SyntaxError),
+// а не только первую
+func CheckFile(filename, program string) []error {
+	tokens, err := lexer.Tokenize(program)
+	if err != nil {
+		return []error{syntaxError(filename, program, err)}
+	}
+
+	tree, errs := parser.ParseRecover(tokens)
+	if len(errs) == 0 {
+		//повторное объявление переменной обнаруживается при компиляции
+		if _, err := build(tree); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	reports := make([]error, 0, len(errs))
+	for _, err := range errs {
+		reports = append(reports, syntaxError(filename, program, err))
+	}
+	return reports
+}
+
+func Format(program string) (string, error) { return FormatFile(DefaultFilename, program) }
+
+// форматирует исходный код программы в каноническом виде;
+// программа с синтаксической ошибкой (*SyntaxError) не форматируется
+func FormatFile(filename, program string) (string, error) {
+	res, err := format.Format(program)
+	if err != nil {
+		return "", syntaxError(filename, program, err)
+	}
+	return res, nil
 }
 
 func builtinLen(args ...value.Value) (value.Value, error) {
@@ -43,38 +660,65 @@ func builtinAppend(args ...value.Value) (value.Value, error) {
 	return v.Append(args[1:]...)
 }
 
-func builtinPrint(args ...value.Value) (value.Value, error) {
-	a := make([]any, 0, len(args))
-	for _, v := range args {
-		a = append(a, v.String())
+// error(message, kind = "error") - значение ошибки для throw
+func builtinError(args ...value.Value) (value.Value, error) {
+	if len(args) == 0 {
+		return nil, errors.New("error: требуется сообщение")
 	}
 
-	fmt.Print(a...)
+	kind := value.ErrorKind
+	if len(args) > 1 {
+		kind = args[1].Text()
+	}
 
-	return value.Null(), nil
+	return value.Error(args[0].Text(), kind, 0, 0), nil
 }
 
-func builtinPrintln(args ...value.Value) (value.Value, error) {
-	a := make([]any, 0, len(args))
-	for _, v := range args {
-		a = append(a, v.String())
+func builtinPrint(w io.Writer) func(args ...value.Value) (value.Value, error) {
+	return func(args ...value.Value) (value.Value, error) {
+		a := make([]any, 0, len(args))
+		for _, v := range args {
+			a = append(a, v.String())
+		}
+
+		if _, err := fmt.Fprint(w, a...); err != nil {
+			return nil, err
+		}
+
+		return value.Null(), nil
 	}
+}
+
+func builtinPrintln(w io.Writer) func(args ...value.Value) (value.Value, error) {
+	return func(args ...value.Value) (value.Value, error) {
+		a := make([]any, 0, len(args))
+		for _, v := range args {
+			a = append(a, v.String())
+		}
 
-	fmt.Println(a...)
+		if _, err := fmt.Fprintln(w, a...); err != nil {
+			return nil, err
+		}
 
-	return value.Null(), nil
+		return value.Null(), nil
+	}
 }
 
-func initNamespace(init map[string]value.Value) namespace.Namespace {
+// встроенные функции и глобальные переменные; переменные из следующих
+// наборов заменяют одноименные из предыдущих
+func initNamespace(output io.Writer, globals ...map[string]value.Value) namespace.Namespace {
 	m := map[string]value.Value{
 		"len":     value.Function(builtinLen),
 		"append":  value.Function(builtinAppend),
-		"print":   value.Function(builtinPrint),
-		"println": value.Function(builtinPrintln),
+		"error":   value.Function(builtinError),
+		"print":   value.Function(builtinPrint(output)),
+		"println": value.Function(builtinPrintln(output)),
 	}
 
-	for k, v := range init {
-		m[k] = v
+	for _, init := range globals {
+		for k, v := range init {
+			m[k] = v
+		}
 	}
 
 	return namespace.New(m)
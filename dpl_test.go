@@ -1,10 +1,16 @@
 package dpl
 
 import (
+	"context"
 	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/suprunchuksergey/dpl/ast"
 	"github.com/suprunchuksergey/dpl/internal/value"
 )
 
@@ -54,6 +60,348 @@ for i in 4 {
 len(arr);
 `, value.Int(4),
 			nil},
+
+		{`
+arr := [1, 2, 3, 4, 5]
+arr[1:3] = ["a", "b", "c"]
+[arr[-1], arr[:2], arr[::-2], "привет"[-3:]]
+`, value.Array(
+			value.Int(5),
+			value.Array(value.Int(1), value.Text("a")),
+			value.Array(value.Int(5), value.Text("c"), value.Text("a")),
+			value.Text("вет"),
+		), nil},
+
+		{`
+counter := {"value": 0, "items": [{"n": 1}]};
+counter.inc = (by) -> {
+	counter.value = counter.value + by;
+	return counter.value;
+};
+counter.inc(2);
+counter.items[0].n = counter.inc(3);
+[counter.value, counter.items[0].n];
+`, value.Array(value.Int(5), value.Int(5)), nil},
+
+		{`
+x := 3;
+y := [1, 2];
+"x=${x}, y=${y[1] + 1}, ${"вложенная ${x * 2}"}";
+`, value.Text("x=3, y=3, вложенная 6"), nil},
+
+		{`
+factorial := (n) -> {
+	if n <= 1 {
+		return 1
+	}
+	return n * factorial(n-1)
+}
+
+sum := 0
+for i in 8 {
+	if i % 2 == 0 {
+		sum = sum + factorial(i)
+	}
+	else {
+		sum = sum - 1
+	}
+}
+
+sum
+`, value.Int(743), nil},
+
+		{`
+primes := []
+n := 2
+while len(primes) < 5 {
+	isPrime := true
+	for i, p in primes {
+		if n % p == 0 {
+			isPrime = false
+			break
+		}
+	}
+	n = n + 1
+	if not isPrime {
+		continue
+	}
+	primes = append(primes, n - 1)
+}
+
+pairs := []
+outer: for i in 4 {
+	for j in 4 {
+		if j > i {
+			continue outer
+		}
+		if i == 3 {
+			break outer
+		}
+		pairs = append(pairs, [i, j])
+	}
+}
+
+[primes, len(pairs)]
+`, value.Array(
+			value.Array(value.Int(2), value.Int(3), value.Int(5), value.Int(7), value.Int(11)),
+			value.Int(6),
+		), nil},
+
+		{`
+rows := [["а", 1], ["б", 2], ["в", 3]]
+total := 0
+names := ""
+for i, [name, n] in rows {
+	names = names || name
+	total = total + n
+}
+
+[first, ...others] := rows
+{x, y = 0, ...meta} := {"x": 1, "id": 7}
+[x, total] = [total, x]
+
+sum := ([a, b = 10]) -> { return a + b }
+
+[names, x, total, len(others), y, meta.id, sum([1]), sum([1, 2])]
+`, value.Array(
+			value.Text("абв"), value.Int(6), value.Int(1), value.Int(2),
+			value.Int(0), value.Int(7), value.Int(11), value.Int(3),
+		), nil},
+
+		{`
+calls := 0
+f := (v) -> {
+	calls += 1
+	return v
+}
+x := null
+user := {"name": ""}
+[
+	x != null and x[0] > 1,
+	f(true) or f(false),
+	user.name ?: "гость",
+	x && x[0],
+	[1] && 2,
+	calls,
+]
+`, value.Array(
+			value.Bool(false), value.Bool(true), value.Text("гость"),
+			value.Null(), value.Int(2), value.Int(1),
+		), nil},
+
+		{`
+counts := {"a": 0, "b": 0}
+log := ""
+for i, ch in "abba" {
+	counts[ch] += 1
+	log ||= ch
+}
+n := 100
+n -= 1
+n *= 2
+n /= 3
+n %= 5
+[counts.a, counts.b, log, n]
+`, value.Array(value.Int(2), value.Int(2), value.Text("abba"), value.Int(1)), nil},
+
+		{`
+[a, b] := [1, 2, 3]
+`, nil, errors.New("main.dpl:2:1: слишком много элементов для деструктуризации: ожидалось 2, получено 3\n" +
+			"[a, b] := [1, 2, 3]\n" +
+			"^")},
+
+		{`
+f := () -> {
+	break
+}
+`, nil, errors.New("main.dpl:3:2: break может использоваться только в цикле\n" +
+			"\tbreak\n" +
+			"\t^")},
+
+		{`
+f := (a, b) -> { return [a, b] }
+f(b: 1, 5)
+`, nil, errors.New("main.dpl:3:9: позиционный аргумент после именованного\n" +
+			"f(b: 1, 5)\n" +
+			"        ^")},
+
+		{`
+x := 1
+return x
+`, nil, errors.New("main.dpl:3:1: return может использоваться только в контексте функции\n" +
+			"return x\n" +
+			"^")},
+
+		{`
+x := 1
+x = x
+	+ 1
+`, nil, errors.New("main.dpl:4:2: неожиданный токен +\n" +
+			"\t+ 1\n" +
+			"\t^")},
+
+		{`
+sum := (first, ...rest) -> {
+	for i, x in rest {
+		first += x
+	}
+	return first
+}
+defaults := {"x": 0, "y": 0}
+point := {...defaults, "y": 5}
+args := [1, 2]
+[sum(...args, ...[3, 4], 5), sum(1), point.x + point.y]
+`, value.Array(value.Int(15), value.Int(1), value.Int(5)), nil},
+
+		{`
+rect := (w = 640, h = w * 3 / 4, color = "black") -> {
+	return "${w}x${h} ${color}"
+}
+[rect(), rect(800), rect(h: 100), rect(color: "red", w: 100)]
+`, value.Array(
+			value.Text("640x480 black"),
+			value.Text("800x600 black"),
+			value.Text("640x100 black"),
+			value.Text("100x75 red"),
+		), nil},
+
+		{`
+f := (a, b) -> { return a }
+f(1, a: 2)
+`, nil, errors.New("main.dpl:3:6: значение параметра a передано дважды\n" +
+			"f(1, a: 2)\n" +
+			"     ^")},
+
+		{`
+log := []
+safeDiv := (a, b) -> {
+	try {
+		return a / b
+	} catch e {
+		log = append(log, "${e.kind} ${e.line}:${e.column} ${e.message}")
+		return 0
+	} finally {
+		log = append(log, "finally")
+	}
+}
+check := (x) -> {
+	if x < 0 {
+		throw error("отрицательное значение", "range")
+	}
+	return x
+}
+caught := null
+try {
+	check(-1)
+} catch e {
+	caught = [e.kind, e.message, e.line]
+}
+[safeDiv(4, 2), safeDiv(1, 0), caught, log]
+`, value.Array(
+			value.Int(2),
+			value.Int(0),
+			value.Array(value.Text("range"), value.Text("отрицательное значение"), value.Int(15)),
+			value.Array(
+				value.Text("finally"),
+				value.Text("runtime 5:10 деление на ноль"),
+				value.Text("finally"),
+			),
+		), nil},
+
+		{`
+n := 0
+for i in 3 {
+	try {
+		break
+	} finally {
+		n += 1
+	}
+}
+try {
+	throw "не поймано ${n}"
+} catch e {
+	throw e
+}
+`, nil, errors.New("main.dpl:11:2: не поймано 1\n" +
+			"\tthrow \"не поймано ${n}\"\n" +
+			"\t^")},
+
+		{`
+n := 1
+arr := [0, ...n]
+`, nil, errors.New("main.dpl:3:12: значение типа int нельзя развернуть в массив\n" +
+			"arr := [0, ...n]\n" +
+			"           ^")},
+
+		{`
+a := 1;
+b := a / (a - 1);
+`, nil, errors.New("main.dpl:3:6: деление на ноль\n" +
+			"b := a / (a - 1);\n" +
+			"     ^")},
+
+		{`
+f := (x) -> {
+	return x + y;
+};
+f(1);
+`, nil, errors.New("main.dpl:3:13: переменной с именем y не существует\n" +
+			"\treturn x + y;\n" +
+			"\t           ^")},
+
+		//{ в начале строки - литерал объекта или шаблон, а не блок
+		{`
+o := {"a": 1, "b": 2}
+{
+	"a": 3,
+	"b": 4,
+}.b
+{
+	a,
+	b,
+} := o
+a + b
+`, value.Int(3), nil},
+
+		//тело try и finally объявляют переменные в своих пространствах
+		{`
+total := 0;
+for i in 3 {
+	try { x := i; if i == 1 { throw error("e"); }; total += x; } catch e { total += 10; };
+	try { x := i * 100; if i == 2 { break; }; } finally { y := 1; total += y; };
+};
+total;
+`, value.Int(15), nil},
+		{`
+try { x := 1; } catch e {};
+x;
+`, nil, errors.New("main.dpl:3:1: переменной с именем x не существует\n" +
+			"x;\n" +
+			"^")},
+
+		//код, удаляемый оптимизацией, тоже проверяется
+		{`
+if false { nope; };
+`, nil, errors.New("main.dpl:2:12: переменной с именем nope не существует\n" +
+			"if false { nope; };\n" +
+			"           ^")},
+		{`
+while false { nope; };
+`, nil, errors.New("main.dpl:2:15: переменной с именем nope не существует\n" +
+			"while false { nope; };\n" +
+			"              ^")},
+
+		{`
+arr := [1, 2;
+`, nil, errors.New("main.dpl:2:13: неожиданный токен ;\n" +
+			"arr := [1, 2;\n" +
+			"            ^")},
+
+		{`
+x := 1 # 2;
+`, nil, errors.New("main.dpl:2:8: неожиданный символ #\n" +
+			"x := 1 # 2;\n" +
+			"       ^")},
 	}
 
 	for _, test := range tests {
@@ -68,6 +416,90 @@ len(arr);
 	}
 }
 
+func Test_ExecWithLoader(t *testing.T) {
+	fsys := fstest.MapFS{
+		"lib/math.dpl": {Data: []byte(`
+import "util.dpl" as util
+export square := (x) -> { return x * x }
+export [min, max] := [0, 100]
+export clamp := (x) -> { return util.between(x, min, max) }
+hidden := 1
+`)},
+		"lib/util.dpl": {Data: []byte(`
+loaded()
+export between := (x, a, b) -> {
+	if x < a { return a }
+	if x > b { return b }
+	return x
+}
+export version := 1
+version = 2
+`)},
+		"a.dpl":   {Data: []byte(`import "b.dpl" as b`)},
+		"b.dpl":   {Data: []byte(`import "a.dpl" as a`)},
+		"bad.dpl": {Data: []byte("x := 1\ny := x / 0\n")},
+	}
+
+	tests := []struct {
+		program       string
+		expectedValue value.Value
+		expectedError error
+	}{
+		{`
+import "lib/math.dpl" as math
+import "lib/util.dpl" as util
+[math.square(3), math.clamp(150), util.version, math.hidden]
+`, value.Array(value.Int(9), value.Int(100), value.Int(2), value.Null()), nil},
+
+		{`import "a.dpl" as a`, nil, errors.New(
+			"b.dpl:1:1: циклический импорт: a.dpl -> b.dpl -> a.dpl\n" +
+				"import \"a.dpl\" as a\n" +
+				"^")},
+		{`import "bad.dpl" as bad`, nil, errors.New(
+			"bad.dpl:2:6: деление на ноль\n" +
+				"y := x / 0\n" +
+				"     ^")},
+		{`import "none.dpl" as none`, nil, errors.New(
+			"main.dpl:1:1: не удалось загрузить модуль none.dpl: open none.dpl: file does not exist\n" +
+				"import \"none.dpl\" as none\n" +
+				"^")},
+		{`
+try {
+	import "bad.dpl" as bad
+} catch e {
+	e
+}
+`, nil, errors.New(
+			"main.dpl:3:2: import может использоваться только на верхнем уровне модуля\n" +
+				"\timport \"bad.dpl\" as bad\n" +
+				"\t^")},
+	}
+
+	for _, test := range tests {
+		loaded := 0
+		v, err := ExecWithLoader(DefaultFilename, test.program, map[string]value.Value{
+			"loaded": value.Function(func(...value.Value) (value.Value, error) {
+				loaded++
+				return value.Null(), nil
+			}),
+		}, FSLoader(fsys))
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+			//модуль, импортированный дважды, выполняется один раз
+			assert.Equal(t, 1, loaded)
+		}
+	}
+
+	_, err := Exec(`import "lib/math.dpl" as math`, nil)
+	assert.EqualError(t, err, "main.dpl:1:1: загрузчик модулей не задан\n"+
+		"import \"lib/math.dpl\" as math\n"+
+		"^")
+}
+
 func Test_builtinLen(t *testing.T) {
 	tests := []struct {
 		args          []value.Value
@@ -131,3 +563,582 @@ func Test_builtinAppend(t *testing.T) {
 		}
 	}
 }
+
+func Test_builtinError(t *testing.T) {
+	tests := []struct {
+		args          []value.Value
+		expectedValue value.Value
+		expectedError error
+	}{
+		{nil, nil, errors.New("error: требуется сообщение")},
+
+		{[]value.Value{value.Text("нет файла")},
+			value.Error("нет файла", value.ErrorKind, 0, 0), nil},
+		{[]value.Value{value.Text("нет файла"), value.Text("io")},
+			value.Error("нет файла", "io", 0, 0), nil},
+	}
+
+	for _, test := range tests {
+		v, err := builtinError(test.args...)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_Check(t *testing.T) {
+	tests := []struct {
+		program        string
+		expectedErrors []string
+	}{
+		{`
+a := 1;
+a + 2;
+`, []string{}},
+
+		{`
+a := ;
+if a { b := ) };
+c := 3;
+`, []string{
+			"main.dpl:2:6: неожиданный токен ;\n" +
+				"a := ;\n" +
+				"     ^",
+			"main.dpl:3:13: неожиданный токен )\n" +
+				"if a { b := ) };\n" +
+				"            ^",
+		}},
+
+		{`
+a := "текст;
+`, []string{
+			"main.dpl:2:6: ожидался символ \"\n" +
+				"a := \"текст;\n" +
+				"     ^",
+		}},
+
+		{`
+a := 1;
+a := 2;
+`, []string{
+			"main.dpl:3:1: переменная с именем a уже существует\n" +
+				"a := 2;\n" +
+				"^",
+		}},
+
+		{`
+if false { a := 1; a := 2; };
+`, []string{
+			"main.dpl:2:20: переменная с именем a уже существует\n" +
+				"if false { a := 1; a := 2; };\n" +
+				"                   ^",
+		}},
+	}
+
+	for _, test := range tests {
+		errs := Check(test.program)
+
+		messages := make([]string, 0, len(errs))
+		for _, err := range errs {
+			messages = append(messages, err.Error())
+		}
+		assert.Equal(t, test.expectedErrors, messages)
+	}
+}
+
+func Test_Format(t *testing.T) {
+	v, err := Format("f:=(x)->{return x*2}\nf(2)")
+	assert.NoError(t, err)
+	assert.Equal(t, "f := (x) -> {\n\treturn x * 2\n}\nf(2)\n", v)
+
+	_, err = Format("a := ;")
+	assert.EqualError(t, err, "main.dpl:1:6: неожиданный токен ;\n"+
+		"a := ;\n"+
+		"     ^")
+}
+
+func Test_Parse(t *testing.T) {
+	tree, err := Parse("total := 0\nfor i in 3 {\n\ttotal += i\n}")
+	assert.NoError(t, err)
+
+	//все использования переменной total
+	var spans []ast.Span
+	ast.Inspect(tree, func(n ast.Node) bool {
+		if id, ok := n.(*ast.Ident); ok && id.Name == "total" {
+			spans = append(spans, id.Span())
+		}
+		return true
+	})
+	assert.Equal(t, []ast.Span{
+		{Start: ast.Pos{Line: 1, Column: 1}, End: ast.Pos{Line: 1, Column: 6, Offset: 5}},
+		{Start: ast.Pos{Line: 3, Column: 2, Offset: 25}, End: ast.Pos{Line: 3, Column: 7, Offset: 30}},
+	}, spans)
+
+	_, err = Parse("a := ;")
+	assert.EqualError(t, err, "main.dpl:1:6: неожиданный токен ;\n"+
+		"a := ;\n"+
+		"     ^")
+
+	//измененное дерево выполняется
+	ast.Inspect(tree, func(n ast.Node) bool {
+		if n, ok := n.(*ast.Int); ok && n.Value == 3 {
+			n.Value = 5
+		}
+		return true
+	})
+	p, err := CompileTree(DefaultFilename, tree)
+	assert.NoError(t, err)
+	v, err := p.Run(context.Background(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, Int(10), v)
+
+	tree, err = Parse("a := 1\na := 2")
+	assert.NoError(t, err)
+	_, err = CompileTree("tree.dpl", tree)
+	var se *SyntaxError
+	assert.ErrorAs(t, err, &se)
+	assert.EqualError(t, err, "tree.dpl:2:1: переменная с именем a уже существует")
+
+	//неправильное дерево не компилируется
+	tree, err = Parse("while true {\n\tx := 1\n\tx += 2\n}")
+	assert.NoError(t, err)
+	ast.Inspect(tree, func(n ast.Node) bool {
+		if n, ok := n.(*ast.Compound); ok {
+			n.Op = ast.Eq
+		}
+		return true
+	})
+	_, err = CompileTree("tree.dpl", tree)
+	if assert.ErrorAs(t, err, &se) {
+		assert.Equal(t, 3, se.Line)
+		assert.Equal(t, 2, se.Column)
+	}
+	assert.EqualError(t, err, "tree.dpl:3:2: недопустимый оператор составного присваивания ==")
+
+	tree.List[0].(*ast.While).Body = nil
+	_, err = CompileTree("tree.dpl", tree)
+	assert.EqualError(t, err, "tree.dpl:1:1: нет тела while")
+}
+
+func Test_Interpreter(t *testing.T) {
+	var out strings.Builder
+	failed := errors.New("нет данных")
+
+	in := NewInterpreter()
+	in.SetOutput(&out)
+	in.SetLoader(FSLoader(fstest.MapFS{
+		"bad.dpl": {Data: []byte("x := ;")},
+	}))
+	in.Set("point", Object(map[string]Value{"x": Int(1), "y": Real(2.5)}))
+	assert.NoError(t, in.Register("sum", func(nums ...float64) float64 {
+		var s float64
+		for _, n := range nums {
+			s += n
+		}
+		return s
+	}))
+	assert.NoError(t, in.Register("load", func(name string) ([]string, error) {
+		if name == "" {
+			return nil, failed
+		}
+		return []string{name, name}, nil
+	}))
+	assert.EqualError(t, in.Register("bad", 1), "bad: int не является функцией")
+
+	v, err := in.Exec(`
+println("точка", point.x, point.y)
+[sum(point.x, point.y, "3"), load("a")]
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, Array(Real(6.5), Array(Text("a"), Text("a"))), v)
+	assert.Equal(t, "точка 1 2.5\n", out.String())
+
+	res, err := Convert[[]any](v)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{6.5, []any{"a", "a"}}, res)
+
+	//переменные программы не сохраняются между выполнениями
+	_, err = in.Exec("x := 1")
+	assert.NoError(t, err)
+	_, err = in.Exec("x := 2")
+	assert.NoError(t, err)
+
+	//объявление не скрывает встроенные функции и глобальные переменные
+	for _, program := range []string{"len := 3", "point := 1", "{x, ...sum} := point"} {
+		_, err = in.Exec(program)
+		assert.ErrorContains(t, err, "уже существует", program)
+	}
+	p, err := in.Compile("data := []")
+	assert.NoError(t, err)
+	_, err = p.Run(context.Background(), map[string]Value{"data": Int(1)})
+	assert.ErrorContains(t, err, "переменная с именем data уже существует")
+
+	_, err = in.Exec("n := 1\nload(\"\")")
+	var re *RuntimeError
+	if assert.ErrorAs(t, err, &re) {
+		assert.Equal(t, DefaultFilename, re.Filename)
+		assert.Equal(t, 2, re.Line)
+		assert.Equal(t, 1, re.Column)
+		assert.Equal(t, "нет данных", re.Message)
+		assert.Equal(t, RuntimeErrorKind, re.Kind)
+	}
+	assert.ErrorIs(t, err, failed)
+	assert.EqualError(t, err, "main.dpl:2:1: нет данных\nload(\"\")\n^")
+
+	_, err = in.Exec(`throw error("нет доступа", "access")`)
+	if assert.ErrorAs(t, err, &re) {
+		assert.Equal(t, "нет доступа", re.Message)
+		assert.Equal(t, "access", re.Kind)
+	}
+
+	_, err = in.Exec("x := (")
+	var se *SyntaxError
+	if assert.ErrorAs(t, err, &se) {
+		assert.Equal(t, DefaultFilename, se.Filename)
+		assert.Equal(t, 1, se.Line)
+		assert.Equal(t, 7, se.Column)
+	}
+
+	//синтаксическая ошибка в модуле
+	_, err = in.Exec(`import "bad.dpl" as bad`)
+	if assert.ErrorAs(t, err, &se) {
+		assert.Equal(t, "bad.dpl", se.Filename)
+		assert.Equal(t, "неожиданный токен ;", se.Message)
+	}
+	assert.False(t, errors.As(err, &re))
+}
+
+func Test_ValueOf(t *testing.T) {
+	v, err := ValueOf(map[string]any{"a": []int{1, 2}})
+	assert.NoError(t, err)
+	assert.Equal(t, Object(map[string]Value{"a": Array(Int(1), Int(2))}), v)
+
+	v, err = ValueOf(map[string]uint{"d": 4, "b": 2, "c": 3, "a": 1})
+	assert.NoError(t, err)
+	assert.Equal(t, Object(map[string]Value{"a": Int(1), "b": Int(2), "c": Int(3), "d": Int(4)}), v)
+
+	_, err = ValueOf(uint64(1 << 63))
+	assert.EqualError(t, err, "число 9223372036854775808 не помещается в int64")
+
+	n, err := Convert[int](Text("42"))
+	assert.NoError(t, err)
+	assert.Equal(t, 42, n)
+
+	x, err := Convert[any](Null())
+	assert.NoError(t, err)
+	assert.Nil(t, x)
+
+	_, err = Convert[map[string]int](Int(1))
+	assert.EqualError(t, err, "невозможно преобразовать int в map[string]int")
+
+	fn, err := Func(strings.ToUpper)
+	assert.NoError(t, err)
+	v, err = fn.Call(Text("abc"))
+	assert.NoError(t, err)
+	assert.Equal(t, Text("ABC"), v)
+}
+
+func Test_Program(t *testing.T) {
+	in := NewInterpreter()
+	in.Set("scale", Int(10))
+	in.SetLoader(FSLoader(fstest.MapFS{
+		"lib.dpl": {Data: []byte("export items := []")},
+	}))
+
+	p, err := in.Compile(`
+import "lib.dpl" as lib
+lib.items = append(lib.items, x)
+total := 0
+for i, v in data {
+	total += v * scale
+}
+[total, len(lib.items)]
+`)
+	assert.NoError(t, err)
+
+	//настройки интерпретатора после компиляции на программу не влияют
+	in.Set("scale", Int(1))
+
+	var wg sync.WaitGroup
+	results := make([]Value, 50)
+	errs := make([]error, 50)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = p.Run(context.Background(), map[string]Value{
+				"x":    Int(int64(i)),
+				"data": Array(Int(int64(i)), Int(1)),
+			})
+		}()
+	}
+	wg.Wait()
+
+	for i, v := range results {
+		assert.NoError(t, errs[i])
+		//модуль каждого выполнения свой, поэтому в lib.items один элемент
+		assert.Equal(t, Array(Int(int64(i+1)*10), Int(1)), v)
+	}
+	//модуль разобран один раз
+	assert.Len(t, p.modules, 1)
+
+	_, err = p.Run(context.Background(), nil)
+	var re *RuntimeError
+	if assert.ErrorAs(t, err, &re) {
+		assert.Equal(t, "переменной с именем x не существует", re.Message)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = p.Run(ctx, nil)
+	assert.ErrorIs(t, err, context.Canceled)
+
+	_, err = Compile("x := (")
+	var se *SyntaxError
+	assert.ErrorAs(t, err, &se)
+}
+
+func Test_Resolve(t *testing.T) {
+	var out strings.Builder
+	in := NewInterpreter()
+	in.SetOutput(&out)
+
+	//неизвестная переменная обнаруживается до выполнения,
+	//даже если функция, которая ее читает, не вызывается
+	_, err := in.Exec(`
+println("начало")
+f := () -> { return missing }
+`)
+	var re *RuntimeError
+	if assert.ErrorAs(t, err, &re) {
+		assert.Equal(t, 3, re.Line)
+		assert.Equal(t, "переменной с именем missing не существует", re.Message)
+	}
+	assert.Empty(t, out.String())
+
+	_, err = in.Compile(`
+a := 1
+if a { b := 1; b := 2 }
+`)
+	var se *SyntaxError
+	if assert.ErrorAs(t, err, &se) {
+		assert.Equal(t, 3, se.Line)
+		assert.Equal(t, "переменная с именем b уже существует", se.Message)
+	}
+
+	//функция видит переменные, объявленные после нее
+	v, err := in.Exec(`
+isEven := (n) -> { return n == 0 or isOdd(n - 1) }
+isOdd := (n) -> { return n != 0 and isEven(n - 1) }
+counter := () -> {
+	count := 0
+	return () -> {
+		count += 1
+		return count
+	}
+}
+next := counter()
+next()
+[isEven(10), isOdd(10), next(), counter()()]
+`)
+	assert.NoError(t, err)
+	assert.Equal(t, Array(Bool(true), Bool(false), Int(2), Int(1)), v)
+
+	//функция, вызванная до объявления, которое скрывает внешнюю
+	//переменную, читает и изменяет внешнюю переменную
+	tests := []struct {
+		program, expected string
+	}{
+		{`
+x := 1
+if true {
+	f := () -> { return x }
+	println(f())
+	x := 2
+	println(f())
+}
+`, "1\n2\n"},
+		{`
+if true {
+	f := () -> { return len([1]) }
+	println(f())
+	len := 3
+	println(len)
+}
+`, "1\n3\n"},
+		{`
+f := () -> { count = count + 1 }
+count := 0
+f()
+f()
+println(count)
+`, "2\n"},
+		{`
+f := () -> {
+	y = 5
+	return y
+}
+println(f())
+y := 1
+println(y, f(), y)
+`, "5\n1 5 5\n"},
+	}
+
+	for _, test := range tests {
+		out.Reset()
+		_, err := in.Exec(test.program)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expected, out.String())
+	}
+}
+
+func Test_Limits(t *testing.T) {
+	var out strings.Builder
+	in := NewInterpreter()
+	in.SetOutput(&out)
+	in.SetLimits(Limits{Steps: 10000})
+
+	//ошибка ограничения не перехватывается try
+	_, err := in.Exec(`
+try {
+	while true {}
+} catch e {
+	println("перехвачено")
+}
+`)
+	var steps *StepLimitError
+	assert.ErrorAs(t, err, &steps)
+	var re *RuntimeError
+	if assert.ErrorAs(t, err, &re) {
+		assert.Equal(t, 3, re.Line)
+		assert.Equal(t, "превышено число шагов выполнения (10000)", re.Message)
+	}
+	assert.Empty(t, out.String())
+
+	v, err := in.Exec("sum := 0\nfor i in 100 { sum += i }\nsum")
+	assert.NoError(t, err)
+	assert.Equal(t, Int(4950), v)
+
+	in.SetLimits(Limits{Depth: 100})
+	_, err = in.Exec("f := (n) -> { return f(n + 1) }\nf(0)")
+	var depth *DepthLimitError
+	assert.ErrorAs(t, err, &depth)
+
+	//функция языка, вызванная из Go, выполняется в тех же ограничениях
+	in.Set("apply", value.Function(func(args ...value.Value) (value.Value, error) {
+		return args[0].Call(args[0])
+	}))
+	in.SetLimits(Limits{Steps: 10000})
+	_, err = in.Exec("apply((f) -> { while true {} })")
+	assert.ErrorAs(t, err, &steps)
+
+	in.SetLimits(Limits{Depth: 100})
+	_, err = in.Exec("apply((f) -> { return apply(f) })")
+	assert.ErrorAs(t, err, &depth)
+
+	in.SetLimits(Limits{Timeout: 10 * time.Millisecond})
+	_, err = in.Exec("while true {}")
+	var timeout *TimeoutError
+	assert.ErrorAs(t, err, &timeout)
+
+	//выполнение прерывается отменой контекста
+	in.SetLimits(Limits{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = in.ExecContext(ctx, "while true {}")
+	var canceled *CanceledError
+	assert.ErrorAs(t, err, &canceled)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	//функция, возвращенная программой, не зависит от ограничений
+	//выполнения, которое ее создало
+	in.SetLimits(Limits{Timeout: 10 * time.Millisecond})
+	ctx, cancel = context.WithCancel(context.Background())
+	fn, err := in.ExecContext(ctx, "(n) -> { return n * 2 }")
+	assert.NoError(t, err)
+	cancel()
+	time.Sleep(20 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	results := make([]Value, 20)
+	errs := make([]error, 20)
+	for i := range results {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], errs[i] = fn.Call(Int(int64(i)))
+		}()
+	}
+	wg.Wait()
+
+	for i, v := range results {
+		assert.NoError(t, errs[i])
+		assert.Equal(t, Int(int64(i*2)), v)
+	}
+}
+
+func benchmark(b *testing.B, program string) {
+	p, err := Compile(program)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for range b.N {
+		if _, err := p.Run(context.Background(), nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_Factorial(b *testing.B) {
+	benchmark(b, `
+factorial := (n) -> {
+	if n <= 1 {
+		return 1
+	}
+	return n * factorial(n - 1)
+}
+
+sum := 0
+for i in 20 {
+	sum += factorial(i)
+}
+sum
+`)
+}
+
+func Benchmark_Loop(b *testing.B) {
+	benchmark(b, `
+sum := 0
+i := 0
+while i < 1000 {
+	if i % 3 == 0 {
+		sum += i * 2
+	} else {
+		sum -= 1
+	}
+	i += 1
+}
+for j, v in [1, 2, 3, 4, 5, 6, 7, 8, 9, 10] {
+	sum += j * v
+}
+sum
+`)
+}
+
+func Benchmark_Fib(b *testing.B) {
+	benchmark(b, `
+fib := (n) -> {
+	if n < 2 {
+		return n
+	}
+	return fib(n - 1) + fib(n - 2)
+}
+fib(15)
+`)
+}
@@ -44,6 +44,7 @@ document.querySelector("#app").innerHTML = `
 monaco.languages.register({ id: "dpl" });
 
 monaco.languages.setLanguageConfiguration("dpl", {
+  comments: { lineComment: "//", blockComment: ["/*", "*/"] },
   autoClosingPairs: [
     { open: "(", close: ")" },
     { open: "[", close: "]" },
@@ -55,15 +56,48 @@ monaco.languages.setLanguageConfiguration("dpl", {
 monaco.languages.setMonarchTokensProvider("dpl", {
   tokenizer: {
     root: [
-      [/\b(if|elif|else|for|in|return|true|false|null)\b/, "keyword"],
+      [/\/\/.*$/, "comment"],
+      [/\/\*/, "comment", "@comment"],
+      [/\b(if|elif|else|for|in|while|try|catch|finally|throw|import|export|as|return|break|continue|true|false|null)\b/, "keyword"],
       [/\b(and|or|not)\b/, "operator.logical"],
+      [/&&|\?:/, "operator.logical"],
+      [/(\+|-|\*|\/|%|\|\|)=/, "operator.assignment"],
       [/[+\-*\/%]|\|\|/, "operator.arithmetic"],
       [/==|!=|<|>|<=|>=/, "operator.comparison"],
       [/:?=|=/, "operator.assignment"],
       [/[\(\)\[\]\{\}]|;|,|\.|->/, "delimiter"],
       [/[a-zA-Z_][a-zA-Z0-9_]*/, "identifier"],
-      [/\d+\.\d*|\.\d+|\d+/, "number"],
-      [/"[^"]*"/, "string"],
+      [/0[xX][\da-fA-F_]+|0[oO][0-7_]+|0[bB][01_]+/, "number"],
+      [/(\d[\d_]*\.?[\d_]*|\.\d[\d_]*)([eE][+-]?\d[\d_]*)?/, "number"],
+      [/"""/, "string", "@multilineString"],
+      [/"/, "string", "@string"],
+      [/`/, "string", "@rawString"],
+    ],
+    string: [
+      [/\$\{/, "delimiter", "@interpolation"],
+      [/\\./, "string.escape"],
+      [/"/, "string", "@pop"],
+      [/[^"\\$]+/, "string"],
+      [/\$/, "string"],
+    ],
+    interpolation: [
+      [/\}/, "delimiter", "@pop"],
+      { include: "root" },
+    ],
+    multilineString: [
+      [/\\./, "string.escape"],
+      [/"""/, "string", "@pop"],
+      [/./, "string"],
+    ],
+    rawString: [
+      [/[^`]+/, "string"],
+      [/`/, "string", "@pop"],
+    ],
+    comment: [
+      [/[^\/*]+/, "comment"],
+      [/\/\*/, "comment", "@push"],
+      [/\*\//, "comment", "@pop"],
+      [/[\/*]/, "comment"],
     ],
   },
 });
@@ -81,6 +115,7 @@ monaco.editor.defineTheme("dpl", {
     { token: "identifier", foreground: "#000000" },
     { token: "number", foreground: "#6a1b9a" },
     { token: "string", foreground: "#c62828" },
+    { token: "comment", foreground: "#8a8a8a", fontStyle: "italic" },
   ],
   colors: {
     "editor.background": "#f5f5f5",
@@ -88,6 +123,15 @@ monaco.editor.defineTheme("dpl", {
   },
 });
 
+// "Форматировать документ": программа с ошибкой не изменяется
+monaco.languages.registerDocumentFormattingEditProvider("dpl", {
+  provideDocumentFormattingEdits: (model) => {
+    const text = format(model.getValue());
+    if (text === null) return [];
+    return [{ range: model.getFullModelRange(), text }];
+  },
+});
+
 const editor = monaco.editor.create(document.getElementById("editor"), {
   value: `power = (base, exponent) -> {
     if exponent == 0 { return 1 };
@@ -213,10 +257,34 @@ const draw = (type, data, options) => {
   });
 };
 
+// модули для import хранятся в localStorage под ключом "dpl:" + путь
+const load = (path) => localStorage.getItem("dpl:" + path);
+
 const run = document.getElementById("run");
 
 run.onclick = () => {
   output.innerText = "";
 
-  exec(editor.getValue(), write, draw);
+  const diagnostics = exec(editor.getValue(), write, draw, load);
+
+  monaco.editor.setModelMarkers(
+    editor.getModel(),
+    "dpl",
+    diagnostics
+      .filter((d) => d.line)
+      .map((d) => {
+        const word = editor
+          .getModel()
+          .getWordAtPosition({ lineNumber: d.line, column: d.column });
+
+        return {
+          severity: monaco.MarkerSeverity.Error,
+          message: d.message,
+          startLineNumber: d.line,
+          startColumn: d.column,
+          endLineNumber: d.line,
+          endColumn: word ? word.endColumn : d.column + 1,
+        };
+      }),
+  );
 };
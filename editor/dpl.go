@@ -4,56 +4,125 @@
 package main
 
 import (
+	"errors"
 	"github.com/suprunchuksergey/dpl"
-	"github.com/suprunchuksergey/dpl/internal/value"
 	"strings"
 	"syscall/js"
+	"time"
 )
 
 func exec(_ js.Value, args []js.Value) any {
 	program := args[0].String()
 	output := args[1]
 	draw := args[2]
+	load := args[3]
 
-	m := map[string]value.Value{
-		"draw": value.Function(func(args ...value.Value) (value.Value, error) {
-			draw.Invoke(
-				js.ValueOf(args[0].Value()),
-				js.ValueOf(args[1].Value()),
-				js.ValueOf(args[2].Value()),
-			)
-			return value.Null(), nil
-		}),
-
-		"print": value.Function(func(args ...value.Value) (value.Value, error) {
-			var str strings.Builder
-			for _, arg := range args {
-				str.WriteString(arg.String())
-			}
-			output.Invoke(js.ValueOf(str.String()))
-			return value.Null(), nil
-		}),
-
-		"println": value.Function(func(args ...value.Value) (value.Value, error) {
-			var str strings.Builder
-			for _, arg := range args {
-				str.WriteString(arg.String())
-			}
-			str.WriteRune('\n')
-			output.Invoke(js.ValueOf(str.String()))
-			return value.Null(), nil
-		}),
+	in := dpl.NewInterpreter()
+	in.SetLoader(loader(load))
+	//бесконечный цикл или рекурсия не должны подвешивать вкладку
+	in.SetLimits(dpl.Limits{Timeout: 5 * time.Second})
+
+	in.Set("draw", dpl.Function(func(args ...dpl.Value) (dpl.Value, error) {
+		draw.Invoke(
+			js.ValueOf(args[0].Value()),
+			js.ValueOf(args[1].Value()),
+			js.ValueOf(args[2].Value()),
+		)
+		return dpl.Null(), nil
+	}))
+
+	in.Set("print", dpl.Function(func(args ...dpl.Value) (dpl.Value, error) {
+		var str strings.Builder
+		for _, arg := range args {
+			str.WriteString(arg.String())
+		}
+		output.Invoke(js.ValueOf(str.String()))
+		return dpl.Null(), nil
+	}))
+
+	in.Set("println", dpl.Function(func(args ...dpl.Value) (dpl.Value, error) {
+		var str strings.Builder
+		for _, arg := range args {
+			str.WriteString(arg.String())
+		}
+		str.WriteRune('\n')
+		output.Invoke(js.ValueOf(str.String()))
+		return dpl.Null(), nil
+	}))
+
+	errs := dpl.Check(program)
+	if len(errs) == 0 {
+		_, err := in.Exec(program)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	diagnostics := make([]any, 0, len(errs))
+	for _, err := range errs {
+		output.Invoke(js.ValueOf("ошибка: " + err.Error() + "\n"))
+		diagnostics = append(diagnostics, diagnostic(err))
 	}
 
-	_, err := dpl.Exec(program, m)
+	return js.ValueOf(diagnostics)
+}
+
+// форматирует программу; возвращает null, если в программе синтаксическая ошибка
+func format(_ js.Value, args []js.Value) any {
+	res, err := dpl.Format(args[0].String())
 	if err != nil {
-		output.Invoke(js.ValueOf("ошибка: " + err.Error()))
+		return js.Null()
+	}
+	return js.ValueOf(res)
+}
+
+// загрузчик модулей через функцию редактора load(path),
+// которая возвращает исходный код модуля или null, если модуля нет
+func loader(load js.Value) dpl.Loader {
+	if load.Type() != js.TypeFunction {
+		return nil
+	}
+
+	return dpl.LoaderFunc(func(path string) (string, error) {
+		source := load.Invoke(path)
+		if source.Type() != js.TypeString {
+			return "", errors.New("модуль не найден")
+		}
+		return source.String(), nil
+	})
+}
+
+// описание ошибки для подсветки в редакторе
+func diagnostic(err error) map[string]any {
+	d := map[string]any{"message": err.Error()}
+
+	var filename, message string
+	var line, column int
+
+	var se *dpl.SyntaxError
+	var re *dpl.RuntimeError
+	switch {
+	case errors.As(err, &se):
+		filename, message, line, column = se.Filename, se.Message, se.Line, se.Column
+	case errors.As(err, &re):
+		filename, message, line, column = re.Filename, re.Message, re.Line, re.Column
+	default:
+		return d
+	}
+
+	//ошибки в импортированных модулях и ошибки без позиции не подсвечиваются
+	if filename != dpl.DefaultFilename || line == 0 {
+		return d
 	}
 
-	return js.Undefined()
+	d["message"] = message
+	d["line"] = line
+	d["column"] = column
+	return d
 }
 
 func main() {
 	js.Global().Set("exec", js.FuncOf(exec))
+	js.Global().Set("format", js.FuncOf(format))
 	<-make(chan struct{})
 }
@@ -0,0 +1,268 @@
+package compile
+
+import (
+	"fmt"
+	"github.com/suprunchuksergey/dpl/ast"
+	"github.com/suprunchuksergey/dpl/internal/node"
+	"github.com/suprunchuksergey/dpl/internal/pos"
+	"reflect"
+)
+
+// бинарные операторы
+var binaryOps = map[ast.Op]func(a, b node.Node) node.Node{
+	ast.Add:      node.Add,
+	ast.Sub:      node.Sub,
+	ast.Mul:      node.Mul,
+	ast.Div:      node.Div,
+	ast.Mod:      node.Mod,
+	ast.Concat:   node.Concat,
+	ast.Eq:       node.Eq,
+	ast.Neq:      node.Neq,
+	ast.Lt:       node.Lt,
+	ast.Gt:       node.Gt,
+	ast.Lte:      node.Lte,
+	ast.Gte:      node.Gte,
+	ast.And:      node.And,
+	ast.Or:       node.Or,
+	ast.AndValue: node.AndValue,
+	ast.OrValue:  node.OrValue,
+}
+
+// операторы составного присваивания
+var compoundOps = map[ast.Op]bool{
+	ast.Add:    true,
+	ast.Sub:    true,
+	ast.Mul:    true,
+	ast.Div:    true,
+	ast.Mod:    true,
+	ast.Concat: true,
+}
+
+// проверяет дерево, построенное не парсером: Compile ожидает,
+// что у конструкций есть тела, а операторы допустимы для своих узлов.
+// Ошибка привязана к началу участка неправильного узла
+func Check(n ast.Node) error {
+	var err error
+	ast.Inspect(n, func(n ast.Node) bool {
+		if err != nil || n == nil {
+			return false
+		}
+		if err = check(n); err != nil {
+			err = pos.Wrap(err, n.Span().Start)
+		}
+		return err == nil
+	})
+	return err
+}
+
+func check(n ast.Node) error {
+	switch n := n.(type) {
+	case *ast.Function:
+		return body("функции", n.Body)
+	case *ast.For:
+		return body("for", n.Body)
+	case *ast.While:
+		return body("while", n.Body)
+	case *ast.If:
+		for _, branch := range n.Branches {
+			if err := body("if", branch.Body); err != nil {
+				return err
+			}
+		}
+	case *ast.Try:
+		return body("try", n.Body)
+
+	case *ast.Binary:
+		if _, ok := binaryOps[n.Op]; !ok {
+			return fmt.Errorf("недопустимый бинарный оператор %s", opName(n.Op))
+		}
+	case *ast.Unary:
+		if n.Op != ast.Neg && n.Op != ast.Not {
+			return fmt.Errorf("недопустимый унарный оператор %s", opName(n.Op))
+		}
+	case *ast.Compound:
+		if !compoundOps[n.Op] {
+			return fmt.Errorf("недопустимый оператор составного присваивания %s", opName(n.Op))
+		}
+	}
+	return nil
+}
+
+func body(construct string, b *ast.Block) error {
+	if b == nil {
+		return fmt.Errorf("нет тела %s", construct)
+	}
+	return nil
+}
+
+// имя оператора в тексте ошибки; у неизвестного оператора - номер
+func opName(op ast.Op) string {
+	if s := op.String(); s != "" && s != "?" {
+		return s
+	}
+	return fmt.Sprintf("#%d", op)
+}
+
+func list(nodes []ast.Node) []node.Node {
+	if nodes == nil {
+		return nil
+	}
+
+	res := make([]node.Node, 0, len(nodes))
+	for _, n := range nodes {
+		res = append(res, Compile(n))
+	}
+	return res
+}
+
+// блок без участка исходного кода: ошибки конструкций блока
+// привязываются к самим конструкциям
+func block(n *ast.Block) node.Node { return node.Block(list(n.List)...) }
+
+// необязательный блок; nil, если блока нет
+func optional(n *ast.Block) node.Node {
+	if n == nil {
+		return nil
+	}
+	return block(n)
+}
+
+// строит из синтаксического дерева дерево для выполнения;
+// узлы с известным участком исходного кода привязываются к нему,
+// чтобы ошибки выполнения содержали позицию. Дерево, построенное
+// не парсером, нужно предварительно проверить (Check)
+func Compile(n ast.Node) node.Node {
+	if n == nil || reflect.ValueOf(n).IsNil() {
+		return nil
+	}
+
+	if n, ok := n.(*ast.Block); ok {
+		return block(n)
+	}
+
+	res := compile(n)
+	if span := n.Span(); span != (ast.Span{}) {
+		return node.At(span, res)
+	}
+	return res
+}
+
+func compile(n ast.Node) node.Node {
+	switch n := n.(type) {
+	case *ast.Null:
+		return node.Null()
+	case *ast.Bool:
+		return node.Bool(n.Value)
+	case *ast.Int:
+		return node.Int(n.Value)
+	case *ast.Real:
+		return node.Real(n.Value)
+	case *ast.Text:
+		return node.Text(n.Value)
+	case *ast.Interpolation:
+		return node.Interpolation(list(n.Parts)...)
+	case *ast.Array:
+		return node.Array(list(n.Elems)...)
+	case *ast.Object:
+		var pairs []node.KV
+		if n.Pairs != nil {
+			pairs = make([]node.KV, 0, len(n.Pairs))
+		}
+		for _, pair := range n.Pairs {
+			pairs = append(pairs, node.KV{Key: Compile(pair.Key), Value: Compile(pair.Value)})
+		}
+		return node.Object(pairs...)
+	case *ast.Function:
+		return node.VariadicFunction(block(n.Body), Compile(n.Rest), list(n.Params)...)
+
+	case *ast.Ident:
+		return node.Ident(n.Name)
+	case *ast.Binary:
+		op, ok := binaryOps[n.Op]
+		if !ok {
+			panic("неизвестный оператор " + n.Op.String())
+		}
+		return op(Compile(n.X), Compile(n.Y))
+	case *ast.Unary:
+		switch n.Op {
+		case ast.Neg:
+			return node.Neg(Compile(n.X))
+		case ast.Not:
+			return node.Not(Compile(n.X))
+		default:
+			panic("неизвестный оператор " + n.Op.String())
+		}
+	case *ast.Index:
+		return node.ElByIndex(Compile(n.X), Compile(n.Index))
+	case *ast.Slice:
+		return node.Slice(Compile(n.Start), Compile(n.End), Compile(n.Step))
+	case *ast.Member:
+		return node.Member(Compile(n.X), n.Name)
+	case *ast.Call:
+		return node.Call(Compile(n.Fn), list(n.Args)...)
+	case *ast.Spread:
+		return node.Spread(Compile(n.X))
+	case *ast.Named:
+		return node.Named(n.Name, Compile(n.Value))
+
+	case *ast.Default:
+		return node.Default(Compile(n.Target), Compile(n.Value))
+	case *ast.ArrayPattern:
+		return node.ArrayPattern(Compile(n.Rest), list(n.Elems)...)
+	case *ast.ObjectPattern:
+		var props []node.Prop
+		if n.Props != nil {
+			props = make([]node.Prop, 0, len(n.Props))
+		}
+		for _, prop := range n.Props {
+			props = append(props, node.Prop{Key: prop.Key, Target: Compile(prop.Target)})
+		}
+		return node.ObjectPattern(Compile(n.Rest), props...)
+
+	case *ast.Create:
+		return node.Create(Compile(n.Target), Compile(n.Value))
+	case *ast.Set:
+		return node.Set(Compile(n.Target), Compile(n.Value))
+	case *ast.Compound:
+		return node.Compound(n.Op.String(), Compile(n.Target), Compile(n.Value))
+
+	case *ast.If:
+		branches := make([]node.Branch, 0, len(n.Branches)+1)
+		for _, branch := range n.Branches {
+			branches = append(branches, node.Branch{Cond: Compile(branch.Cond), Body: block(branch.Body)})
+		}
+		if n.Else != nil {
+			branches = append(branches, node.Branch{Cond: node.Bool(true), Body: block(n.Else)})
+		}
+		return node.If(branches...)
+	case *ast.For:
+		loop := node.For(list(n.Targets), Compile(n.From), block(n.Body))
+		if n.Label != "" {
+			return node.Labeled(n.Label, loop)
+		}
+		return loop
+	case *ast.While:
+		loop := node.While(Compile(n.Cond), block(n.Body))
+		if n.Label != "" {
+			return node.Labeled(n.Label, loop)
+		}
+		return loop
+	case *ast.Return:
+		return node.Return(Compile(n.Value))
+	case *ast.Break:
+		return node.Break(n.Label)
+	case *ast.Continue:
+		return node.Continue(n.Label)
+	case *ast.Try:
+		return node.Try(block(n.Body), n.Name, optional(n.Catch), optional(n.Finally))
+	case *ast.Throw:
+		return node.Throw(Compile(n.Value))
+	case *ast.Import:
+		return node.Import(n.Path, n.Name)
+	case *ast.Export:
+		return node.Export(Compile(n.Target), Compile(n.Value))
+
+	default:
+		panic("неизвестный узел " + reflect.TypeOf(n).String())
+	}
+}
@@ -0,0 +1,138 @@
+package compile
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/suprunchuksergey/dpl/ast"
+	"github.com/suprunchuksergey/dpl/internal/namespace"
+	"github.com/suprunchuksergey/dpl/internal/node"
+	"github.com/suprunchuksergey/dpl/internal/pos"
+	"github.com/suprunchuksergey/dpl/internal/value"
+	"testing"
+)
+
+func Test_Compile(t *testing.T) {
+	tests := []struct {
+		n             ast.Node
+		expectedValue node.Node
+	}{
+		{nil, nil},
+		{(*ast.Block)(nil), nil},
+		{&ast.Binary{Op: ast.Add, X: &ast.Int{Value: 1}, Y: &ast.Real{Value: 2.5}},
+			node.Add(node.Int(1), node.Real(2.5))},
+		{&ast.Unary{Op: ast.Not, X: &ast.Bool{Value: true}}, node.Not(node.Bool(true))},
+		{&ast.Index{X: &ast.Ident{Name: "a"}, Index: &ast.Slice{Start: &ast.Int{Value: 1}}},
+			node.ElByIndex(node.Ident("a"), node.Slice(node.Int(1), nil, nil))},
+		{&ast.Object{Pairs: []ast.Pair{
+			{Key: &ast.Text{Value: "a"}, Value: &ast.Null{}},
+			{Value: &ast.Spread{X: &ast.Ident{Name: "b"}}},
+		}}, node.Object(
+			node.KV{Key: node.Text("a"), Value: node.Null()},
+			node.KV{Value: node.Spread(node.Ident("b"))},
+		)},
+		{&ast.Function{
+			Params: []ast.Node{&ast.Default{Target: &ast.Ident{Name: "a"}, Value: &ast.Int{Value: 1}}},
+			Rest:   &ast.Ident{Name: "rest"},
+			Body:   &ast.Block{List: []ast.Node{&ast.Return{Value: &ast.Ident{Name: "a"}}}},
+		}, node.VariadicFunction(
+			node.Block(node.Return(node.Ident("a"))),
+			node.Ident("rest"),
+			node.Default(node.Ident("a"), node.Int(1)),
+		)},
+		{&ast.Compound{Op: ast.Concat, Target: &ast.Ident{Name: "s"}, Value: &ast.Text{Value: "!"}},
+			node.Compound("||", node.Ident("s"), node.Text("!"))},
+		{&ast.If{
+			Branches: []ast.Branch{{Cond: &ast.Ident{Name: "a"}, Body: &ast.Block{}}},
+			Else:     &ast.Block{List: []ast.Node{&ast.Int{Value: 1}}},
+		}, node.If(
+			node.Branch{Cond: node.Ident("a"), Body: node.Block()},
+			node.Branch{Cond: node.Bool(true), Body: node.Block(node.Int(1))},
+		)},
+		{&ast.For{
+			Label:   "outer",
+			Targets: []ast.Node{&ast.Ident{Name: "i"}},
+			From:    &ast.Int{Value: 3},
+			Body:    &ast.Block{List: []ast.Node{&ast.Break{Label: "outer"}}},
+		}, node.Labeled("outer", node.For(
+			[]node.Node{node.Ident("i")},
+			node.Int(3),
+			node.Block(node.Break("outer")),
+		))},
+		{&ast.Try{Body: &ast.Block{}, Finally: &ast.Block{}},
+			node.Try(node.Block(), "", nil, node.Block())},
+		{&ast.ObjectPattern{Props: []ast.Prop{{Key: "x", Target: &ast.Ident{Name: "y"}}}},
+			node.ObjectPattern(nil, node.Prop{Key: "x", Target: node.Ident("y")})},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedValue, Compile(test.n))
+	}
+}
+
+func Test_Compile_Span(t *testing.T) {
+	span := pos.Span{
+		Start: pos.Pos{Line: 2, Column: 3, Offset: 4},
+		End:   pos.Pos{Line: 2, Column: 8, Offset: 9},
+	}
+
+	div := &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 1}, Y: &ast.Int{Value: 0}}
+	ast.SetSpan(div, span)
+
+	//блоки к участку не привязываются
+	block := &ast.Block{List: []ast.Node{div}}
+	ast.SetSpan(block, pos.Span{End: pos.Pos{Line: 3, Column: 1, Offset: 10}})
+
+	n := Compile(block)
+	assert.Equal(t, node.Block(node.At(span, node.Div(node.Int(1), node.Int(0)))), n)
+
+	code, err := node.Compile(n)
+	assert.NoError(t, err)
+	_, err = code.Run(namespace.New(map[string]value.Value{}), nil)
+	var e *pos.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, span.Start, e.Pos)
+	}
+}
+
+func Test_Check(t *testing.T) {
+	at := pos.Pos{Line: 2, Column: 3, Offset: 4}
+	spanned := func(n ast.Node) ast.Node {
+		ast.SetSpan(n, pos.Span{Start: at, End: at})
+		return n
+	}
+	one := &ast.Int{Value: 1}
+
+	tests := []struct {
+		n             ast.Node
+		expectedError error
+	}{
+		{nil, nil},
+		{&ast.Block{List: []ast.Node{
+			&ast.Try{Body: &ast.Block{}},
+			&ast.If{Branches: []ast.Branch{{Cond: one, Body: &ast.Block{}}}},
+			&ast.Compound{Op: ast.Mod, Target: &ast.Ident{Name: "a"}, Value: one},
+		}}, nil},
+		{spanned(&ast.Function{}), &pos.Error{Pos: at, Err: errors.New("нет тела функции")}},
+		{spanned(&ast.While{Cond: one}), &pos.Error{Pos: at, Err: errors.New("нет тела while")}},
+		{spanned(&ast.For{From: one}), &pos.Error{Pos: at, Err: errors.New("нет тела for")}},
+		{spanned(&ast.If{Branches: []ast.Branch{{Cond: one}}}),
+			&pos.Error{Pos: at, Err: errors.New("нет тела if")}},
+		{spanned(&ast.Try{Catch: &ast.Block{}}), &pos.Error{Pos: at, Err: errors.New("нет тела try")}},
+		//ошибка вложенного узла привязана к нему
+		{&ast.Block{List: []ast.Node{&ast.While{Cond: one, Body: &ast.Block{List: []ast.Node{
+			spanned(&ast.Compound{Op: ast.Eq, Target: &ast.Ident{Name: "a"}, Value: one}),
+		}}}}}, &pos.Error{Pos: at, Err: errors.New("недопустимый оператор составного присваивания ==")}},
+		{spanned(&ast.Binary{X: one, Y: one}),
+			&pos.Error{Pos: at, Err: errors.New("недопустимый бинарный оператор #0")}},
+		{spanned(&ast.Binary{Op: ast.Not, X: one, Y: one}),
+			&pos.Error{Pos: at, Err: errors.New("недопустимый бинарный оператор not")}},
+		{spanned(&ast.Unary{Op: 200, X: one}),
+			&pos.Error{Pos: at, Err: errors.New("недопустимый унарный оператор #200")}},
+		//без участка ошибка не содержит позиции
+		{&ast.Unary{Op: ast.Add, X: one}, errors.New("недопустимый унарный оператор +")},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedError, Check(test.n))
+	}
+}
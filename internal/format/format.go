@@ -0,0 +1,393 @@
+package format
+
+import (
+	"github.com/suprunchuksergey/dpl/internal/lexer"
+	"github.com/suprunchuksergey/dpl/internal/parser"
+	"strings"
+)
+
+// виды скобок
+const (
+	block  = iota // { } блока
+	object        // { } литерала объекта
+	paren         // ( )
+	brack         // [ ] массива
+	index         // [ ] индекса или среза
+	interp        // ${ } подстановки
+)
+
+type frame struct {
+	kind int
+	//элементы записываются по одному на строке
+	multiline bool
+	//встречалась ли запятая между элементами
+	commas bool
+	//текущий элемент развертывается (...x)
+	spread bool
+}
+
+type printer struct {
+	src    string
+	tokens []lexer.Token
+	out    strings.Builder
+
+	stack []frame
+	//уровень отступа
+	indent int
+	//ничего не записано в текущую строку
+	lineStart bool
+	//после комментария в конце строки нужен перевод строки
+	needNewline bool
+	//строка исходного кода, на которой закончился последний записанный токен
+	lastLine int
+
+	//последний записанный токен, не являющийся комментарием
+	prev lexer.Token
+	//последний записанный токен - унарный минус
+	unary bool
+	//записывается закрывающая скобка блока
+	blockEnd bool
+}
+
+// исходный текст токена
+func (p *printer) text(tok lexer.Token) string {
+	return p.src[tok.Pos().Offset:tok.End().Offset]
+}
+
+func (p *printer) top() frame {
+	if len(p.stack) == 0 {
+		return frame{kind: block}
+	}
+	return p.stack[len(p.stack)-1]
+}
+
+// индекс следующего токена после i, не являющегося комментарием
+func (p *printer) next(i int) int {
+	for i++; p.tokens[i].ID() == lexer.Comment; i++ {
+	}
+	return i
+}
+
+func (p *printer) newline() {
+	if !p.lineStart {
+		p.out.WriteByte('\n')
+		p.lineStart = true
+	}
+	p.needNewline = false
+}
+
+func (p *printer) write(tok lexer.Token, text string, space bool) {
+	if p.needNewline {
+		p.newline()
+	}
+
+	if p.lineStart {
+		//одна пустая строка сохраняется, если была в исходном коде
+		if p.out.Len() != 0 && !isClosing(tok.ID()) && tok.Pos().Line-p.lastLine >= 2 {
+			p.out.WriteByte('\n')
+		}
+
+		indent := p.indent
+		//перенос строки внутри однострочных скобок; блок внутри них
+		//закрывается на уровне строки, на которой он начался
+		if top := p.top(); top.kind != block && !top.multiline && !p.blockEnd {
+			indent++
+		}
+		p.out.WriteString(strings.Repeat("\t", indent))
+		p.lineStart = false
+	} else if space {
+		p.out.WriteByte(' ')
+	}
+
+	p.out.WriteString(text)
+	p.lastLine = tok.End().Line
+}
+
+// нужен ли пробел между предыдущим токеном и tok
+func (p *printer) space(tok lexer.Token) bool {
+	if p.prev == nil {
+		return false
+	}
+	prev, cur := p.prev.ID(), tok.ID()
+	top := p.top()
+
+	switch cur {
+	case lexer.Dot:
+		//1.b читается как число 1. и имя b
+		return prev == lexer.Int
+	case lexer.Comma, lexer.RParen, lexer.RBrack, lexer.Semicolon,
+		lexer.InterpMid, lexer.InterpEnd, lexer.Colon:
+		return false
+	case lexer.RBrace:
+		return top.kind == block
+	case lexer.LParen, lexer.LBrack:
+		//вызов и индекс
+		if lexer.EndsConstruction(prev) {
+			return false
+		}
+	}
+
+	switch prev {
+	case lexer.LParen, lexer.LBrack, lexer.Dot, lexer.Ellipsis,
+		lexer.InterpStart, lexer.InterpMid:
+		return false
+	case lexer.LBrace:
+		return top.kind == block
+	case lexer.Colon:
+		//срез a[start:end]
+		return top.kind != index
+	case lexer.Sub:
+		//- -x
+		return !p.unary || cur == lexer.Sub
+	}
+
+	return true
+}
+
+// вид открывающей скобки
+func (p *printer) kind(tok lexer.Token) int {
+	switch tok.ID() {
+	case lexer.LBrace:
+		//в начале конструкции { - шаблон объекта, а не блок
+		if p.prev == nil || p.prev.ID() == lexer.Semicolon {
+			return object
+		}
+		if lexer.OpensBlock(p.prev) {
+			return block
+		}
+		return object
+	case lexer.LParen:
+		return paren
+	case lexer.LBrack:
+		if p.prev != nil && lexer.EndsConstruction(p.prev.ID()) {
+			return index
+		}
+		return brack
+	default:
+		return interp
+	}
+}
+
+// нужна ли запятая после последнего элемента многострочных скобок
+func trailingComma(f frame) bool {
+	//после ...rest в шаблоне и параметрах запятая недопустима
+	if f.spread {
+		return false
+	}
+
+	switch f.kind {
+	case object, brack:
+		return true
+	case paren:
+		//в скобках без запятых - выражение, а не список
+		return f.commas
+	default:
+		return false
+	}
+}
+
+// записывает комментарии, которые в исходном коде стоят
+// на той же строке после последнего записанного токена;
+// возвращает индекс последнего записанного комментария
+func (p *printer) trailingComments(i int) int {
+	for i+1 < len(p.tokens) {
+		tok := p.tokens[i+1]
+		if tok.ID() != lexer.Comment || tok.Pos().Line != p.lastLine {
+			break
+		}
+		i++
+		p.comment(i)
+	}
+	return i
+}
+
+func (p *printer) comment(i int) {
+	tok := p.tokens[i]
+	text := p.text(tok)
+
+	if tok.Pos().Line == p.lastLine && !p.lineStart {
+		p.write(tok, text, true)
+	} else {
+		p.newline()
+		p.write(tok, text, false)
+	}
+
+	//после комментария, которым заканчивается строка исходного кода,
+	//следующий токен записывается с новой строки
+	if strings.HasPrefix(text, "//") || p.tokens[i+1].Pos().Line > tok.End().Line {
+		p.needNewline = true
+	}
+}
+
+func (p *printer) print() {
+	p.lineStart = true
+
+	for i := 0; i < len(p.tokens); i++ {
+		tok := p.tokens[i]
+
+		switch tok.ID() {
+		case lexer.EOF:
+			continue
+
+		case lexer.Comment:
+			p.comment(i)
+			continue
+
+		case lexer.Semicolon:
+			//конструкции разделяются переводом строки
+			i = p.trailingComments(i)
+			p.newline()
+
+			p.prev = tok
+			p.unary = false
+			continue
+
+		case lexer.Comma:
+			n := p.tokens[p.next(i)]
+			top := p.top()
+
+			//запятая после последнего элемента нужна
+			//только в многострочных скобках
+			if isClosing(n.ID()) {
+				if top.multiline && trailingComma(top) {
+					p.write(tok, ",", false)
+				}
+				p.prev = tok
+				continue
+			}
+
+			p.write(tok, ",", false)
+			if len(p.stack) != 0 {
+				p.stack[len(p.stack)-1].commas = true
+				p.stack[len(p.stack)-1].spread = false
+			}
+			//запятые между получателями for и в блоке
+			//строку не разделяют
+			if top.multiline && top.kind != block {
+				i = p.trailingComments(i)
+				p.newline()
+			}
+
+			p.prev = tok
+			p.unary = false
+			continue
+		}
+
+		if isClosing(tok.ID()) {
+			p.close(tok)
+		} else {
+			i = p.open(i, tok)
+		}
+
+		if tok.ID() == lexer.Ellipsis && p.prev.ID() != lexer.Ellipsis && len(p.stack) != 0 {
+			top := &p.stack[len(p.stack)-1]
+			top.spread = top.spread || p.prev.ID() == lexer.Comma || isOpening(p.prev.ID())
+		}
+
+		p.unary = tok.ID() == lexer.Sub &&
+			(p.prev == nil || !lexer.EndsConstruction(p.prev.ID()))
+		p.prev = tok
+
+		//запятая после последнего элемента многострочных скобок,
+		//если ее нет в исходном коде
+		n := p.next(i)
+		if top := p.top(); top.multiline &&
+			isClosing(p.tokens[n].ID()) && trailingComma(top) {
+			p.write(tok, ",", false)
+		}
+	}
+
+	p.newline()
+}
+
+func isOpening(id uint8) bool {
+	switch id {
+	case lexer.LParen, lexer.LBrack, lexer.LBrace, lexer.InterpStart:
+		return true
+	default:
+		return false
+	}
+}
+
+func isClosing(id uint8) bool {
+	switch id {
+	case lexer.RParen, lexer.RBrack, lexer.RBrace, lexer.InterpEnd:
+		return true
+	default:
+		return false
+	}
+}
+
+// записывает токен; открывающая скобка добавляется в стек;
+// возвращает индекс последнего записанного токена
+func (p *printer) open(i int, tok lexer.Token) int {
+	space := p.space(tok)
+
+	switch tok.ID() {
+	case lexer.LParen, lexer.LBrack, lexer.LBrace, lexer.InterpStart:
+	case lexer.Elif, lexer.Else, lexer.Catch, lexer.Finally:
+		p.write(tok, p.text(tok), true)
+		return i
+	default:
+		p.write(tok, p.text(tok), space)
+		return i
+	}
+
+	f := frame{kind: p.kind(tok)}
+	p.write(tok, p.text(tok), space)
+
+	n := p.tokens[p.next(i)]
+	switch f.kind {
+	case block:
+		f.multiline = true
+	case object, paren, brack:
+		f.multiline = n.Pos().Line > tok.End().Line && !isClosing(n.ID())
+	}
+
+	p.stack = append(p.stack, f)
+	if f.multiline {
+		p.indent++
+		//пустой блок записывается как {}
+		if !(f.kind == block && n.ID() == lexer.RBrace) {
+			i = p.trailingComments(i)
+			p.newline()
+		}
+	}
+	return i
+}
+
+func (p *printer) close(tok lexer.Token) {
+	f := p.top()
+	p.stack = p.stack[:len(p.stack)-1]
+
+	if f.multiline {
+		p.indent--
+		if p.prev.ID() != lexer.LBrace {
+			p.newline()
+		}
+	}
+
+	p.blockEnd = f.kind == block
+	p.write(tok, p.text(tok), false)
+	p.blockEnd = false
+}
+
+// форматирует исходный код программы: расставляет отступы, пробелы
+// и переводы строк; комментарии и пустые строки между конструкциями
+// сохраняются; скобки, после которых в исходном коде был перевод строки,
+// записываются по одному элементу на строке
+func Format(src string) (string, error) {
+	tokens, err := lexer.TokenizeWithComments(src)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := parser.Parse(tokens); err != nil {
+		return "", err
+	}
+
+	p := &printer{src: src, tokens: tokens}
+	p.print()
+
+	return strings.TrimLeft(p.out.String(), "\n"), nil
+}
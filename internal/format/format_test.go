@@ -0,0 +1,92 @@
+package format
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Format(t *testing.T) {
+	tests := []struct {
+		src           string
+		expectedValue string
+	}{
+		{"", ""},
+		{"x:=1+-2*3", "x := 1 + -2 * 3\n"},
+		{"a; b", "a\nb\n"},
+		{"x := a - -1\ny := - -b\nreturn -1", "x := a - -1\ny := - -b\nreturn -1\n"},
+		{"f ( a,b ) . c [ 1 ]", "f(a, b).c[1]\n"},
+		{"a[1 : -1 : 2]\nb[:]", "a[1:-1:2]\nb[:]\n"},
+		{`"x = ${ x+1 }, y = ${y}"`, "\"x = ${x + 1}, y = ${y}\"\n"},
+		{`x := """
+  многострочный
+"""`, "x := \"\"\"\n  многострочный\n\"\"\"\n"},
+
+		//блоки
+		{"if x>1{y}elif x<0 {z}\nelse{w}", "if x > 1 {\n\ty\n} elif x < 0 {\n\tz\n} else {\n\tw\n}\n"},
+		{"for i in [1,2] { if i == 1 { continue } }",
+			"for i in [1, 2] {\n\tif i == 1 {\n\t\tcontinue\n\t}\n}\n"},
+		{"while x < 10 { x += 1 }", "while x < 10 {\n\tx += 1\n}\n"},
+		{"f := (a,b=2,...rest)->{return a+b}", "f := (a, b = 2, ...rest) -> {\n\treturn a + b\n}\n"},
+		{"f := () -> {\n\n}", "f := () -> {}\n"},
+		{"try { throw error(\"e\") } catch e { g(e) } finally {}",
+			"try {\n\tthrow error(\"e\")\n} catch e {\n\tg(e)\n} finally {}\n"},
+		{"import \"lib.dpl\" as lib\nexport x:=lib.f()", "import \"lib.dpl\" as lib\nexport x := lib.f()\n"},
+		{"f := () -> {\nfor k,v in o { g(k,v) }\n}",
+			"f := () -> {\n\tfor k, v in o {\n\t\tg(k, v)\n\t}\n}\n"},
+
+		//литералы
+		{"x := [ 1,2, ]\ny := {a:1,b:[ ],...c}", "x := [1, 2]\ny := {a: 1, b: [], ...c}\n"},
+		{"x := {\na:1,b:[\n1, 2]}", "x := {\n\ta: 1,\n\tb: [\n\t\t1,\n\t\t2,\n\t],\n}\n"},
+		{"f(\n1,\n2)", "f(\n\t1,\n\t2,\n)\n"},
+		{"x := (1 +\n2)", "x := (1 + 2)\n"},
+		{"g(a,\n...c,\nb: 2,\n)", "g(a, ...c, b: 2)\n"},
+		//функция внутри однострочных скобок
+		{"x := [() -> { 1 }, 2]", "x := [() -> {\n\t1\n}, 2]\n"},
+		{"f(() -> {\nreturn 1\n}, 2)", "f(() -> {\n\treturn 1\n}, 2)\n"},
+		{"f := (\na,\n...rest) -> {}", "f := (\n\ta,\n\t...rest\n) -> {}\n"},
+		//{ в начале строки - шаблон или литерал объекта
+		{"x\n{\na,\n...b} := o", "x\n{\n\ta,\n\t...b\n} := o\n"},
+		{"x\n{a: 1,\nb: 2}.b", "x\n{a: 1, b: 2}.b\n"},
+		{"x\n{\na: 1}.a", "x\n{\n\ta: 1,\n}.a\n"},
+
+		//комментарии и пустые строки
+		{"// заголовок\n\n\n\nx := 1   // x\n/* a\n b */ y := 2",
+			"// заголовок\n\nx := 1 // x\n/* a\n b */ y := 2\n"},
+		{"if x { // c\n y\n\n // конец\n\n}", "if x { // c\n\ty\n\n\t// конец\n}\n"},
+		{"f(a, // c\n b)", "f(a, // c\n\tb)\n"},
+		{"x := [ // c\n1]", "x := [ // c\n\t1,\n]\n"},
+		//после многострочного комментария в конце строки сохраняется перевод строки
+		{"/* c */\nx := 1", "/* c */\nx := 1\n"},
+		{"a := 1\n/* c */ ;b := 2", "a := 1\n/* c */\nb := 2\n"},
+		{"/* a */ /* b */\nx", "/* a */ /* b */\nx\n"},
+
+		//1.b - число 1. и имя b
+		{"x := 1 .b + 2", "x := 1 .b + 2\n"},
+		{"x := a . b + 1.5 . c", "x := a.b + 1.5.c\n"},
+		{"x := \"a\xffb\"+1", "x := \"a\xffb\" + 1\n"},
+	}
+
+	for _, test := range tests {
+		v, err := Format(test.src)
+		assert.NoError(t, err, test.src)
+		assert.Equal(t, test.expectedValue, v, test.src)
+
+		//повторное форматирование ничего не меняет
+		again, err := Format(v)
+		assert.NoError(t, err, v)
+		assert.Equal(t, v, again, v)
+	}
+}
+
+func Test_Format_error(t *testing.T) {
+	tests := []string{
+		"x := ",
+		"x := \"текст",
+		"if x { y",
+	}
+
+	for _, test := range tests {
+		_, err := Format(test)
+		assert.Error(t, err, test)
+	}
+}
@@ -1,9 +1,13 @@
 package lexer
 
 import (
+	"errors"
 	"fmt"
+	"github.com/suprunchuksergey/dpl/internal/pos"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 const (
@@ -28,16 +32,36 @@ const (
 	Or  // or
 	Not // not
 
+	AndValue // &&
+	OrValue  // ?:
+
 	Ident  // ident
 	Create // :=
 	Set    // =
 
+	AddSet    // +=
+	SubSet    // -=
+	MulSet    // *=
+	DivSet    // /=
+	ModSet    // %=
+	ConcatSet // ||=
+
 	If   // if
 	Elif // elif
 	Else // else
 
-	For // for
-	In  // in
+	For   // for
+	In    // in
+	While // while
+
+	Try     // try
+	Catch   // catch
+	Finally // finally
+	Throw   // throw
+
+	Import // import
+	Export // export
+	As     // as
 
 	LParen // (
 	RParen // )
@@ -50,21 +74,34 @@ const (
 	Colon     // :
 	Comma     // ,
 	Dot       // .
+	Ellipsis  // ...
 
 	ArrowRight // ->
 	Return     // return
+	Break      // break
+	Continue   // continue
+
+	Int  // 2187
+	Real // 2.187, .2187, 2187.
+	Text // " ... "
+
+	InterpStart // "... ${
+	InterpMid   // } ... ${
+	InterpEnd   // } ... "
 
-	Int   // 2187
-	Real  // 2.187, .2187, 2187.
-	Text  // " ... "
 	True  // true
 	False // false
 	Null  // null
 
+	Comment // // ..., /* ... */
+
 	EOF // eof
 )
 
-type token struct{ id uint8 }
+type token struct {
+	id       uint8
+	pos, end pos.Pos
+}
 
 func (t token) String() string {
 	switch t.id {
@@ -102,11 +139,29 @@ func (t token) String() string {
 	case Not:
 		return "not"
 
+	case AndValue:
+		return "&&"
+	case OrValue:
+		return "?:"
+
 	case Create:
 		return ":="
 	case Set:
 		return "="
 
+	case AddSet:
+		return "+="
+	case SubSet:
+		return "-="
+	case MulSet:
+		return "*="
+	case DivSet:
+		return "/="
+	case ModSet:
+		return "%="
+	case ConcatSet:
+		return "||="
+
 	case If:
 		return "if"
 	case Elif:
@@ -118,6 +173,24 @@ func (t token) String() string {
 		return "for"
 	case In:
 		return "in"
+	case While:
+		return "while"
+
+	case Try:
+		return "try"
+	case Catch:
+		return "catch"
+	case Finally:
+		return "finally"
+	case Throw:
+		return "throw"
+
+	case Import:
+		return "import"
+	case Export:
+		return "export"
+	case As:
+		return "as"
 
 	case LParen:
 		return "("
@@ -140,11 +213,17 @@ func (t token) String() string {
 		return ","
 	case Dot:
 		return "."
+	case Ellipsis:
+		return "..."
 
 	case ArrowRight:
 		return "->"
 	case Return:
 		return "return"
+	case Break:
+		return "break"
+	case Continue:
+		return "continue"
 
 	case True:
 		return "true"
@@ -163,6 +242,10 @@ func (t token) String() string {
 
 func (t token) ID() uint8 { return t.id }
 
+func (t token) Pos() pos.Pos { return t.pos }
+
+func (t token) End() pos.Pos { return t.end }
+
 func newToken(id uint8) token { return token{id: id} }
 
 type tokenWithValue struct {
@@ -180,6 +263,13 @@ func (t tokenWithValue) String() string {
 		return fmt.Sprintf("вещественное число %s", t.value)
 	case Text:
 		return fmt.Sprintf("строка %q", t.value)
+	case InterpStart, InterpMid, InterpEnd:
+		return fmt.Sprintf("часть строки %q", t.value)
+	case Semicolon:
+		//автоматически вставленная ;
+		return "перевод строки"
+	case Comment:
+		return fmt.Sprintf("комментарий %s", t.value)
 	default:
 		return "неизвестный"
 	}
@@ -197,6 +287,10 @@ func newTokenWithValue(id uint8, value string) tokenWithValue {
 type Token interface {
 	fmt.Stringer
 	ID() uint8
+	//позиция первого символа токена
+	Pos() pos.Pos
+	//позиция, следующая за последним символом токена
+	End() pos.Pos
 }
 
 func NewToken(id uint8) Token { return newToken(id) }
@@ -211,24 +305,73 @@ func NewTokenWithValue(id uint8, value string) Token {
 }
 
 var keywords = map[string]uint8{
-	"and":    And,
-	"or":     Or,
-	"not":    Not,
-	"if":     If,
-	"elif":   Elif,
-	"else":   Else,
-	"for":    For,
-	"in":     In,
-	"return": Return,
-	"true":   True,
-	"false":  False,
-	"null":   Null,
+	"and":      And,
+	"or":       Or,
+	"not":      Not,
+	"if":       If,
+	"elif":     Elif,
+	"else":     Else,
+	"for":      For,
+	"in":       In,
+	"while":    While,
+	"try":      Try,
+	"catch":    Catch,
+	"finally":  Finally,
+	"throw":    Throw,
+	"import":   Import,
+	"export":   Export,
+	"as":       As,
+	"return":   Return,
+	"break":    Break,
+	"continue": Continue,
+	"true":     True,
+	"false":    False,
+	"null":     Null,
 }
 
 func expected(char rune) error { return fmt.Errorf("ожидался символ %c", char) }
 
 func unexpected(char rune) error { return fmt.Errorf("неожиданный символ %c", char) }
 
+// вычисляет позиции всех символов текста (и позицию конца текста);
+// символы соответствуют []rune(text): неправильный байт UTF-8 - один символ
+// шириной в байт
+func positions(text string) []pos.Pos {
+	positions := make([]pos.Pos, 0, len(text)+1)
+
+	p := pos.Pos{Line: 1, Column: 1}
+	for p.Offset < len(text) {
+		positions = append(positions, p)
+
+		r, size := utf8.DecodeRuneInString(text[p.Offset:])
+		p.Offset += size
+		if r == '\n' {
+			p.Line++
+			p.Column = 1
+			continue
+		}
+		p.Column++
+	}
+
+	return append(positions, p)
+}
+
+func errorAt(p pos.Pos, err error) error { return &pos.Error{Pos: p, Err: err} }
+
+// устанавливает позицию токена
+func withPos(tok Token, start, end pos.Pos) Token {
+	switch t := tok.(type) {
+	case token:
+		t.pos, t.end = start, end
+		return t
+	case tokenWithValue:
+		t.pos, t.end = start, end
+		return t
+	default:
+		panic("недостижимый")
+	}
+}
+
 func helper(index int, id uint8) (int, Token) { return index + 1, newToken(id) }
 
 func helper2(
@@ -243,26 +386,520 @@ func helper2(
 	return helper(index, id)
 }
 
-func readDigits(runes []rune, index int) (int, string) {
+func unterminatedComment() error { return errors.New("незакрытый комментарий") }
+
+// читает комментарий, начинающийся с // или /*;
+// блочные комментарии могут быть вложенными
+func readComment(runes []rune, index int) (int, string, error) {
+	start := index
+
+	if runes[index+1] == '/' {
+		for index < len(runes) && runes[index] != '\n' {
+			index++
+		}
+		return index, string(runes[start:index]), nil
+	}
+
+	index += 2
+	depth := 1
+	for index < len(runes) {
+		switch {
+		case runes[index] == '/' && index+1 < len(runes) && runes[index+1] == '*':
+			depth++
+			index += 2
+		case runes[index] == '*' && index+1 < len(runes) && runes[index+1] == '/':
+			depth--
+			index += 2
+			if depth == 0 {
+				return index, string(runes[start:index]), nil
+			}
+		default:
+			index++
+		}
+	}
+
+	return 0, "", unterminatedComment()
+}
+
+func hasPrefix(runes []rune, index int, prefix string) bool {
+	for _, r := range prefix {
+		if index >= len(runes) || runes[index] != r {
+			return false
+		}
+		index++
+	}
+	return true
+}
+
+func unknownEscape(char rune) error {
+	return fmt.Errorf("неизвестная escape-последовательность \\%c", char)
+}
+
+func invalidUnicodeEscape() error {
+	return errors.New(`неверная escape-последовательность \u{...}, ожидалось от 1 до 6 шестнадцатеричных цифр`)
+}
+
+func invalidCodePoint(code int64) error {
+	return fmt.Errorf("недопустимый символ юникода U+%X", code)
+}
+
+// читает escape-последовательность, index указывает на \;
+// при ошибке возвращается индекс места ошибки
+func readEscape(runes []rune, index int) (int, rune, error) {
+	start := index
+	index++
+
+	if index == len(runes) {
+		return start, 0, expected('"')
+	}
+
+	switch runes[index] {
+	case 'n':
+		return index + 1, '\n', nil
+	case 't':
+		return index + 1, '\t', nil
+	case 'r':
+		return index + 1, '\r', nil
+	case '0':
+		return index + 1, 0, nil
+	case '\\', '"', '\'', '`', '$':
+		return index + 1, runes[index], nil
+	case 'u':
+		index++
+		if index == len(runes) || runes[index] != '{' {
+			return start, 0, invalidUnicodeEscape()
+		}
+		index++
+
+		digits := index
+		for index < len(runes) && index-digits < 6 && isHexDigit(runes[index]) {
+			index++
+		}
+
+		if index == digits || index == len(runes) || runes[index] != '}' {
+			return start, 0, invalidUnicodeEscape()
+		}
+
+		code, err := strconv.ParseInt(string(runes[digits:index]), 16, 32)
+		if err != nil {
+			return start, 0, invalidUnicodeEscape()
+		}
+		if code > unicode.MaxRune || (code >= 0xD800 && code <= 0xDFFF) {
+			return start, 0, invalidCodePoint(code)
+		}
+
+		return index + 1, rune(code), nil
+	default:
+		return start, 0, unknownEscape(runes[index])
+	}
+}
+
+func isHexDigit(r rune) bool {
+	return unicode.IsDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func unterminatedInterpolation() error {
+	return errors.New("незакрытая подстановка ${")
+}
+
+// читает строку " ... " с escape-последовательностями до закрывающей кавычки
+// или до начала подстановки ${ (тогда interp == true);
+// index указывает на открывающую кавычку или на } в конце подстановки,
+// при ошибке возвращается индекс места ошибки
+func readText(runes []rune, index int) (_ int, _ string, interp bool, _ error) {
+	start := index
+	index++
+
+	var str strings.Builder
+	for index < len(runes) && runes[index] != '"' {
+		if hasPrefix(runes, index, "${") {
+			return index + 2, str.String(), true, nil
+		}
+
+		if runes[index] != '\\' {
+			str.WriteRune(runes[index])
+			index++
+			continue
+		}
+
+		i, r, err := readEscape(runes, index)
+		if err != nil {
+			return i, "", false, err
+		}
+		str.WriteRune(r)
+		index = i
+	}
+
+	if index == len(runes) {
+		return start, "", false, expected('"')
+	}
+
+	return index + 1, str.String(), false, nil
+}
+
+// читает сырую строку ` ... `, escape-последовательности не обрабатываются
+func readRawText(runes []rune, index int) (int, string, error) {
+	start := index
+	index++
+
+	for index < len(runes) && runes[index] != '`' {
+		index++
+	}
+
+	if index == len(runes) {
+		return start, "", expected('`')
+	}
+
+	return index + 1, string(runes[start+1 : index]), nil
+}
+
+// читает многострочную строку """ ... """;
+// перевод строки сразу после открывающих кавычек и последняя строка,
+// состоящая только из пробелов перед закрывающими кавычками, отбрасываются,
+// общий отступ непустых строк удаляется, затем обрабатываются escape-последовательности
+func readMultilineText(runes []rune, index int) (int, string, error) {
+	start := index
+	index += 3
+
+	end := index
+	for {
+		if end >= len(runes) {
+			return start, "", expected('"')
+		}
+		if runes[end] == '\\' {
+			end += 2
+			continue
+		}
+		if hasPrefix(runes, end, `"""`) {
+			break
+		}
+		end++
+	}
+
+	//строки содержимого в виде интервалов [from, to) исходного текста
+	type line struct{ from, to int }
+	lines := make([]line, 0)
+	from := index
+	for i := index; i < end; i++ {
+		if runes[i] == '\n' {
+			lines = append(lines, line{from, i})
+			from = i + 1
+		}
+	}
+	lines = append(lines, line{from, end})
+
+	isBlank := func(l line) bool {
+		for _, r := range runes[l.from:l.to] {
+			if !unicode.IsSpace(r) {
+				return false
+			}
+		}
+		return true
+	}
+
+	indentOf := func(l line) int {
+		i := l.from
+		for i < l.to && (runes[i] == ' ' || runes[i] == '\t') {
+			i++
+		}
+		return i - l.from
+	}
+
+	if len(lines) > 1 && lines[0].from == lines[0].to {
+		lines = lines[1:]
+	}
+
+	indent := -1
+	if len(lines) > 1 && isBlank(lines[len(lines)-1]) {
+		indent = indentOf(lines[len(lines)-1])
+		lines = lines[:len(lines)-1]
+	}
+
+	for _, l := range lines {
+		if isBlank(l) {
+			continue
+		}
+		if i := indentOf(l); indent == -1 || i < indent {
+			indent = i
+		}
+	}
+	indent = max(indent, 0)
+
+	var str strings.Builder
+	for n, l := range lines {
+		if n != 0 {
+			str.WriteRune('\n')
+		}
+
+		i := l.from + min(indent, indentOf(l))
+		for i < l.to {
+			if runes[i] != '\\' {
+				str.WriteRune(runes[i])
+				i++
+				continue
+			}
+
+			next, r, err := readEscape(runes, i)
+			if err != nil {
+				return next, "", err
+			}
+			str.WriteRune(r)
+			i = next
+		}
+	}
+
+	return end + 3, str.String(), nil
+}
+
+func misplacedSeparator() error {
+	return errors.New("разделитель _ может находиться только между цифрами")
+}
+
+func digitsExpected(prefix string) error {
+	return fmt.Errorf("ожидались цифры после %s", prefix)
+}
+
+func exponentExpected() error {
+	return errors.New("ожидались цифры экспоненты")
+}
+
+func invalidDigit(char rune, kind string) error {
+	return fmt.Errorf("недопустимая цифра %c в %s числе", char, kind)
+}
+
+func isBinDigit(r rune) bool { return r == '0' || r == '1' }
+
+func isOctDigit(r rune) bool { return r >= '0' && r <= '7' }
+
+// читает цифры, разделенные _ (1_000_000), разделители не попадают в результат;
+// при ошибке возвращается индекс места ошибки
+func readDigits(runes []rune, index int, isDigit func(rune) bool) (int, string, error) {
 	var digits strings.Builder
 
-	for index < len(runes) && unicode.IsDigit(runes[index]) {
+	for index < len(runes) {
+		if runes[index] == '_' {
+			if digits.Len() == 0 || index+1 == len(runes) || !isDigit(runes[index+1]) {
+				return index, "", misplacedSeparator()
+			}
+			index++
+			continue
+		}
+
+		if !isDigit(runes[index]) {
+			break
+		}
+
 		digits.WriteRune(runes[index])
 		index++
 	}
 
-	str := digits.String()
-	if len(str) == 0 {
-		str = "0"
+	return index, digits.String(), nil
+}
+
+// читает число: 2187, 2.187, .2187, 2187., 2.187e3, 1_000, 0xFF, 0o17, 0b1010;
+// при ошибке возвращается индекс места ошибки
+func readNumber(runes []rune, index int) (int, Token, error) {
+	if runes[index] == '0' && index+1 < len(runes) {
+		var isDigit func(rune) bool
+		var kind string
+
+		switch runes[index+1] {
+		case 'x', 'X':
+			isDigit, kind = isHexDigit, "шестнадцатеричном"
+		case 'o', 'O':
+			isDigit, kind = isOctDigit, "восьмеричном"
+		case 'b', 'B':
+			isDigit, kind = isBinDigit, "двоичном"
+		}
+
+		if isDigit != nil {
+			prefix := "0" + string(unicode.ToLower(runes[index+1]))
+
+			i, digits, err := readDigits(runes, index+2, isDigit)
+			if err != nil {
+				return i, nil, err
+			}
+			if i < len(runes) && (unicode.IsDigit(runes[i]) || unicode.IsLetter(runes[i])) {
+				return i, nil, invalidDigit(runes[i], kind)
+			}
+			if len(digits) == 0 {
+				return index, nil, digitsExpected(prefix)
+			}
+
+			return i, newTokenWithValue(Int, prefix+digits), nil
+		}
+	}
+
+	var value strings.Builder
+	id := Int
+
+	index, digits, err := readDigits(runes, index, unicode.IsDigit)
+	if err != nil {
+		return index, nil, err
+	}
+	if len(digits) == 0 {
+		digits = "0"
+	}
+	value.WriteString(digits)
+
+	if index < len(runes) && runes[index] == '.' {
+		id = Real
+		value.WriteRune('.')
+
+		index, digits, err = readDigits(runes, index+1, unicode.IsDigit)
+		if err != nil {
+			return index, nil, err
+		}
+		if len(digits) == 0 {
+			digits = "0"
+		}
+		value.WriteString(digits)
+	}
+
+	//экспонента: 1e6, 1e+6, 1e-6; e в начале имени (2else) - не экспонента
+	if index < len(runes) && (runes[index] == 'e' || runes[index] == 'E') {
+		i := index + 1
+		sign := ""
+		if i < len(runes) && (runes[i] == '+' || runes[i] == '-') {
+			sign = string(runes[i])
+			i++
+		}
+
+		digit := i < len(runes) && unicode.IsDigit(runes[i])
+		name := i < len(runes) && (unicode.IsLetter(runes[i]) || runes[i] == '_')
+		if !digit && (sign != "" || !name) {
+			return index, nil, exponentExpected()
+		}
+
+		if digit {
+			id = Real
+
+			index, digits, err = readDigits(runes, i, unicode.IsDigit)
+			if err != nil {
+				return index, nil, err
+			}
+
+			value.WriteRune('e')
+			value.WriteString(sign)
+			value.WriteString(digits)
+		}
+	}
+
+	return index, newTokenWithValue(id, value.String()), nil
+}
+
+// разбивает текст на токены, комментарии пропускаются
+func Tokenize(text string) ([]Token, error) { return tokenize(text, false) }
+
+// разбивает текст на токены, комментарии сохраняются в виде токенов Comment
+func TokenizeWithComments(text string) ([]Token, error) { return tokenize(text, true) }
+
+// может ли конструкция заканчиваться токеном
+func EndsConstruction(id uint8) bool {
+	switch id {
+	case Ident, Int, Real, Text, InterpEnd, True, False, Null,
+		RParen, RBrack, RBrace, Break, Continue:
+		return true
+	default:
+		return false
+	}
+}
+
+// начинает ли { после токена блок (тело функции, ветки, цикла, try),
+// а не литерал объекта. В начале конструкции (после ; или перевода
+// строки, которым лексер завершил конструкцию) { - литерал объекта
+// или шаблон: блоков вне конструкций в языке нет
+func OpensBlock(prev Token) bool {
+	if prev == nil {
+		return false
+	}
+	switch prev.ID() {
+	case ArrowRight, Else, Try, Catch, Finally:
+		return true
+	}
+	return EndsConstruction(prev.ID())
+}
+
+// вставляет ; в конце строки, если строка заканчивается токеном,
+// которым может заканчиваться конструкция (как в Go);
+// ; не вставляется внутри ( ), [ ], ${ } и литералов объектов,
+// а также если следующая строка начинается с ;, elif, else, catch или finally
+func insertSemicolons(tokens []Token) []Token {
+	const (
+		paren = iota // (, [, ${
+		block
+		object
+	)
+
+	stack := make([]int, 0)
+	res := make([]Token, 0, len(tokens))
+
+	//следующий токен, не являющийся комментарием
+	next := func(i int) Token {
+		for i++; tokens[i].ID() == Comment; i++ {
+		}
+		return tokens[i]
+	}
+
+	var prev Token
+	for i, tok := range tokens {
+		res = append(res, tok)
+
+		switch tok.ID() {
+		case Comment, EOF:
+			continue
+		case LParen, LBrack, InterpStart:
+			stack = append(stack, paren)
+		case LBrace:
+			if OpensBlock(prev) {
+				stack = append(stack, block)
+			} else {
+				stack = append(stack, object)
+			}
+		case RParen, RBrack, RBrace, InterpEnd:
+			if len(stack) != 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		prev = tok
+
+		if !EndsConstruction(tok.ID()) ||
+			len(stack) != 0 && stack[len(stack)-1] != block {
+			continue
+		}
+
+		n := next(i)
+		if n.Pos().Line <= tok.End().Line {
+			continue
+		}
+
+		switch n.ID() {
+		case EOF, Semicolon, Elif, Else, Catch, Finally:
+			continue
+		}
+
+		//{ в начале следующей строки начинает выражение (литерал
+		//объекта или шаблон), а не блок
+		prev = withPos(newTokenWithValue(Semicolon, "\n"), tok.End(), tok.End())
+		res = append(res, prev)
 	}
 
-	return index, str
+	return res
+}
+
+// открытая подстановка ${ ... } внутри строки
+type interpolation struct {
+	start int //индекс символа $
+	depth int //глубина вложенности { } внутри подстановки
 }
 
-func Tokenize(text string) ([]Token, error) {
+func tokenize(text string, comments bool) ([]Token, error) {
 	runes := []rune(text)
+	positions := positions(text)
 	var index int
 
+	interps := make([]interpolation, 0)
+
 	tokens := make([]Token, 0)
 	for index < len(runes) {
 		if unicode.IsSpace(runes[index]) {
@@ -270,25 +907,49 @@ func Tokenize(text string) ([]Token, error) {
 			continue
 		}
 
+		start := index
+
 		var tok Token
 		switch runes[index] {
 		case '+':
-			index, tok = helper(index, Add)
+			index, tok = helper2(runes, index, '=', Add, AddSet)
 		case '-':
+			if index+1 < len(runes) && runes[index+1] == '=' {
+				index, tok = index+2, newToken(SubSet)
+				break
+			}
 			index, tok = helper2(runes, index, '>', Sub, ArrowRight)
 		case '*':
-			index, tok = helper(index, Mul)
+			index, tok = helper2(runes, index, '=', Mul, MulSet)
 		case '/':
-			index, tok = helper(index, Div)
+			if index+1 < len(runes) && (runes[index+1] == '/' || runes[index+1] == '*') {
+				var comment string
+				var err error
+				index, comment, err = readComment(runes, index)
+				if err != nil {
+					return nil, errorAt(positions[start], err)
+				}
+
+				if !comments {
+					continue
+				}
+				tok = newTokenWithValue(Comment, comment)
+				break
+			}
+			index, tok = helper2(runes, index, '=', Div, DivSet)
 		case '%':
-			index, tok = helper(index, Mod)
+			index, tok = helper2(runes, index, '=', Mod, ModSet)
 
 		case '|':
+			if hasPrefix(runes, index, "||=") {
+				index, tok = index+3, newToken(ConcatSet)
+				break
+			}
 			if index+1 < len(runes) && runes[index+1] == '|' {
 				index, tok = index+2, newToken(Concat)
 				break
 			}
-			return nil, expected('|')
+			return nil, errorAt(positions[start], expected('|'))
 
 		case '=':
 			index, tok = helper2(runes, index, '=', Set, Eq)
@@ -298,7 +959,21 @@ func Tokenize(text string) ([]Token, error) {
 				index, tok = index+2, newToken(Neq)
 				break
 			}
-			return nil, expected('=')
+			return nil, errorAt(positions[start], expected('='))
+
+		case '&':
+			if index+1 < len(runes) && runes[index+1] == '&' {
+				index, tok = index+2, newToken(AndValue)
+				break
+			}
+			return nil, errorAt(positions[start], expected('&'))
+
+		case '?':
+			if index+1 < len(runes) && runes[index+1] == ':' {
+				index, tok = index+2, newToken(OrValue)
+				break
+			}
+			return nil, errorAt(positions[start], expected(':'))
 
 		case '<':
 			index, tok = helper2(runes, index, '=', Lt, Lte)
@@ -314,9 +989,35 @@ func Tokenize(text string) ([]Token, error) {
 		case ']':
 			index, tok = helper(index, RBrack)
 		case '{':
+			if len(interps) != 0 {
+				interps[len(interps)-1].depth++
+			}
 			index, tok = helper(index, LBrace)
 		case '}':
-			index, tok = helper(index, RBrace)
+			if len(interps) == 0 || interps[len(interps)-1].depth != 0 {
+				if len(interps) != 0 {
+					interps[len(interps)-1].depth--
+				}
+				index, tok = helper(index, RBrace)
+				break
+			}
+
+			//конец подстановки, продолжение строки
+			var str string
+			var interp bool
+			var err error
+			index, str, interp, err = readText(runes, index)
+			if err != nil {
+				return nil, errorAt(positions[index], err)
+			}
+
+			if interp {
+				tok = newTokenWithValue(InterpMid, str)
+				break
+			}
+
+			interps = interps[:len(interps)-1]
+			tok = newTokenWithValue(InterpEnd, str)
 
 		case ':':
 			index, tok = helper2(runes, index, '=', Colon, Create)
@@ -347,86 +1048,62 @@ func Tokenize(text string) ([]Token, error) {
 				tok = newTokenWithValue(Ident, ident.String())
 
 			case runes[index] == '"':
-				index++
-
-				var str strings.Builder
-				for index < len(runes) {
-					if runes[index] == '"' {
-						break
-					}
-					str.WriteRune(runes[index])
-					index++
+				var str string
+				var interp bool
+				var err error
+				if hasPrefix(runes, index, `"""`) {
+					index, str, err = readMultilineText(runes, index)
+				} else {
+					index, str, interp, err = readText(runes, index)
 				}
-
-				if index == len(runes) {
-					return nil, expected('"')
+				if err != nil {
+					return nil, errorAt(positions[index], err)
 				}
 
-				index++
-				tok = newTokenWithValue(Text, str.String())
-
-			case runes[index] == '0':
-				var value strings.Builder
-
-				value.WriteRune('0')
-				index++
-
-				if index < len(runes) && runes[index] == '.' {
-					value.WriteRune('.')
-
-					var digits string
-					index, digits = readDigits(runes, index+1)
-
-					value.WriteString(digits)
-					tok = newTokenWithValue(Real, value.String())
+				if interp {
+					interps = append(interps, interpolation{start: index - 2})
+					tok = newTokenWithValue(InterpStart, str)
 					break
 				}
 
-				tok = newTokenWithValue(Int, value.String())
-
-			case unicode.IsDigit(runes[index]):
-				var value strings.Builder
+				tok = newTokenWithValue(Text, str)
 
-				var digits string
-				index, digits = readDigits(runes, index)
-
-				value.WriteString(digits)
-
-				if index < len(runes) && runes[index] == '.' {
-					value.WriteRune('.')
+			case runes[index] == '`':
+				var str string
+				var err error
+				index, str, err = readRawText(runes, index)
+				if err != nil {
+					return nil, errorAt(positions[index], err)
+				}
 
-					var digits string
-					index, digits = readDigits(runes, index+1)
+				tok = newTokenWithValue(Text, str)
 
-					value.WriteString(digits)
-					tok = newTokenWithValue(Real, value.String())
-					break
+			case unicode.IsDigit(runes[index]) ||
+				runes[index] == '.' && index+1 < len(runes) && unicode.IsDigit(runes[index+1]):
+				var err error
+				index, tok, err = readNumber(runes, index)
+				if err != nil {
+					return nil, errorAt(positions[index], err)
 				}
 
-				tok = newTokenWithValue(Int, value.String())
+			case hasPrefix(runes, index, "..."):
+				index, tok = index+3, newToken(Ellipsis)
 
 			case runes[index] == '.':
-				if index+1 < len(runes) && unicode.IsDigit(runes[index+1]) {
-					var value strings.Builder
-					value.WriteString("0.")
-
-					var digits string
-					index, digits = readDigits(runes, index+1)
-
-					value.WriteString(digits)
-
-					tok = newTokenWithValue(Real, value.String())
-					break
-				}
 				index, tok = helper(index, Dot)
 
 			default:
-				return nil, unexpected(runes[index])
+				return nil, errorAt(positions[start], unexpected(runes[index]))
 			}
 		}
-		tokens = append(tokens, tok)
+		tokens = append(tokens, withPos(tok, positions[start], positions[index]))
+	}
+
+	if len(interps) != 0 {
+		return nil, errorAt(positions[interps[len(interps)-1].start], unterminatedInterpolation())
 	}
-	tokens = append(tokens, newToken(EOF))
 
-	return tokens, nil
+	tokens = append(tokens, withPos(newToken(EOF), positions[index], positions[index]))
+
+	return insertSemicolons(tokens), nil
 }
@@ -2,9 +2,23 @@ package lexer
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/suprunchuksergey/dpl/internal/pos"
 	"testing"
 )
 
+// убирает позиции, чтобы сравнивать только идентификаторы и значения токенов
+func withoutPos(tokens []Token) []Token {
+	if tokens == nil {
+		return nil
+	}
+
+	res := make([]Token, 0, len(tokens))
+	for _, tok := range tokens {
+		res = append(res, withPos(tok, pos.Pos{}, pos.Pos{}))
+	}
+	return res
+}
+
 func Test_Tokenize(t *testing.T) {
 	tests := []struct {
 		data          string
@@ -36,6 +50,16 @@ func Test_Tokenize(t *testing.T) {
 		{"||||", []Token{newToken(Concat), newToken(Concat), newToken(EOF)}, nil},
 
 		{"=", []Token{newToken(Set), newToken(EOF)}, nil},
+
+		{"+=", []Token{newToken(AddSet), newToken(EOF)}, nil},
+		{"-=", []Token{newToken(SubSet), newToken(EOF)}, nil},
+		{"*=", []Token{newToken(MulSet), newToken(EOF)}, nil},
+		{"/=", []Token{newToken(DivSet), newToken(EOF)}, nil},
+		{"%=", []Token{newToken(ModSet), newToken(EOF)}, nil},
+		{"||=", []Token{newToken(ConcatSet), newToken(EOF)}, nil},
+		{"x-=1", []Token{
+			newTokenWithValue(Ident, "x"), newToken(SubSet), newTokenWithValue(Int, "1"),
+			newToken(EOF)}, nil},
 		{"==", []Token{newToken(Eq), newToken(EOF)}, nil},
 		{"===", []Token{newToken(Eq), newToken(Set), newToken(EOF)}, nil},
 		{"====", []Token{newToken(Eq), newToken(Eq), newToken(EOF)}, nil},
@@ -69,6 +93,11 @@ func Test_Tokenize(t *testing.T) {
 
 		{",", []Token{newToken(Comma), newToken(EOF)}, nil},
 		{".", []Token{newToken(Dot), newToken(EOF)}, nil},
+		{"...", []Token{newToken(Ellipsis), newToken(EOF)}, nil},
+		{"[...tail]", []Token{
+			newToken(LBrack), newToken(Ellipsis), newTokenWithValue(Ident, "tail"), newToken(RBrack),
+			newToken(EOF)}, nil},
+		{"....5", []Token{newToken(Ellipsis), newTokenWithValue(Real, "0.5"), newToken(EOF)}, nil},
 
 		{"token", []Token{newTokenWithValue(Ident, "token"), newToken(EOF)}, nil},
 		{"_token", []Token{newTokenWithValue(Ident, "_token"), newToken(EOF)}, nil},
@@ -76,6 +105,10 @@ func Test_Tokenize(t *testing.T) {
 		{"token_2187", []Token{newTokenWithValue(Ident, "token_2187"), newToken(EOF)}, nil},
 
 		{"and", []Token{newToken(And), newToken(EOF)}, nil},
+		{"&&", []Token{newToken(AndValue), newToken(EOF)}, nil},
+		{"?:", []Token{newToken(OrValue), newToken(EOF)}, nil},
+		{"&", nil, expected('&')},
+		{"? :", nil, expected(':')},
 		{"or", []Token{newToken(Or), newToken(EOF)}, nil},
 		{"not", []Token{newToken(Not), newToken(EOF)}, nil},
 		{"andornot", []Token{newTokenWithValue(Ident, "andornot"), newToken(EOF)}, nil},
@@ -91,8 +124,20 @@ func Test_Tokenize(t *testing.T) {
 
 		{"for", []Token{newToken(For), newToken(EOF)}, nil},
 		{"in", []Token{newToken(In), newToken(EOF)}, nil},
+		{"while", []Token{newToken(While), newToken(EOF)}, nil},
+
+		{"try", []Token{newToken(Try), newToken(EOF)}, nil},
+		{"catch", []Token{newToken(Catch), newToken(EOF)}, nil},
+		{"finally", []Token{newToken(Finally), newToken(EOF)}, nil},
+		{"throw", []Token{newToken(Throw), newToken(EOF)}, nil},
+
+		{"import", []Token{newToken(Import), newToken(EOF)}, nil},
+		{"export", []Token{newToken(Export), newToken(EOF)}, nil},
+		{"as", []Token{newToken(As), newToken(EOF)}, nil},
 
 		{"return", []Token{newToken(Return), newToken(EOF)}, nil},
+		{"break", []Token{newToken(Break), newToken(EOF)}, nil},
+		{"continue", []Token{newToken(Continue), newToken(EOF)}, nil},
 
 		{"true", []Token{newToken(True), newToken(EOF)}, nil},
 		{"false", []Token{newToken(False), newToken(EOF)}, nil},
@@ -113,7 +158,95 @@ func Test_Tokenize(t *testing.T) {
 			newToken(Dot),
 			newToken(EOF)}, nil},
 
+		{"0", []Token{newTokenWithValue(Int, "0"), newToken(EOF)}, nil},
+		{"0.", []Token{newTokenWithValue(Real, "0.0"), newToken(EOF)}, nil},
+		{"0123", []Token{newTokenWithValue(Int, "0123"), newToken(EOF)}, nil},
+		{"1_000_000", []Token{newTokenWithValue(Int, "1000000"), newToken(EOF)}, nil},
+		{"1_000.000_1", []Token{newTokenWithValue(Real, "1000.0001"), newToken(EOF)}, nil},
+		{"1e6", []Token{newTokenWithValue(Real, "1e6"), newToken(EOF)}, nil},
+		{"1E+6", []Token{newTokenWithValue(Real, "1e+6"), newToken(EOF)}, nil},
+		{"2.5e-3", []Token{newTokenWithValue(Real, "2.5e-3"), newToken(EOF)}, nil},
+		{".5e2", []Token{newTokenWithValue(Real, "0.5e2"), newToken(EOF)}, nil},
+		{"5.e2", []Token{newTokenWithValue(Real, "5.0e2"), newToken(EOF)}, nil},
+		{"1e1_0", []Token{newTokenWithValue(Real, "1e10"), newToken(EOF)}, nil},
+		{"2else", []Token{
+			newTokenWithValue(Int, "2"),
+			newToken(Else),
+			newToken(EOF)}, nil},
+		{"2each", []Token{
+			newTokenWithValue(Int, "2"),
+			newTokenWithValue(Ident, "each"),
+			newToken(EOF)}, nil},
+		{"0xFF", []Token{newTokenWithValue(Int, "0xFF"), newToken(EOF)}, nil},
+		{"0Xdead_BEEF", []Token{newTokenWithValue(Int, "0xdeadBEEF"), newToken(EOF)}, nil},
+		{"0o17", []Token{newTokenWithValue(Int, "0o17"), newToken(EOF)}, nil},
+		{"0b1010_1010", []Token{newTokenWithValue(Int, "0b10101010"), newToken(EOF)}, nil},
+		{"0b1+1", []Token{
+			newTokenWithValue(Int, "0b1"),
+			newToken(Add),
+			newTokenWithValue(Int, "1"),
+			newToken(EOF)}, nil},
+
 		{`"token"`, []Token{newTokenWithValue(Text, "token"), newToken(EOF)}, nil},
+		{`""`, []Token{newTokenWithValue(Text, ""), newToken(EOF)}, nil},
+		{`"a\"b\\c"`, []Token{newTokenWithValue(Text, `a"b\c`), newToken(EOF)}, nil},
+		{"\"\\n\\t\\r\\0\\'\\`\"", []Token{newTokenWithValue(Text, "\n\t\r\x00'`"), newToken(EOF)}, nil},
+		{`"\u{41}\u{44f}\u{1F600}"`, []Token{newTokenWithValue(Text, "Aя😀"), newToken(EOF)}, nil},
+		{`"a\"" "b"`, []Token{
+			newTokenWithValue(Text, `a"`),
+			newTokenWithValue(Text, "b"),
+			newToken(EOF)}, nil},
+
+		{`"$x \${x}"`, []Token{newTokenWithValue(Text, "$x ${x}"), newToken(EOF)}, nil},
+		{`"x=${x}"`, []Token{
+			newTokenWithValue(InterpStart, "x="),
+			newTokenWithValue(Ident, "x"),
+			newTokenWithValue(InterpEnd, ""),
+			newToken(EOF)}, nil},
+		{`"x=${x}, y=${y + 1}!"`, []Token{
+			newTokenWithValue(InterpStart, "x="),
+			newTokenWithValue(Ident, "x"),
+			newTokenWithValue(InterpMid, ", y="),
+			newTokenWithValue(Ident, "y"),
+			newToken(Add),
+			newTokenWithValue(Int, "1"),
+			newTokenWithValue(InterpEnd, "!"),
+			newToken(EOF)}, nil},
+		{`"a${ {"}": "b"}["}"] }c"`, []Token{
+			newTokenWithValue(InterpStart, "a"),
+			newToken(LBrace),
+			newTokenWithValue(Text, "}"),
+			newToken(Colon),
+			newTokenWithValue(Text, "b"),
+			newToken(RBrace),
+			newToken(LBrack),
+			newTokenWithValue(Text, "}"),
+			newToken(RBrack),
+			newTokenWithValue(InterpEnd, "c"),
+			newToken(EOF)}, nil},
+		{`"a${"b${c}d"}e"`, []Token{
+			newTokenWithValue(InterpStart, "a"),
+			newTokenWithValue(InterpStart, "b"),
+			newTokenWithValue(Ident, "c"),
+			newTokenWithValue(InterpEnd, "d"),
+			newTokenWithValue(InterpEnd, "e"),
+			newToken(EOF)}, nil},
+
+		{"`a\\n\"b\"`", []Token{newTokenWithValue(Text, `a\n"b"`), newToken(EOF)}, nil},
+		{"`строка\nдве`", []Token{newTokenWithValue(Text, "строка\nдве"), newToken(EOF)}, nil},
+		{"``", []Token{newTokenWithValue(Text, ""), newToken(EOF)}, nil},
+
+		{`"""текст"""`, []Token{newTokenWithValue(Text, "текст"), newToken(EOF)}, nil},
+		{`""""""`, []Token{newTokenWithValue(Text, ""), newToken(EOF)}, nil},
+		{"\"\"\"\n\t\tпервая\n\t\t  вторая\n\n\t\tтретья\\t!\n\t\t\"\"\"", []Token{
+			newTokenWithValue(Text, "первая\n  вторая\n\nтретья\t!"),
+			newToken(EOF)}, nil},
+		{"\"\"\"\n    первая\n      вторая\n  \"\"\"", []Token{
+			newTokenWithValue(Text, "  первая\n    вторая"),
+			newToken(EOF)}, nil},
+		{"\"\"\"\n  a \"b\" \\\"\"\"\n  \"\"\"", []Token{
+			newTokenWithValue(Text, `a "b" """`),
+			newToken(EOF)}, nil},
 
 		{`2187*19683 - 512%1 || "рублей"`, []Token{
 			newTokenWithValue(Int, "2187"),
@@ -245,7 +378,64 @@ factorial := (n) -> {
 
 			newToken(EOF)}, nil},
 
+		{"// комментарий", []Token{newToken(EOF)}, nil},
+		{"27 // комментарий\n81", []Token{
+			newTokenWithValue(Int, "27"),
+			newTokenWithValue(Semicolon, "\n"),
+			newTokenWithValue(Int, "81"),
+			newToken(EOF)}, nil},
+		{"27 /* комментарий */ 81", []Token{
+			newTokenWithValue(Int, "27"),
+			newTokenWithValue(Int, "81"),
+			newToken(EOF)}, nil},
+		{"27 /* внешний /* вложенный */ ещё внешний */ 81", []Token{
+			newTokenWithValue(Int, "27"),
+			newTokenWithValue(Int, "81"),
+			newToken(EOF)}, nil},
+		{"27 /* a\n * b\n */ /81", []Token{
+			newTokenWithValue(Int, "27"),
+			newTokenWithValue(Semicolon, "\n"),
+			newToken(Div),
+			newTokenWithValue(Int, "81"),
+			newToken(EOF)}, nil},
+		{"27/**/81", []Token{
+			newTokenWithValue(Int, "27"),
+			newTokenWithValue(Int, "81"),
+			newToken(EOF)}, nil},
+
 		{"#", nil, unexpected('#')},
+		{"/* комментарий", nil, unterminatedComment()},
+		{"/* /* */", nil, unterminatedComment()},
+
+		{"1__0", nil, misplacedSeparator()},
+		{"1_", nil, misplacedSeparator()},
+		{"1_.5", nil, misplacedSeparator()},
+		{"1._5", nil, misplacedSeparator()},
+		{"0x", nil, digitsExpected("0x")},
+		{"2e", nil, exponentExpected()},
+		{"1e+", nil, exponentExpected()},
+		{"1.5E-x", nil, exponentExpected()},
+		{"1e;", nil, exponentExpected()},
+		{"0b_1", nil, misplacedSeparator()},
+		{"0b102", nil, invalidDigit('2', "двоичном")},
+		{"0o8", nil, invalidDigit('8', "восьмеричном")},
+		{"0xFG", nil, invalidDigit('G', "шестнадцатеричном")},
+
+		{`"текст`, nil, expected('"')},
+		{`"a${x"`, nil, expected('"')},
+		{`"a${x`, nil, unterminatedInterpolation()},
+		{`"a${x}`, nil, expected('"')},
+		{`"текст\"`, nil, expected('"')},
+		{`"\q"`, nil, unknownEscape('q')},
+		{`"\u41"`, nil, invalidUnicodeEscape()},
+		{`"\u{}"`, nil, invalidUnicodeEscape()},
+		{`"\u{1234567}"`, nil, invalidUnicodeEscape()},
+		{`"\u{zz}"`, nil, invalidUnicodeEscape()},
+		{`"\u{110000}"`, nil, invalidCodePoint(0x110000)},
+		{`"\u{D800}"`, nil, invalidCodePoint(0xD800)},
+		{"`текст", nil, expected('`')},
+		{`"""текст""`, nil, expected('"')},
+		{`"""\q"""`, nil, unknownEscape('q')},
 		{"|", nil, expected('|')},
 		{"!", nil, expected('=')},
 	}
@@ -257,7 +447,192 @@ factorial := (n) -> {
 			assert.EqualError(t, err, test.expectedError.Error())
 		} else {
 			assert.NoError(t, err)
-			assert.Equal(t, test.expectedValue, v)
+			assert.Equal(t, test.expectedValue, withoutPos(v))
+		}
+	}
+}
+
+func Test_TokenizeWithComments(t *testing.T) {
+	tests := []struct {
+		data          string
+		expectedValue []Token
+		expectedError error
+	}{
+		{"// комментарий", []Token{
+			newTokenWithValue(Comment, "// комментарий"),
+			newToken(EOF)}, nil},
+		{"27 // комментарий\n81", []Token{
+			newTokenWithValue(Int, "27"),
+			newTokenWithValue(Semicolon, "\n"),
+			newTokenWithValue(Comment, "// комментарий"),
+			newTokenWithValue(Int, "81"),
+			newToken(EOF)}, nil},
+		{"27 /* a /* b */ c */ 81", []Token{
+			newTokenWithValue(Int, "27"),
+			newTokenWithValue(Comment, "/* a /* b */ c */"),
+			newTokenWithValue(Int, "81"),
+			newToken(EOF)}, nil},
+
+		{"/* комментарий", nil, unterminatedComment()},
+	}
+
+	for _, test := range tests {
+		v, err := TokenizeWithComments(test.data)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, withoutPos(v))
+		}
+	}
+}
+
+func Test_Tokenize_Semicolons(t *testing.T) {
+	semicolon := newTokenWithValue(Semicolon, "\n")
+
+	tests := []struct {
+		data          string
+		expectedValue []Token
+	}{
+		//после идентификатора, литерала и закрывающей скобки
+		{"a\n27\n\"b\"\nf()\nx[0]\ntrue\n", []Token{
+			newTokenWithValue(Ident, "a"), semicolon,
+			newTokenWithValue(Int, "27"), semicolon,
+			newTokenWithValue(Text, "b"), semicolon,
+			newTokenWithValue(Ident, "f"), newToken(LParen), newToken(RParen), semicolon,
+			newTokenWithValue(Ident, "x"), newToken(LBrack), newTokenWithValue(Int, "0"), newToken(RBrack), semicolon,
+			newToken(True),
+			newToken(EOF)}},
+		//после break и continue
+		{"break\ncontinue outer\nx", []Token{
+			newToken(Break), semicolon,
+			newToken(Continue), newTokenWithValue(Ident, "outer"), semicolon,
+			newTokenWithValue(Ident, "x"),
+			newToken(EOF)}},
+		//перед catch и finally ; не вставляется, { после try - блок
+		{"try {\n}\ncatch e {\n}\nfinally {\n}", []Token{
+			newToken(Try), newToken(LBrace), newToken(RBrace),
+			newToken(Catch), newTokenWithValue(Ident, "e"), newToken(LBrace), newToken(RBrace),
+			newToken(Finally), newToken(LBrace), newToken(RBrace),
+			newToken(EOF)}},
+		//строка заканчивается оператором, явная ;
+		{"a +\nb;\nc", []Token{
+			newTokenWithValue(Ident, "a"), newToken(Add),
+			newTokenWithValue(Ident, "b"), newToken(Semicolon),
+			newTokenWithValue(Ident, "c"),
+			newToken(EOF)}},
+		//внутри скобок
+		{"f(\na\n)\n[\nb\n]", []Token{
+			newTokenWithValue(Ident, "f"), newToken(LParen),
+			newTokenWithValue(Ident, "a"),
+			newToken(RParen), semicolon,
+			newToken(LBrack),
+			newTokenWithValue(Ident, "b"),
+			newToken(RBrack),
+			newToken(EOF)}},
+		//литерал объекта и блок
+		{"x := {\n\"a\": 1\n}\nif x {\ny\n}\nelse {\nz\n}", []Token{
+			newTokenWithValue(Ident, "x"), newToken(Create), newToken(LBrace),
+			newTokenWithValue(Text, "a"), newToken(Colon), newTokenWithValue(Int, "1"),
+			newToken(RBrace), semicolon,
+			newToken(If), newTokenWithValue(Ident, "x"), newToken(LBrace),
+			newTokenWithValue(Ident, "y"), semicolon,
+			newToken(RBrace),
+			newToken(Else), newToken(LBrace),
+			newTokenWithValue(Ident, "z"), semicolon,
+			newToken(RBrace),
+			newToken(EOF)}},
+		//{ в начале конструкции - литерал объекта, а не блок
+		{"x\n{\n\"a\": 1\n}.a\n{\nb\n} := o", []Token{
+			newTokenWithValue(Ident, "x"), semicolon,
+			newToken(LBrace),
+			newTokenWithValue(Text, "a"), newToken(Colon), newTokenWithValue(Int, "1"),
+			newToken(RBrace), newToken(Dot), newTokenWithValue(Ident, "a"), semicolon,
+			newToken(LBrace),
+			newTokenWithValue(Ident, "b"),
+			newToken(RBrace), newToken(Create), newTokenWithValue(Ident, "o"),
+			newToken(EOF)}},
+		//тело функции внутри вызова
+		{"f((x) -> {\nx\n})", []Token{
+			newTokenWithValue(Ident, "f"), newToken(LParen),
+			newToken(LParen), newTokenWithValue(Ident, "x"), newToken(RParen),
+			newToken(ArrowRight), newToken(LBrace),
+			newTokenWithValue(Ident, "x"), semicolon,
+			newToken(RBrace), newToken(RParen),
+			newToken(EOF)}},
+	}
+
+	for _, test := range tests {
+		v, err := Tokenize(test.data)
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedValue, withoutPos(v))
+	}
+}
+
+func Test_Tokenize_Pos(t *testing.T) {
+	tests := []struct {
+		data          string
+		expectedValue []pos.Span
+	}{
+		{"", []pos.Span{
+			{Start: pos.Pos{Line: 1, Column: 1}, End: pos.Pos{Line: 1, Column: 1}},
+		}},
+		{"a := 27", []pos.Span{
+			{Start: pos.Pos{Line: 1, Column: 1}, End: pos.Pos{Line: 1, Column: 2, Offset: 1}},
+			{Start: pos.Pos{Line: 1, Column: 3, Offset: 2}, End: pos.Pos{Line: 1, Column: 5, Offset: 4}},
+			{Start: pos.Pos{Line: 1, Column: 6, Offset: 5}, End: pos.Pos{Line: 1, Column: 8, Offset: 7}},
+			{Start: pos.Pos{Line: 1, Column: 8, Offset: 7}, End: pos.Pos{Line: 1, Column: 8, Offset: 7}},
+		}},
+		{"имя;\n\t\"да\"", []pos.Span{
+			{Start: pos.Pos{Line: 1, Column: 1}, End: pos.Pos{Line: 1, Column: 4, Offset: 6}},
+			{Start: pos.Pos{Line: 1, Column: 4, Offset: 6}, End: pos.Pos{Line: 1, Column: 5, Offset: 7}},
+			{Start: pos.Pos{Line: 2, Column: 2, Offset: 9}, End: pos.Pos{Line: 2, Column: 6, Offset: 15}},
+			{Start: pos.Pos{Line: 2, Column: 6, Offset: 15}, End: pos.Pos{Line: 2, Column: 6, Offset: 15}},
+		}},
+		//неправильный байт UTF-8 занимает один байт
+		{"\"a\xffb\" x", []pos.Span{
+			{Start: pos.Pos{Line: 1, Column: 1}, End: pos.Pos{Line: 1, Column: 6, Offset: 5}},
+			{Start: pos.Pos{Line: 1, Column: 7, Offset: 6}, End: pos.Pos{Line: 1, Column: 8, Offset: 7}},
+			{Start: pos.Pos{Line: 1, Column: 8, Offset: 7}, End: pos.Pos{Line: 1, Column: 8, Offset: 7}},
+		}},
+	}
+
+	for _, test := range tests {
+		v, err := Tokenize(test.data)
+		assert.NoError(t, err)
+
+		spans := make([]pos.Span, 0, len(v))
+		for _, tok := range v {
+			spans = append(spans, pos.Span{Start: tok.Pos(), End: tok.End()})
+		}
+		assert.Equal(t, test.expectedValue, spans)
+	}
+}
+
+func Test_Tokenize_ErrorPos(t *testing.T) {
+	tests := []struct {
+		data        string
+		expectedPos pos.Pos
+	}{
+		{"#", pos.Pos{Line: 1, Column: 1}},
+		{"a +\n  |", pos.Pos{Line: 2, Column: 3, Offset: 6}},
+		{"x := \"текст", pos.Pos{Line: 1, Column: 6, Offset: 5}},
+		{"x := 1;\n/* /* */", pos.Pos{Line: 2, Column: 1, Offset: 8}},
+		{`x := "ab\q"`, pos.Pos{Line: 1, Column: 9, Offset: 8}},
+		{"x := 0b102", pos.Pos{Line: 1, Column: 10, Offset: 9}},
+		{"x := 1__0", pos.Pos{Line: 1, Column: 7, Offset: 6}},
+		{"x := 1e+", pos.Pos{Line: 1, Column: 7, Offset: 6}},
+		{"x := 12.5e", pos.Pos{Line: 1, Column: 10, Offset: 9}},
+		{"x := \"\"\"\n  ab\n  c\\q\"\"\"", pos.Pos{Line: 3, Column: 4, Offset: 17}},
+	}
+
+	for _, test := range tests {
+		_, err := Tokenize(test.data)
+
+		var e *pos.Error
+		if assert.ErrorAs(t, err, &e) {
+			assert.Equal(t, test.expectedPos, e.Pos)
 		}
 	}
 }
@@ -16,16 +16,25 @@ type Namespace interface {
 	New(init map[string]value.Value) Namespace
 }
 
+// пространства блоков, итераций и вызовов обычно содержат несколько
+// переменных: поиск по короткому срезу быстрее, чем по карте,
+// и не требует выделять карту для каждого пространства
+const smallScope = 8
+
+type binding struct {
+	name string
+	v    value.Value
+}
+
 type namespace struct {
+	//переменные небольшого пространства, если value == nil
+	vars []binding
+
 	value  map[string]value.Value
 	parent *namespace
 }
 
 func (n *namespace) New(init map[string]value.Value) Namespace {
-	if init == nil {
-		init = make(map[string]value.Value)
-	}
-
 	return &namespace{
 		value:  init,
 		parent: n,
@@ -36,12 +45,54 @@ func VarAlreadyExists(name string) error {
 	return fmt.Errorf("переменная с именем %s уже существует", name)
 }
 
+// переменная текущего пространства
+func (n *namespace) lookup(name string) (value.Value, bool) {
+	if n.value != nil {
+		v, ok := n.value[name]
+		return v, ok
+	}
+
+	for _, b := range n.vars {
+		if b.name == name {
+			return b.v, true
+		}
+	}
+	return nil, false
+}
+
+// изменяет или создает переменную текущего пространства
+func (n *namespace) store(name string, v value.Value) {
+	if n.value != nil {
+		n.value[name] = v
+		return
+	}
+
+	for i := range n.vars {
+		if n.vars[i].name == name {
+			n.vars[i].v = v
+			return
+		}
+	}
+
+	if len(n.vars) < smallScope {
+		n.vars = append(n.vars, binding{name: name, v: v})
+		return
+	}
+
+	n.value = make(map[string]value.Value, len(n.vars)+1)
+	for _, b := range n.vars {
+		n.value[b.name] = b.v
+	}
+	n.value[name] = v
+	n.vars = nil
+}
+
 func (n *namespace) Create(name string, v value.Value) error {
-	_, ok := n.value[name]
+	_, ok := n.lookup(name)
 	if ok {
 		return VarAlreadyExists(name)
 	}
-	n.value[name] = v
+	n.store(name, v)
 	return nil
 }
 
@@ -53,16 +104,12 @@ func (n *namespace) Set(name string, v value.Value) {
 }
 
 func (n *namespace) set(name string, v value.Value) bool {
-	_, ok := n.value[name]
-	if ok {
-		n.value[name] = v
-		return true
-	}
-
-	if n.parent != nil {
-		return n.parent.set(name, v)
+	for scope := n; scope != nil; scope = scope.parent {
+		if _, ok := scope.lookup(name); ok {
+			scope.store(name, v)
+			return true
+		}
 	}
-
 	return false
 }
 
@@ -71,13 +118,10 @@ func VarDoesNotExist(name string) error {
 }
 
 func (n *namespace) Get(name string) (value.Value, error) {
-	v, ok := n.value[name]
-	if ok {
-		return v, nil
-	}
-
-	if n.parent != nil {
-		return n.parent.Get(name)
+	for scope := n; scope != nil; scope = scope.parent {
+		if v, ok := scope.lookup(name); ok {
+			return v, nil
+		}
 	}
 
 	return nil, VarDoesNotExist(name)
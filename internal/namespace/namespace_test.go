@@ -95,3 +95,30 @@ func Test_Set(t *testing.T) {
 		assert.Equal(t, test.value, v)
 	}
 }
+
+func Test_ManyVars(t *testing.T) {
+	parent := New(nil)
+	n := parent.New(nil)
+
+	//переменные дочернего пространства переходят из среза в карту
+	for i := range 2 * smallScope {
+		assert.NoError(t, n.Create(string(rune('a'+i)), value.Int(int64(i))))
+	}
+	assert.EqualError(t, n.Create("a", value.Int(0)), VarAlreadyExists("a").Error())
+
+	n.Set("b", value.Int(100))
+	n.Set("x", value.Int(200))
+	for name, expected := range map[string]value.Value{
+		"a": value.Int(0),
+		"b": value.Int(100),
+		"p": value.Int(15),
+		"x": value.Int(200),
+	} {
+		v, err := n.Get(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, v)
+	}
+
+	_, err := parent.Get("a")
+	assert.EqualError(t, err, VarDoesNotExist("a").Error())
+}
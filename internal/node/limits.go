@@ -0,0 +1,136 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+// ограничения одного выполнения программы; нулевое поле - без ограничения
+type Limits struct {
+	//число выполненных инструкций
+	Steps int64
+	//глубина вложенности вызовов функций; 0 - DefaultDepth
+	Depth int
+	//время выполнения
+	Timeout time.Duration
+}
+
+// глубина вызовов по умолчанию: переполнение стека Go
+// при бесконечной рекурсии завершает процесс
+const DefaultDepth = 10000
+
+// контекст и время проверяются не чаще, чем раз в checkInterval инструкций
+const checkInterval = 1024
+
+// учет ограничений одного выполнения, общий для программы и ее модулей.
+// Ограничения проверяются на каждой итерации цикла, при вызове функции
+// и при входе в тело функции. Функция языка, которую во время выполнения
+// вызывает функция Go, учитывается в том же бюджете, поэтому счетчики
+// изменяются атомарно: функция Go может вызывать ее из других горутин
+type Budget struct {
+	ctx      context.Context
+	limits   Limits
+	deadline time.Time
+
+	steps atomic.Int64
+	depth atomic.Int64
+	//выполнение завершено
+	finished atomic.Bool
+}
+
+// ctx может быть nil
+func NewBudget(ctx context.Context, limits Limits) *Budget {
+	b := &Budget{ctx: ctx, limits: limits}
+	if b.limits.Depth == 0 {
+		b.limits.Depth = DefaultDepth
+	}
+	if limits.Timeout > 0 {
+		b.deadline = time.Now().Add(limits.Timeout)
+	}
+	return b
+}
+
+// отмечает окончание выполнения: функции, созданные им и вызванные
+// позже из Go, получают собственный бюджет
+func (b *Budget) Finish() { b.finished.Store(true) }
+
+// учитывает выполненные инструкции
+func (b *Budget) spend(steps int64) error {
+	total := b.steps.Add(steps)
+	if b.limits.Steps > 0 && total > b.limits.Steps {
+		return &StepLimitError{Limit: b.limits.Steps}
+	}
+
+	//контекст и время проверяются, когда число инструкций
+	//переходит через очередное кратное checkInterval
+	if steps == 0 || total/checkInterval == (total-steps)/checkInterval {
+		return nil
+	}
+
+	if b.ctx != nil {
+		if err := b.ctx.Err(); err != nil {
+			return &CanceledError{Err: err}
+		}
+	}
+	if !b.deadline.IsZero() && time.Now().After(b.deadline) {
+		return &TimeoutError{Timeout: b.limits.Timeout}
+	}
+	return nil
+}
+
+// вход в функцию
+func (b *Budget) enter() error {
+	if b.depth.Add(1) > int64(b.limits.Depth) {
+		b.depth.Add(-1)
+		return &DepthLimitError{Limit: b.limits.Depth}
+	}
+	return nil
+}
+
+func (b *Budget) exit() { b.depth.Add(-1) }
+
+// превышено число инструкций
+type StepLimitError struct{ Limit int64 }
+
+func (e *StepLimitError) Error() string {
+	return fmt.Sprintf("превышено число шагов выполнения (%d)", e.Limit)
+}
+
+// превышена глубина вызовов функций
+type DepthLimitError struct{ Limit int }
+
+func (e *DepthLimitError) Error() string {
+	return fmt.Sprintf("превышена глубина вызовов функций (%d)", e.Limit)
+}
+
+// превышено время выполнения
+type TimeoutError struct{ Timeout time.Duration }
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("превышено время выполнения (%s)", e.Timeout)
+}
+
+// выполнение отменено через контекст; Err - ошибка контекста
+type CanceledError struct{ Err error }
+
+func (e *CanceledError) Error() string {
+	return "выполнение прервано: " + e.Err.Error()
+}
+
+func (e *CanceledError) Unwrap() error { return e.Err }
+
+// ошибка ограничения прерывает выполнение: catch ее не перехватывает,
+// finally не выполняется
+func IsLimit(err error) bool {
+	var (
+		steps    *StepLimitError
+		depth    *DepthLimitError
+		timeout  *TimeoutError
+		canceled *CanceledError
+	)
+	return errors.As(err, &steps) || errors.As(err, &depth) ||
+		errors.As(err, &timeout) || errors.As(err, &canceled)
+}
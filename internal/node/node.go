@@ -3,115 +3,45 @@ package node
 import (
 	"errors"
 	"fmt"
-	"github.com/suprunchuksergey/dpl/internal/namespace"
+	"github.com/suprunchuksergey/dpl/internal/pos"
 	"github.com/suprunchuksergey/dpl/internal/value"
-	"math"
-	"slices"
 )
 
-type Node interface {
-	Exec(namespace namespace.Namespace) (value.Value, error)
-}
-
-type binary struct{ a, b Node }
-
-// вычисляет оба узла
-func (n binary) exec(
-	namespace namespace.Namespace,
-	validators ...func(value.Value, value.Value) error,
-) (value.Value, value.Value, error) {
-
-	a, err := n.a.Exec(namespace)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	b, err := n.b.Exec(namespace)
-	if err != nil {
-		return nil, nil, err
-	}
+// узел программы; выполняется байт-кодом, полученным Compile
+type Node interface{ node() }
 
-	for _, validator := range validators {
-		if err := validator(a, b); err != nil {
-			return nil, nil, err
-		}
-	}
-
-	return a, b, nil
+// узел с участком исходного кода, из которого он получен;
+// ошибки вложенного узла привязываются к началу участка
+type spanned struct {
+	n    Node
+	span pos.Span
 }
 
-// шаблон для арифметических операторов
-func (n binary) arithmetic(
-	namespace namespace.Namespace,
-	floatH func(float64, float64) float64,
-	intH func(int64, int64) int64,
-	validators ...func(value.Value, value.Value) error,
-) (value.Value, error) {
+func (spanned) node() {}
 
-	a, b, err := n.exec(namespace, validators...)
-	if err != nil {
-		return nil, err
-	}
+func At(span pos.Span, n Node) Node { return spanned{n: n, span: span} }
 
-	if a.IsReal() || b.IsReal() {
-		a, b, err := binaryToReal(a, b)
-		if err != nil {
-			return nil, err
-		}
-		return value.Real(floatH(a, b)), nil
-	} else {
-		a, b, err := binaryToInt(a, b)
-		if err != nil {
-			return nil, err
-		}
-		return value.Int(intH(a, b)), nil
+// возвращает участок исходного кода узла, если он известен
+func SpanOf(n Node) (pos.Span, bool) {
+	s, ok := n.(spanned)
+	if !ok {
+		return pos.Span{}, false
 	}
+	return s.span, true
 }
 
-// шаблон для операторов сравнения
-func (n binary) comparison(
-	namespace namespace.Namespace,
-	stringH func(string, string) bool,
-	floatH func(float64, float64) bool,
-	validators ...func(value.Value, value.Value) error,
-) (value.Value, error) {
-
-	a, b, err := n.exec(namespace, validators...)
-	if err != nil {
-		return nil, err
-	}
-
-	if a.IsText() && b.IsText() {
-		return value.Bool(stringH(
-			a.Text(), b.Text(),
-		)), nil
-	} else {
-		a, b, err := binaryToReal(a, b)
-		if err != nil {
-			return nil, err
+// возвращает узел без участка исходного кода
+func unwrap(n Node) Node {
+	for {
+		s, ok := n.(spanned)
+		if !ok {
+			return n
 		}
-		return value.Bool(floatH(a, b)), nil
+		n = s.n
 	}
 }
 
-// шаблон для логических операторов
-func (n binary) logic(
-	namespace namespace.Namespace,
-	boolH func(bool, bool) bool,
-	validators ...func(value.Value, value.Value) error,
-) (value.Value, error) {
-
-	a, b, err := n.exec(namespace, validators...)
-	if err != nil {
-		return nil, err
-	}
-
-	aBool, bBool, err := binaryToBool(a, b)
-	if err != nil {
-		return nil, err
-	}
-	return value.Bool(boolH(aBool, bBool)), nil
-}
+type binary struct{ a, b Node }
 
 func binaryToInt(a, b value.Value) (int64, int64, error) {
 	aInt, err := a.Int()
@@ -137,18 +67,6 @@ func binaryToReal(a, b value.Value) (float64, float64, error) {
 	return aReal, bReal, nil
 }
 
-func binaryToBool(a, b value.Value) (bool, bool, error) {
-	aBool, err := a.Bool()
-	if err != nil {
-		return false, false, err
-	}
-	bBool, err := b.Bool()
-	if err != nil {
-		return false, false, err
-	}
-	return aBool, bBool, nil
-}
-
 func addOp[T int64 | float64 | string](a, b T) T { return a + b }
 func subOp[T int64 | float64](a, b T) T          { return a - b }
 func mulOp[T int64 | float64](a, b T) T          { return a * b }
@@ -161,40 +79,10 @@ func gtOp[T float64 | string](a, b T) bool  { return a > b }
 func lteOp[T float64 | string](a, b T) bool { return a <= b }
 func gteOp[T float64 | string](a, b T) bool { return a >= b }
 
-func andOp(a, b bool) bool { return a && b }
-func orOp(a, b bool) bool  { return a || b }
-
 func opNotDefined(op, typ string) error {
 	return fmt.Errorf("оператор %s не определен для типа %s", op, typ)
 }
 
-func getCheckOpNotDefined(
-	op string,
-	whitelist ...string,
-) func(value.Value) error {
-	return func(v value.Value) error {
-		for _, i := range whitelist {
-			if v.Type() == i {
-				return nil
-			}
-		}
-		return opNotDefined(op, v.Type())
-	}
-}
-
-func getBinaryCheckOpNotDefined(
-	op string,
-	whitelist ...string,
-) func(value.Value, value.Value) error {
-	check := getCheckOpNotDefined(op, whitelist...)
-	return func(a, b value.Value) error {
-		if err := check(a); err != nil {
-			return err
-		}
-		return check(b)
-	}
-}
-
 var baseWhitelist = []string{
 	value.IntType,
 	value.RealType,
@@ -205,40 +93,19 @@ var baseWhitelist = []string{
 
 type add struct{ binary }
 
-func (n add) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.arithmetic(
-		namespace,
-		addOp[float64],
-		addOp[int64],
-		getBinaryCheckOpNotDefined("+", baseWhitelist...),
-	)
-}
+func (add) node() {}
 
 func Add(a, b Node) Node { return add{binary{a: a, b: b}} }
 
 type sub struct{ binary }
 
-func (n sub) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.arithmetic(
-		namespace,
-		subOp[float64],
-		subOp[int64],
-		getBinaryCheckOpNotDefined("-", baseWhitelist...),
-	)
-}
+func (sub) node() {}
 
 func Sub(a, b Node) Node { return sub{binary{a: a, b: b}} }
 
 type mul struct{ binary }
 
-func (n mul) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.arithmetic(
-		namespace,
-		mulOp[float64],
-		mulOp[int64],
-		getBinaryCheckOpNotDefined("*", baseWhitelist...),
-	)
-}
+func (mul) node() {}
 
 func Mul(a, b Node) Node { return mul{binary{a: a, b: b}} }
 
@@ -257,120 +124,63 @@ func checkDivByZero(_, b value.Value) error {
 
 type div struct{ binary }
 
-func (n div) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.arithmetic(
-		namespace,
-		divOp[float64],
-		divOp[int64],
-		getBinaryCheckOpNotDefined("/", baseWhitelist...),
-		checkDivByZero,
-	)
-}
+func (div) node() {}
 
 func Div(a, b Node) Node { return div{binary{a: a, b: b}} }
 
 type mod struct{ binary }
 
-func (n mod) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.arithmetic(
-		namespace,
-		func(a, b float64) float64 { return math.Mod(a, b) },
-		func(a, b int64) int64 { return a % b },
-		getBinaryCheckOpNotDefined("%", baseWhitelist...),
-		checkDivByZero,
-	)
-}
+func (mod) node() {}
 
 func Mod(a, b Node) Node { return mod{binary{a: a, b: b}} }
 
 type concat struct{ binary }
 
-func (n concat) Exec(namespace namespace.Namespace) (value.Value, error) {
-	a, b, err := n.exec(namespace)
-	if err != nil {
-		return nil, err
-	}
-
-	return value.Text(a.Text() + b.Text()), nil
-}
+func (concat) node() {}
 
 func Concat(a, b Node) Node { return concat{binary{a: a, b: b}} }
 
+// строка с подстановками "x=${x}": части вычисляются
+// и объединяются в одну строку
+type interpolation struct{ parts []Node }
+
+func (interpolation) node() {}
+
+func Interpolation(parts ...Node) Node { return interpolation{parts: parts} }
+
 type eq struct{ binary }
 
-func (n eq) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.comparison(
-		namespace,
-		eqOp[string],
-		eqOp[float64],
-		getBinaryCheckOpNotDefined("==", baseWhitelist...),
-	)
-}
+func (eq) node() {}
 
 func Eq(a, b Node) Node { return eq{binary{a: a, b: b}} }
 
 type neq struct{ binary }
 
-func (n neq) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.comparison(
-		namespace,
-		neqOp[string],
-		neqOp[float64],
-		getBinaryCheckOpNotDefined("!=", baseWhitelist...),
-	)
-}
+func (neq) node() {}
 
 func Neq(a, b Node) Node { return neq{binary{a: a, b: b}} }
 
 type lt struct{ binary }
 
-func (n lt) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.comparison(
-		namespace,
-		ltOp[string],
-		ltOp[float64],
-		getBinaryCheckOpNotDefined("<", baseWhitelist...),
-	)
-}
+func (lt) node() {}
 
 func Lt(a, b Node) Node { return lt{binary{a: a, b: b}} }
 
 type gt struct{ binary }
 
-func (n gt) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.comparison(
-		namespace,
-		gtOp[string],
-		gtOp[float64],
-		getBinaryCheckOpNotDefined(">", baseWhitelist...),
-	)
-}
+func (gt) node() {}
 
 func Gt(a, b Node) Node { return gt{binary{a: a, b: b}} }
 
 type lte struct{ binary }
 
-func (n lte) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.comparison(
-		namespace,
-		lteOp[string],
-		lteOp[float64],
-		getBinaryCheckOpNotDefined("<=", baseWhitelist...),
-	)
-}
+func (lte) node() {}
 
 func Lte(a, b Node) Node { return lte{binary{a: a, b: b}} }
 
 type gte struct{ binary }
 
-func (n gte) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.comparison(
-		namespace,
-		gteOp[string],
-		gteOp[float64],
-		getBinaryCheckOpNotDefined(">=", baseWhitelist...),
-	)
-}
+func (gte) node() {}
 
 func Gte(a, b Node) Node { return gte{binary{a: a, b: b}} }
 
@@ -386,144 +196,81 @@ var logicWhitelist = []string{
 
 type and struct{ binary }
 
-func (n and) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.logic(
-		namespace,
-		andOp,
-		getBinaryCheckOpNotDefined("and", logicWhitelist...),
-	)
-}
+func (and) node() {}
 
+// a and b: true, если оба операнда истинны;
+// b не вычисляется, если a ложно
 func And(a, b Node) Node { return and{binary{a: a, b: b}} }
 
+type andValue struct{ binary }
+
+func (andValue) node() {}
+
+// a && b: a, если a ложно, иначе b
+func AndValue(a, b Node) Node { return andValue{binary{a: a, b: b}} }
+
 type or struct{ binary }
 
-func (n or) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return n.logic(
-		namespace,
-		orOp,
-		getBinaryCheckOpNotDefined("or", logicWhitelist...),
-	)
-}
+func (or) node() {}
 
+// a or b: true, если хотя бы один операнд истинен;
+// b не вычисляется, если a истинно
 func Or(a, b Node) Node { return or{binary{a: a, b: b}} }
 
-type unary struct{ v Node }
+type orValue struct{ binary }
 
-func (n unary) exec(
-	namespace namespace.Namespace,
-	validators ...func(value.Value) error,
-) (value.Value, error) {
+func (orValue) node() {}
 
-	v, err := n.v.Exec(namespace)
-	if err != nil {
-		return nil, err
-	}
-
-	for _, validator := range validators {
-		if err := validator(v); err != nil {
-			return nil, err
-		}
-	}
+// a ?: b: a, если a истинно, иначе b
+func OrValue(a, b Node) Node { return orValue{binary{a: a, b: b}} }
 
-	return v, nil
-}
+type unary struct{ v Node }
 
 type neg struct{ unary }
 
-func (n neg) Exec(namespace namespace.Namespace) (value.Value, error) {
-	v, err := n.exec(namespace, getCheckOpNotDefined("унарный -", baseWhitelist...))
-	if err != nil {
-		return nil, err
-	}
-
-	if v.IsReal() {
-		v, err := v.Real()
-		if err != nil {
-			return nil, err
-		}
-		return value.Real(-v), nil
-	} else {
-		v, err := v.Int()
-		if err != nil {
-			return nil, err
-		}
-		return value.Int(-v), nil
-	}
-}
+func (neg) node() {}
 
 func Neg(v Node) Node { return neg{unary{v: v}} }
 
 type not struct{ unary }
 
-func (n not) Exec(namespace namespace.Namespace) (value.Value, error) {
-	v, err := n.exec(namespace, getCheckOpNotDefined("not", logicWhitelist...))
-	if err != nil {
-		return nil, err
-	}
-
-	vBool, err := v.Bool()
-	if err != nil {
-		return nil, err
-	}
-
-	return value.Bool(!vBool), nil
-}
+func (not) node() {}
 
 func Not(v Node) Node { return not{unary{v: v}} }
 
 type valueNode struct{ v value.Value }
 
-func (n valueNode) Exec(_ namespace.Namespace) (value.Value, error) {
-	return n.v, nil
-}
+func (valueNode) node() {}
 
 func Int(v int64) Node    { return valueNode{v: value.Int(v)} }
 func Real(v float64) Node { return valueNode{v: value.Real(v)} }
 func Text(v string) Node  { return valueNode{v: value.Text(v)} }
 func Bool(v bool) Node    { return valueNode{v: value.Bool(v)} }
 
-type array struct{ nodes []Node }
+func cannotSpread(typ, into string) error {
+	return fmt.Errorf("значение типа %s нельзя развернуть в %s", typ, into)
+}
 
-func (n array) Exec(namespace namespace.Namespace) (value.Value, error) {
-	values := make([]value.Value, 0, len(n.nodes))
+// развертывание ...v в массиве, объекте или аргументах вызова;
+// вычисляется в само значение, элементы извлекает содержащий узел
+type spread struct{ v Node }
 
-	for _, node := range n.nodes {
-		v, err := node.Exec(namespace)
-		if err != nil {
-			return nil, err
-		}
-		values = append(values, v)
-	}
+func (spread) node() {}
 
-	return value.Array(values...), nil
-}
+func Spread(v Node) Node { return spread{v: v} }
+
+type array struct{ nodes []Node }
+
+func (array) node() {}
 
 func Array(nodes ...Node) Node { return array{nodes: nodes} }
 
+// пара объекта; если Value - Spread, пара разворачивает поля, Key не используется
 type KV struct{ Key, Value Node }
 
 type object struct{ pairs []KV }
 
-func (n object) Exec(namespace namespace.Namespace) (value.Value, error) {
-	pairs := make([]value.KV, 0, len(n.pairs))
-
-	for _, pair := range n.pairs {
-		key, err := pair.Key.Exec(namespace)
-		if err != nil {
-			return nil, err
-		}
-
-		v, err := pair.Value.Exec(namespace)
-		if err != nil {
-			return nil, err
-		}
-
-		pairs = append(pairs, value.KV{Key: key, Value: v})
-	}
-
-	return value.Object(pairs...), nil
-}
+func (object) node() {}
 
 func Object(pairs ...KV) Node {
 	return object{pairs: pairs}
@@ -537,42 +284,37 @@ func wrongIndex(typ string) error {
 
 type elByIndex struct{ v, index Node }
 
-func (n elByIndex) Exec(namespace namespace.Namespace) (value.Value, error) {
-	v, err := n.v.Exec(namespace)
-	if err != nil {
-		return nil, err
-	}
+func (elByIndex) node() {}
 
-	check := getCheckOpNotDefined(
-		"[<index>]",
-		value.TextType, value.ArrayType, value.ObjectType)
-	if err := check(v); err != nil {
-		return nil, err
-	}
+func ElByIndex(v, index Node) Node { return elByIndex{v: v, index: index} }
 
-	index, err := n.index.Exec(namespace)
-	if err != nil {
-		return nil, err
-	}
+// индекс-срез start:end:step, используется как индекс ElByIndex
+type sliceNode struct{ start, end, step Node }
 
-	if v.Type() == value.ObjectType {
-		return v.ElByIndex(index)
-	}
+func (sliceNode) node() {}
 
-	if !slices.Contains(baseWhitelist, index.Type()) {
-		return nil, wrongIndex(index.Type())
-	}
+// start, end, step могут быть nil: a[:end], a[start:], a[::step]
+func Slice(start, end, step Node) Node {
+	return sliceNode{start: start, end: end, step: step}
+}
 
-	return v.ElByIndex(index)
+func checkMember(v value.Value, name string) error {
+	return checkType("."+name, v, []string{value.ObjectType})
 }
 
-func ElByIndex(v, index Node) Node { return elByIndex{v: v, index: index} }
+// доступ к полю объекта через точку: object.name
+type member struct {
+	v    Node
+	name string
+}
+
+func (member) node() {}
+
+func Member(v Node, name string) Node { return member{v: v, name: name} }
 
 type ident struct{ v string }
 
-func (n ident) Exec(namespace namespace.Namespace) (value.Value, error) {
-	return namespace.Get(n.v)
-}
+func (ident) node() {}
 
 func Ident(v string) Node { return ident{v: v} }
 
@@ -580,101 +322,165 @@ func idExpected() error {
 	return errors.New("ожидался идентификатор")
 }
 
-type create struct{ name, v Node }
+func patternNotValue() error {
+	return errors.New("шаблон деструктуризации не является значением")
+}
 
-func (n create) Exec(namespace namespace.Namespace) (value.Value, error) {
-	id, ok := n.name.(ident)
-	if !ok {
-		return nil, idExpected()
-	}
+func cannotDestructure(typ, pattern string) error {
+	return fmt.Errorf("значение типа %s нельзя деструктурировать как %s", typ, pattern)
+}
 
-	v, err := n.v.Exec(namespace)
-	if err != nil {
-		return nil, err
-	}
+func tooFewElements(expected, got int) error {
+	return fmt.Errorf("недостаточно элементов для деструктуризации: ожидалось %d, получено %d", expected, got)
+}
 
-	if err := namespace.Create(id.v, v); err != nil {
-		return nil, err
-	}
+func tooManyElements(expected, got int) error {
+	return fmt.Errorf("слишком много элементов для деструктуризации: ожидалось %d, получено %d", expected, got)
+}
 
-	return v, nil
+// шаблон массива: [a, [b, c], d = 0, ...rest]
+type arrayPattern struct {
+	elems []Node
+	//получатель оставшихся элементов, может отсутствовать
+	rest Node
 }
 
-func Create(name, v Node) Node { return create{name: name, v: v} }
+func (arrayPattern) node() {}
 
-type set struct{ name, v Node }
+// rest - получатель оставшихся элементов или nil
+func ArrayPattern(rest Node, elems ...Node) Node {
+	return arrayPattern{elems: elems, rest: rest}
+}
 
-func (n set) Exec(namespace namespace.Namespace) (value.Value, error) {
-	v, err := n.v.Exec(namespace)
-	if err != nil {
-		return nil, err
-	}
+// поле шаблона объекта: {key: target}
+type Prop struct {
+	Key    string
+	Target Node
+}
 
-	if id, ok := n.name.(ident); ok {
-		namespace.Set(id.v, v)
-		return v, nil
-	}
+// шаблон объекта: {x, y: [a, b], z = 0, ...rest}
+type objectPattern struct {
+	props []Prop
+	//получатель оставшихся полей, может отсутствовать
+	rest Node
+}
 
-	id := n.name
-	indexes := make([]value.Value, 0, 1)
-	for {
-		index, ok := id.(elByIndex)
-		if !ok {
-			break
+func (objectPattern) node() {}
+
+// rest - получатель оставшихся полей или nil
+func ObjectPattern(rest Node, props ...Prop) Node {
+	return objectPattern{props: props, rest: rest}
+}
+
+// получатель со значением по умолчанию: [a, b = 0]
+type defaulted struct{ target, v Node }
+
+func (defaulted) node() {}
+
+func Default(target, v Node) Node { return defaulted{target: target, v: v} }
+
+// проверяет, что получатель состоит только из идентификаторов и шаблонов
+func checkPattern(target Node) error {
+	switch t := unwrap(target).(type) {
+	case ident:
+		return nil
+	case arrayPattern:
+		for _, elem := range t.elems {
+			if err := checkPattern(elem); err != nil {
+				return err
+			}
 		}
-		i, err := index.index.Exec(namespace)
-		if err != nil {
-			return nil, err
+		if t.rest != nil {
+			return checkPattern(t.rest)
 		}
-		indexes = append(indexes, i)
-		id = index.v
-	}
-
-	if _, ok := id.(ident); !ok {
-		return nil, idExpected()
+		return nil
+	case objectPattern:
+		for _, prop := range t.props {
+			if err := checkPattern(prop.Target); err != nil {
+				return err
+			}
+		}
+		if t.rest != nil {
+			return checkPattern(t.rest)
+		}
+		return nil
+	case defaulted:
+		return checkPattern(t.target)
+	default:
+		return idExpected()
 	}
+}
 
-	name := id.(ident).v
-	target, err := namespace.Get(name)
+// элементы массива
+func elements(v value.Value) ([]value.Value, error) {
+	iter, err := v.Iter2()
 	if err != nil {
 		return nil, err
 	}
 
-	for i := len(indexes) - 1; i >= 0; i-- {
-		if i == 0 {
-			if err := target.SetElByIndex(indexes[i], v); err != nil {
-				return nil, err
-			}
-			break
-		}
+	res := make([]value.Value, 0)
+	for _, el := range iter {
+		res = append(res, el)
+	}
+	return res, nil
+}
 
-		target, err = target.ElByIndex(indexes[i])
-		if err != nil {
-			return nil, err
-		}
+// поля объекта
+func fields(v value.Value) (map[string]value.Value, error) {
+	iter, err := v.Iter2()
+	if err != nil {
+		return nil, err
 	}
 
-	return v, nil
+	res := make(map[string]value.Value)
+	for k, el := range iter {
+		res[k.Text()] = el
+	}
+	return res, nil
 }
 
+type create struct{ name, v Node }
+
+func (create) node() {}
+
+func Create(name, v Node) Node { return create{name: name, v: v} }
+
+type set struct{ name, v Node }
+
+func (set) node() {}
+
 func Set(name, v Node) Node { return set{name: name, v: v} }
 
-type block struct{ cmds []Node }
+// операторы составного присваивания: x += 1 -> x = x + 1
+var compoundOps = map[string]opcode{
+	"+":  opAdd,
+	"-":  opSub,
+	"*":  opMul,
+	"/":  opDiv,
+	"%":  opMod,
+	"||": opConcat,
+}
 
-func (n block) Exec(namespace namespace.Namespace) (value.Value, error) {
-	v := value.Null()
+// составное присваивание: name op= v
+type compound struct {
+	op      string
+	name, v Node
+}
 
-	for _, cmd := range n.cmds {
-		val, err := cmd.Exec(namespace)
-		if err != nil {
-			return nil, err
-		}
-		v = val
-	}
+func (compound) node() {}
 
-	return v, nil
+// op - один из операторов +, -, *, /, %, ||
+func Compound(op string, name, v Node) Node {
+	if _, ok := compoundOps[op]; !ok {
+		panic("неизвестный оператор " + op)
+	}
+	return compound{op: op, name: name, v: v}
 }
 
+type block struct{ cmds []Node }
+
+func (block) node() {}
+
 func Block(cmds ...Node) Node { return block{cmds: cmds} }
 
 type Branch struct{ Cond, Body Node }
@@ -683,25 +489,7 @@ type branch struct {
 	branches []Branch
 }
 
-func (n branch) Exec(namespace namespace.Namespace) (value.Value, error) {
-	for _, b := range n.branches {
-		cond, err := b.Cond.Exec(namespace)
-		if err != nil {
-			return nil, err
-		}
-
-		condBool, err := cond.Bool()
-		if err != nil {
-			return nil, err
-		}
-
-		if condBool {
-			return b.Body.Exec(namespace.New(nil))
-		}
-	}
-
-	return value.Null(), nil
-}
+func (branch) node() {}
 
 func If(branches ...Branch) Node { return branch{branches: branches} }
 
@@ -709,77 +497,41 @@ func tooFewRecipients() error { return errors.New("слишком мало по
 
 func tooManyRecipients() error { return errors.New("слишком много получателей") }
 
-type loop struct {
-	recipients []Node
-	from       Node
-	body       Node
-}
-
-func (n loop) Exec(namespace namespace.Namespace) (value.Value, error) {
-	names := make([]string, 0, len(n.recipients))
-	for _, recipient := range n.recipients {
-		r, ok := recipient.(ident)
-		if !ok {
-			return nil, idExpected()
-		}
-		names = append(names, r.v)
-	}
-
-	from, err := n.from.Exec(namespace)
-	if err != nil {
-		return nil, err
-	}
+type breakErr struct{ label string }
 
-	switch len(names) {
-	case 0:
-		return nil, tooFewRecipients()
+func (e breakErr) Error() string {
+	return "break может использоваться только в цикле"
+}
 
-	case 1:
-		iter, err := from.Iter()
-		if err != nil {
-			return nil, err
-		}
+type continueErr struct{ label string }
 
-		res := value.Null()
-		for i := range iter {
-			val, err := n.body.Exec(namespace.New(map[string]value.Value{
-				names[0]: i,
-			}))
-			if err != nil {
-				return nil, err
-			}
+func (e continueErr) Error() string {
+	return "continue может использоваться только в цикле"
+}
 
-			res = val
-		}
+type breakNode struct{ label string }
 
-		return res, nil
+func (breakNode) node() {}
 
-	case 2:
-		iter, err := from.Iter2()
-		if err != nil {
-			return nil, err
-		}
+// label - метка цикла, пустая строка - ближайший цикл
+func Break(label string) Node { return breakNode{label: label} }
 
-		res := value.Null()
-		for i, j := range iter {
-			val, err := n.body.Exec(namespace.New(map[string]value.Value{
-				names[0]: i,
-				names[1]: j,
-			}))
-			if err != nil {
-				return nil, err
-			}
+type continueNode struct{ label string }
 
-			res = val
-		}
+func (continueNode) node() {}
 
-		return res, nil
+// label - метка цикла, пустая строка - ближайший цикл
+func Continue(label string) Node { return continueNode{label: label} }
 
-	default:
-		return nil, tooManyRecipients()
-	}
+type loop struct {
+	label      string
+	recipients []Node
+	from       Node
+	body       Node
 }
 
+func (loop) node() {}
+
 func For(recipients []Node, from, body Node) Node {
 	return loop{
 		recipients: recipients,
@@ -788,33 +540,60 @@ func For(recipients []Node, from, body Node) Node {
 	}
 }
 
-type call struct {
-	target Node
-	args   []Node
+type whileLoop struct {
+	label string
+	cond  Node
+	body  Node
 }
 
-func (n call) Exec(namespace namespace.Namespace) (value.Value, error) {
-	target, err := n.target.Exec(namespace)
-	if err != nil {
-		return nil, err
-	}
+func (whileLoop) node() {}
 
-	if target.Type() != value.FunctionType {
-		return nil, opNotDefined("вызов функции", target.Type())
+func While(cond, body Node) Node {
+	return whileLoop{
+		cond: cond,
+		body: body,
 	}
+}
 
-	args := make([]value.Value, 0, len(n.args))
-	for _, arg := range n.args {
-		val, err := arg.Exec(namespace)
-		if err != nil {
-			return nil, err
-		}
-		args = append(args, val)
+// помечает цикл меткой, на которую ссылаются break и continue
+func Labeled(label string, n Node) Node {
+	switch n := n.(type) {
+	case loop:
+		n.label = label
+		return n
+	case whileLoop:
+		n.label = label
+		return n
+	default:
+		panic("недостижимый")
 	}
+}
+
+func unknownParam(name string) error {
+	return fmt.Errorf("параметра с именем %s не существует", name)
+}
+
+func duplicateArg(name string) error {
+	return fmt.Errorf("значение параметра %s передано дважды", name)
+}
+
+// именованный аргумент вызова: name: v
+type named struct {
+	name string
+	v    Node
+}
+
+func (named) node() {}
+
+func Named(name string, v Node) Node { return named{name: name, v: v} }
 
-	return target.Call(args...)
+type call struct {
+	target Node
+	args   []Node
 }
 
+func (call) node() {}
+
 func Call(target Node, args ...Node) Node {
 	return call{
 		target: target,
@@ -830,61 +609,129 @@ func (r returnErr) Error() string {
 
 type returnNode struct{ v Node }
 
-func (n returnNode) Exec(namespace namespace.Namespace) (value.Value, error) {
-	v, err := n.v.Exec(namespace)
-	if err != nil {
-		return nil, err
-	}
-	return nil, returnErr{v: v}
-}
+func (returnNode) node() {}
 
 func Return(v Node) Node { return returnNode{v: v} }
 
+// имя параметра для именованных аргументов, у шаблонов пустое
+func paramName(param Node) string {
+	switch t := unwrap(param).(type) {
+	case ident:
+		return t.v
+	case defaulted:
+		return paramName(t.target)
+	default:
+		return ""
+	}
+}
+
 type function struct {
 	params []Node
-	body   Node
+	//получатель оставшихся аргументов, может отсутствовать
+	rest Node
+	body Node
 }
 
-func (n function) Exec(namespace namespace.Namespace) (value.Value, error) {
-	names := make([]string, 0, len(n.params))
-	for _, param := range n.params {
-		id, ok := param.(ident)
-		if !ok {
-			return nil, idExpected()
-		}
-		names = append(names, id.v)
+func (function) node() {}
+
+func Function(body Node, params ...Node) Node {
+	return function{
+		body:   body,
+		params: params,
 	}
+}
 
-	return value.Function(
-		func(args ...value.Value) (value.Value, error) {
-			init := make(map[string]value.Value, len(names))
+// функция с переменным числом аргументов: (a, b, ...rest) -> {};
+// rest получает массив аргументов после params
+func VariadicFunction(body, rest Node, params ...Node) Node {
+	return function{
+		body:   body,
+		params: params,
+		rest:   rest,
+	}
+}
 
-			for i, name := range names {
-				if i >= len(args) {
-					init[name] = value.Null()
-					continue
-				}
+// ошибка, выброшенная throw
+type throwErr struct{ message, kind string }
 
-				init[name] = args[i]
-			}
+func (e throwErr) Error() string { return e.message }
 
-			res, err := n.body.Exec(namespace.New(init))
-			if err != nil {
-				if err, ok := err.(returnErr); ok {
-					return err.v, nil
-				}
+// значение ошибки для catch и для встраивающего кода;
+// позиция берется из ошибки, если она известна
+func ErrorOf(err error) value.Value {
+	//ошибка из импортированного модуля уже оформлена для вывода
+	var r *pos.ReportError
+	if errors.As(err, &r) {
+		err = r.Err
+	}
 
-				return nil, err
-			}
+	var line, column int64
+	var e *pos.Error
+	if errors.As(err, &e) {
+		line, column = int64(e.Pos.Line), int64(e.Pos.Column)
+	}
+
+	var t throwErr
+	if errors.As(err, &t) {
+		return value.Error(t.message, t.kind, line, column)
+	}
 
-			return res, nil
-		},
-	), nil
+	return value.Error(err.Error(), value.RuntimeErrorKind, line, column)
 }
 
-func Function(body Node, params ...Node) Node {
-	return function{
-		body:   body,
-		params: params,
-	}
+type throwNode struct{ v Node }
+
+func (throwNode) node() {}
+
+// throw v: значение ошибки выбрасывается как есть,
+// любое другое значение становится сообщением ошибки вида error
+func Throw(v Node) Node { return throwNode{v: v} }
+
+type tryNode struct {
+	body Node
+	//имя переменной с ошибкой, может быть пустым
+	name  string
+	catch Node
+	//выполняется всегда, может отсутствовать
+	finally Node
+}
+
+func (tryNode) node() {}
+
+// try body catch name {catch} finally {finally};
+// catch и finally могут быть nil, name может быть пустым
+func Try(body Node, name string, catch, finally Node) Node {
+	return tryNode{body: body, name: name, catch: catch, finally: finally}
 }
+
+// имена служебных переменных модуля; совпадают с ключевыми словами,
+// поэтому недоступны из программы
+const (
+	//функция (path) -> объект модуля, задается загрузчиком модулей
+	ImportName = "import"
+	//объект с экспортированными значениями модуля
+	ExportName = "export"
+)
+
+func importUnavailable() error {
+	return errors.New("import недоступен: загрузчик модулей не задан")
+}
+
+func exportUnavailable() error {
+	return errors.New("export может использоваться только в модуле")
+}
+
+// import "path" as name
+type importNode struct{ path, name string }
+
+func (importNode) node() {}
+
+func Import(path, name string) Node { return importNode{path: path, name: name} }
+
+// export name := v: создает переменные, как :=,
+// и добавляет их в объект экспорта модуля
+type exportNode struct{ name, v Node }
+
+func (exportNode) node() {}
+
+func Export(name, v Node) Node { return exportNode{name: name, v: v} }
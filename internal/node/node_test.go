@@ -1,12 +1,25 @@
 package node
 
 import (
+	"context"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/suprunchuksergey/dpl/internal/namespace"
+	"github.com/suprunchuksergey/dpl/internal/pos"
 	"github.com/suprunchuksergey/dpl/internal/value"
 	"testing"
+	"time"
 )
 
+// компилирует и выполняет узел
+func exec(n Node, namespace namespace.Namespace) (value.Value, error) {
+	code, err := Compile(n)
+	if err != nil {
+		return nil, err
+	}
+	return code.Run(namespace, nil)
+}
+
 func Test_Add(t *testing.T) {
 	tests := []struct {
 		node          Node
@@ -27,7 +40,7 @@ func Test_Add(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -58,7 +71,7 @@ func Test_Sub(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -89,7 +102,7 @@ func Test_Mul(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -122,7 +135,7 @@ func Test_Div(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -157,7 +170,7 @@ func Test_Mod(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -187,7 +200,41 @@ func Test_Concat(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_Interpolation(t *testing.T) {
+	n := namespace.New(map[string]value.Value{
+		"x": value.Int(27),
+		"y": value.Real(2.5),
+	})
+
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{Interpolation(), value.Text(""), nil},
+		{Interpolation(Text("x="), Ident("x")), value.Text("x=27"), nil},
+		{Interpolation(
+			Text("x="), Ident("x"),
+			Text(", y="), Add(Ident("y"), Int(1)),
+		), value.Text("x=27, y=3.5"), nil},
+		{Interpolation(Null(), Bool(true), Array(Int(1))), value.Text("nulltrue[1]"), nil},
+
+		{Interpolation(Text("z="), Ident("z")), nil, namespace.VarDoesNotExist("z")},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, n)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -236,7 +283,7 @@ func Test_Eq(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -285,7 +332,7 @@ func Test_Neq(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -334,7 +381,7 @@ func Test_Lt(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -383,7 +430,7 @@ func Test_Gt(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -434,7 +481,7 @@ func Test_Lte(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -485,7 +532,7 @@ func Test_Gte(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -532,10 +579,15 @@ func Test_And(t *testing.T) {
 		{And(Null(), Null()), value.Bool(false), nil},
 
 		{And(Function(nil), Bool(true)), nil, opNotDefined("and", value.FunctionType)},
+
+		//второй операнд не вычисляется
+		{And(Bool(false), Div(Int(1), Int(0))), value.Bool(false), nil},
+		{And(Null(), ElByIndex(Null(), Int(0))), value.Bool(false), nil},
+		{And(Bool(true), Div(Int(1), Int(0))), nil, divByZero()},
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, namespace.New(nil))
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -582,10 +634,69 @@ func Test_Or(t *testing.T) {
 		{Or(Null(), Null()), value.Bool(false), nil},
 
 		{Or(Function(nil), Bool(true)), nil, opNotDefined("or", value.FunctionType)},
+
+		//второй операнд не вычисляется
+		{Or(Bool(true), Div(Int(1), Int(0))), value.Bool(true), nil},
+		{Or(Bool(false), Div(Int(1), Int(0))), nil, divByZero()},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, namespace.New(nil))
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_AndValue(t *testing.T) {
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{AndValue(Int(1), Text("да")), value.Text("да"), nil},
+		{AndValue(Int(0), Text("да")), value.Int(0), nil},
+		{AndValue(Null(), ElByIndex(Null(), Int(0))), value.Null(), nil},
+		{AndValue(Array(Int(1)), ElByIndex(Array(Int(1)), Int(0))), value.Int(1), nil},
+		{AndValue(Text(""), Div(Int(1), Int(0))), value.Text(""), nil},
+
+		{AndValue(Function(nil), Bool(true)), nil, opNotDefined("&&", value.FunctionType)},
+		{AndValue(Bool(true), Function(nil)), nil, opNotDefined("&&", value.FunctionType)},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, namespace.New(nil))
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_OrValue(t *testing.T) {
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{OrValue(Text("имя"), Text("по умолчанию")), value.Text("имя"), nil},
+		{OrValue(Text(""), Text("по умолчанию")), value.Text("по умолчанию"), nil},
+		{OrValue(Null(), Int(0)), value.Int(0), nil},
+		{OrValue(Array(), Object()), value.Object(), nil},
+		{OrValue(Real(0.5), Div(Int(1), Int(0))), value.Real(0.5), nil},
+
+		{OrValue(Function(nil), Bool(true)), nil, opNotDefined("?:", value.FunctionType)},
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, namespace.New(nil))
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -626,7 +737,7 @@ func Test_Not(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -661,7 +772,7 @@ func Test_Neg(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -706,6 +817,16 @@ func Test_ElByIndex(t *testing.T) {
 		{ElByIndex(Object(KV{Text("value"), Int(27)}), Text("value")), value.Int(27), nil},
 		{ElByIndex(Object(KV{Text("[27]"), Text("value")}), Array(Int(27))), value.Text("value"), nil},
 
+		{ElByIndex(Text("value"), Int(-1)), value.Text("e"), nil},
+		{ElByIndex(Text("значение"), Slice(Int(1), Int(4), nil)), value.Text("нач"), nil},
+		{ElByIndex(Array(Int(1), Int(2), Int(3)), Slice(nil, nil, Int(-1))),
+			value.Array(value.Int(3), value.Int(2), value.Int(1)), nil},
+		{ElByIndex(Array(Int(1), Int(2), Int(3)), Slice(Add(Int(0), Int(1)), nil, nil)),
+			value.Array(value.Int(2), value.Int(3)), nil},
+
+		{ElByIndex(Array(Int(27)), Slice(Array(), nil, nil)), nil, wrongIndex(value.ArrayType)},
+		{ElByIndex(Object(), Slice(nil, nil, nil)), nil, errors.New("тип object не поддерживает срезы")},
+
 		{ElByIndex(Int(27), Int(0)), nil, opNotDefined("[<index>]", value.IntType)},
 		{ElByIndex(Real(2.7), Int(0)), nil, opNotDefined("[<index>]", value.RealType)},
 		{ElByIndex(Bool(true), Int(0)), nil, opNotDefined("[<index>]", value.BoolType)},
@@ -714,7 +835,37 @@ func Test_ElByIndex(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_Member(t *testing.T) {
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{Member(Object(KV{Text("name"), Text("сергей")}), "name"), value.Text("сергей"), nil},
+		{Member(Object(KV{Text("name"), Text("сергей")}), "age"), value.Null(), nil},
+		{Member(
+			Member(Object(KV{Text("a"), Object(KV{Text("b"), Int(27)})}), "a"),
+			"b",
+		), value.Int(27), nil},
+
+		{Member(Array(Int(27)), "name"), nil, opNotDefined(".name", value.ArrayType)},
+		{Member(Text("text"), "name"), nil, opNotDefined(".name", value.TextType)},
+		{Member(Null(), "name"), nil, opNotDefined(".name", value.NullType)},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -743,7 +894,7 @@ func Test_Ident(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(n)
+		v, err := exec(test.node, n)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -771,7 +922,7 @@ func Test_Create(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(n)
+		v, err := exec(test.node, n)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -787,6 +938,119 @@ func Test_Create(t *testing.T) {
 	}
 }
 
+func Test_Destructure(t *testing.T) {
+	tests := []struct {
+		target        Node
+		v             Node
+		expectedValue map[string]value.Value
+		expectedError error
+	}{
+		{
+			ArrayPattern(nil, Ident("a"), Ident("b")),
+			Array(Int(1), Text("два")),
+			map[string]value.Value{"a": value.Int(1), "b": value.Text("два")},
+			nil,
+		},
+		{
+			ArrayPattern(nil, Ident("a"), ArrayPattern(nil, Ident("b"), Ident("c"))),
+			Array(Int(1), Array(Int(2), Int(3))),
+			map[string]value.Value{"a": value.Int(1), "b": value.Int(2), "c": value.Int(3)},
+			nil,
+		},
+		{
+			ArrayPattern(nil, Ident("a"), Default(Ident("b"), Add(Ident("a"), Int(1)))),
+			Array(Int(1)),
+			map[string]value.Value{"a": value.Int(1), "b": value.Int(2)},
+			nil,
+		},
+		{
+			ArrayPattern(Ident("tail"), Ident("head")),
+			Array(Int(1), Int(2), Int(3)),
+			map[string]value.Value{"head": value.Int(1), "tail": value.Array(value.Int(2), value.Int(3))},
+			nil,
+		},
+		{
+			ArrayPattern(Ident("tail"), Ident("head")),
+			Array(Int(1)),
+			map[string]value.Value{"head": value.Int(1), "tail": value.Array()},
+			nil,
+		},
+		{
+			ObjectPattern(nil,
+				Prop{Key: "x", Target: Ident("x")},
+				Prop{Key: "y", Target: Ident("py")},
+				Prop{Key: "z", Target: Default(Ident("z"), Int(0))},
+				Prop{Key: "w", Target: Ident("w")},
+			),
+			Object(KV{Key: Text("x"), Value: Int(1)}, KV{Key: Text("y"), Value: Int(2)}),
+			map[string]value.Value{"x": value.Int(1), "py": value.Int(2), "z": value.Int(0), "w": value.Null()},
+			nil,
+		},
+		{
+			ObjectPattern(Ident("rest"), Prop{Key: "x", Target: ArrayPattern(nil, Ident("a"))}),
+			Object(KV{Key: Text("x"), Value: Array(Int(1))}, KV{Key: Text("y"), Value: Int(2)}),
+			map[string]value.Value{
+				"a":    value.Int(1),
+				"rest": value.Object(value.KV{Key: value.Text("y"), Value: value.Int(2)}),
+			},
+			nil,
+		},
+
+		{
+			ArrayPattern(nil, Ident("a"), Ident("b")),
+			Array(Int(1)),
+			nil, tooFewElements(2, 1),
+		},
+		{
+			ArrayPattern(nil, Ident("a"), Ident("b"), Default(Ident("c"), Int(0))),
+			Array(),
+			nil, tooFewElements(2, 0),
+		},
+		{
+			ArrayPattern(nil, Ident("a")),
+			Array(Int(1), Int(2)),
+			nil, tooManyElements(1, 2),
+		},
+		{
+			ArrayPattern(nil, Ident("a")),
+			Int(1),
+			nil, cannotDestructure(value.IntType, "массив"),
+		},
+		{
+			ObjectPattern(nil, Prop{Key: "x", Target: Ident("x")}),
+			Array(),
+			nil, cannotDestructure(value.ArrayType, "объект"),
+		},
+		{
+			ArrayPattern(nil, Ident("a"), Ident("a")),
+			Array(Int(1), Int(2)),
+			nil, namespace.VarAlreadyExists("a"),
+		},
+		{
+			ArrayPattern(nil, ElByIndex(Ident("a"), Int(0))),
+			Array(Int(1)),
+			nil, idExpected(),
+		},
+	}
+
+	for _, test := range tests {
+		n := namespace.New(nil)
+		_, err := exec(Create(test.target, test.v), n)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+
+			for name, expected := range test.expectedValue {
+				v, err := n.Get(name)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, v)
+			}
+		}
+	}
+}
+
 func Test_Set(t *testing.T) {
 	n := namespace.New(map[string]value.Value{
 		"surname": value.Text("не вишенка"),
@@ -794,9 +1058,13 @@ func Test_Set(t *testing.T) {
 			value.Int(625),
 			value.Int(3125),
 			value.Array(value.Bool(true)),
+			value.Object(value.KV{
+				Key:   value.Text("list"),
+				Value: value.Array(value.Int(0)),
+			}),
 		),
 		"object": value.Object(
-			value.KV{value.Text("value"), value.Int(23)},
+			value.KV{Key: value.Text("value"), Value: value.Int(23)},
 		),
 	})
 
@@ -825,12 +1093,30 @@ func Test_Set(t *testing.T) {
 			Bool(true),
 		), value.Bool(true), nil},
 
+		{Set(
+			Member(Ident("object"), "value"),
+			Int(1024),
+		), value.Int(1024), nil},
+		{Set(
+			Member(ElByIndex(Ident("array"), Int(3)), "x"),
+			Int(1),
+		), value.Int(1), nil},
+		{Set(
+			ElByIndex(Member(ElByIndex(Ident("array"), Int(3)), "list"), Int(0)),
+			Int(2),
+		), value.Int(2), nil},
+
+		{Set(Member(Ident("array"), "x"), Int(1)), nil, opNotDefined(".x", value.ArrayType)},
+		{Set(
+			Member(Member(Ident("object"), "value"), "x"),
+			Int(1),
+		), nil, opNotDefined(".x", value.IntType)},
 		{Set(Int(512), Int(23)), nil, idExpected()},
 		{Set(ElByIndex(Int(512), Int(0)), Int(23)), nil, idExpected()},
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(n)
+		v, err := exec(test.node, n)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -848,6 +1134,62 @@ func Test_Set(t *testing.T) {
 	}
 }
 
+func Test_Compound(t *testing.T) {
+	//счетчик вызовов next: индекс должен вычисляться один раз
+	calls := 0
+	next := value.Function(func(...value.Value) (value.Value, error) {
+		calls++
+		return value.Int(int64(calls - 1)), nil
+	})
+
+	n := namespace.New(map[string]value.Value{
+		"sum":    value.Int(10),
+		"text":   value.Text("а"),
+		"next":   next,
+		"matrix": value.Array(value.Array(value.Int(1), value.Int(2))),
+		"point":  value.Object(value.KV{Key: value.Text("x"), Value: value.Real(1.5)}),
+	})
+
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{Compound("+", Ident("sum"), Int(5)), value.Int(15), nil},
+		{Compound("-", Ident("sum"), Int(3)), value.Int(12), nil},
+		{Compound("*", Ident("sum"), Int(2)), value.Int(24), nil},
+		{Compound("/", Ident("sum"), Int(5)), value.Int(4), nil},
+		{Compound("%", Ident("sum"), Int(3)), value.Int(1), nil},
+		{Compound("||", Ident("text"), Text("б")), value.Text("аб"), nil},
+		{Compound("+", Member(Ident("point"), "x"), Int(1)), value.Real(2.5), nil},
+		{Compound("+",
+			ElByIndex(ElByIndex(Ident("matrix"), Call(Ident("next"))), Int(1)),
+			Int(40),
+		), value.Int(42), nil},
+
+		{Compound("+", Ident("missing"), Int(1)), nil, namespace.VarDoesNotExist("missing")},
+		{Compound("/", Ident("sum"), Int(0)), nil, errors.New("деление на ноль")},
+		{Compound("+", Int(1), Int(1)), nil, idExpected()},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, n)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+
+	assert.Equal(t, 1, calls)
+
+	v, err := n.Get("matrix")
+	assert.NoError(t, err)
+	assert.Equal(t, value.Array(value.Array(value.Int(1), value.Int(42))), v)
+}
+
 func Test_Block(t *testing.T) {
 	tests := []struct {
 		node          Node
@@ -869,7 +1211,7 @@ func Test_Block(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(nil)
+		v, err := exec(test.node, nil)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -926,7 +1268,7 @@ func Test_If(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(namespace.New(nil))
+		v, err := exec(test.node, namespace.New(nil))
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -986,10 +1328,94 @@ func Test_For(t *testing.T) {
 				Ident("i"),
 			), nil, idExpected(),
 		},
+		{
+			For(
+				[]Node{Ident("i")},
+				Int(10),
+				Block(
+					If(Branch{Cond: Eq(Ident("i"), Int(3)), Body: Block(Break(""))}),
+					Ident("i"),
+				),
+			), value.Int(2), nil,
+		},
+		{
+			For(
+				[]Node{Ident("i")},
+				Int(10),
+				Block(
+					If(Branch{Cond: Eq(Ident("i"), Int(9)), Body: Block(Continue(""))}),
+					Ident("i"),
+				),
+			), value.Int(8), nil,
+		},
+		{
+			Labeled("outer", For(
+				[]Node{Ident("i")},
+				Int(3),
+				For(
+					[]Node{Ident("j")},
+					Int(3),
+					Block(
+						If(Branch{Cond: Eq(Ident("i"), Int(1)), Body: Block(Break("outer"))}),
+						Add(Mul(Ident("i"), Int(10)), Ident("j")),
+					),
+				),
+			)), value.Int(2), nil,
+		},
+		{
+			For(
+				[]Node{Ident("i")},
+				Int(3),
+				Call(Function(Block(Break("")))),
+			), nil, breakErr{},
+		},
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(namespace.New(nil))
+		v, err := exec(test.node, namespace.New(nil))
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_While(t *testing.T) {
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{
+			While(
+				Lt(Ident("i"), Int(5)),
+				Set(Ident("i"), Add(Ident("i"), Int(1))),
+			), value.Int(5), nil,
+		},
+		{
+			While(Bool(false), Ident("i")), value.Null(), nil,
+		},
+		{
+			While(
+				Bool(true),
+				Block(
+					Set(Ident("i"), Add(Ident("i"), Int(1))),
+					If(Branch{Cond: Lt(Ident("i"), Int(3)), Body: Block(Continue(""))}),
+					If(Branch{Cond: Eq(Ident("i"), Int(7)), Body: Block(Break(""))}),
+					Ident("i"),
+				),
+			), value.Int(6), nil,
+		},
+		{
+			While(Ident("j"), Ident("i")), nil, errors.New("переменной с именем j не существует"),
+		},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, namespace.New(map[string]value.Value{"i": value.Int(0)}))
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
@@ -1011,6 +1437,10 @@ func Test_Call(t *testing.T) {
 		{Call(Ident("тестовая функция"), Text("полина")), value.Text("привет полина"), nil},
 		{Call(Ident("тестовая функция"), Text("полина"), Int(26)), value.Text("привет полина"), nil},
 
+		{Call(Ident("тестовая функция"), Spread(Array(Text("полина"), Int(26)))), value.Text("привет полина"), nil},
+		{Call(Ident("тестовая функция"), Spread(Array()), Spread(Text("ян"))), value.Text("привет я"), nil},
+		{Call(Ident("тестовая функция"), Spread(Int(26))), nil, cannotSpread(value.IntType, "аргументы вызова")},
+
 		{Call(Int(26)), nil, opNotDefined("вызов функции", value.IntType)},
 		{Call(Real(2.6)), nil, opNotDefined("вызов функции", value.RealType)},
 		{Call(Bool(true)), nil, opNotDefined("вызов функции", value.BoolType)},
@@ -1021,7 +1451,7 @@ func Test_Call(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(namespace.New(map[string]value.Value{
+		v, err := exec(test.node, namespace.New(map[string]value.Value{
 			"тестовая функция": value.Function(
 				func(args ...value.Value) (value.Value, error) {
 					n := value.Text("имя по умолчанию")
@@ -1104,13 +1534,531 @@ func Test_Function(t *testing.T) {
 			Int(729), Int(9),
 		),
 			value.Int(6561), nil},
+		{Call(
+			VariadicFunction(
+				Array(Ident("first"), Ident("rest")),
+				Ident("rest"),
+				Ident("first"),
+			),
+			Int(1), Int(2), Int(3),
+		),
+			value.Array(value.Int(1), value.Array(value.Int(2), value.Int(3))), nil},
+		{Call(
+			VariadicFunction(Ident("rest"), Ident("rest"), Ident("a"), Ident("b")),
+			Int(1),
+		),
+			value.Array(), nil},
+		{Call(
+			VariadicFunction(Ident("b"), ArrayPattern(nil, Ident("a"), Ident("b"))),
+			Int(1), Int(2),
+		),
+			value.Int(2), nil},
+		{Call(
+			VariadicFunction(Null(), ArrayPattern(nil, Ident("a"))),
+			Int(1), Int(2),
+		),
+			nil, tooManyElements(1, 2)},
+
+		{Call(
+			Function(
+				Array(Ident("w"), Ident("h")),
+				Default(Ident("w"), Int(640)), Default(Ident("h"), Ident("w")),
+			),
+		),
+			value.Array(value.Int(640), value.Int(640)), nil},
+		{Call(
+			Function(
+				Array(Ident("w"), Ident("h")),
+				Default(Ident("w"), Int(640)), Default(Ident("h"), Int(480)),
+			),
+			Int(800),
+		),
+			value.Array(value.Int(800), value.Int(480)), nil},
+		{Call(
+			Function(Ident("w"), Default(Ident("w"), Int(640))),
+			Null(),
+		),
+			value.Null(), nil},
+		{Call(
+			Function(Ident("x"), Default(Ident("x"), Ident("y"))),
+		),
+			nil, errors.New("переменной с именем y не существует")},
+
+		{Call(
+			Function(
+				Array(Ident("x"), Ident("y"), Ident("color")),
+				Ident("x"), Ident("y"), Default(Ident("color"), Text("black")),
+			),
+			Int(1), Named("color", Text("red")),
+		),
+			value.Array(value.Int(1), value.Null(), value.Text("red")), nil},
+		{Call(
+			Function(
+				Array(Ident("x"), Ident("y"), Ident("color")),
+				Ident("x"), Ident("y"), Default(Ident("color"), Text("black")),
+			),
+			Named("y", Int(2)),
+		),
+			value.Array(value.Null(), value.Int(2), value.Text("black")), nil},
+		{Call(
+			Function(Ident("x"), Ident("x")),
+			Named("y", Int(2)),
+		),
+			nil, unknownParam("y")},
+		{Call(
+			Function(Ident("x"), ArrayPattern(nil, Ident("x"))),
+			Named("x", Int(2)),
+		),
+			nil, unknownParam("x")},
+		{Call(
+			Function(Ident("x"), Ident("x")),
+			Int(1), Named("x", Int(2)),
+		),
+			nil, duplicateArg("x")},
+		{Call(
+			Function(Ident("x"), Ident("x")),
+			Named("x", Int(1)), Named("x", Int(2)),
+		),
+			nil, duplicateArg("x")},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, namespace.New(nil))
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_At(t *testing.T) {
+	span := func(line, column int) pos.Span {
+		return pos.Span{Start: pos.Pos{Line: line, Column: column}}
+	}
+
+	v, err := exec(At(span(1, 1), Add(Int(1), Int(2))), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, value.Int(3), v)
+
+	_, err = exec(At(span(1, 1), Div(Int(1), At(span(1, 5), Int(0)))), nil)
+	var e *pos.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, pos.Pos{Line: 1, Column: 1}, e.Pos)
+		assert.EqualError(t, err, divByZero().Error())
+	}
+
+	//позиция самого вложенного узла сохраняется
+	_, err = exec(At(span(1, 1), Add(Int(1), At(span(2, 3), Ident("x")))), namespace.New(nil))
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, pos.Pos{Line: 2, Column: 3}, e.Pos)
+	}
+
+	//return не привязывается к позиции
+	v, err = exec(Call(Function(Block(At(span(1, 1), Return(Int(27)))))), namespace.New(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, value.Int(27), v)
+
+	//узлы с участком исходного кода подходят в качестве получателей
+	v, err = exec(Create(At(span(1, 1), Ident("name")), Text("сергей")), namespace.New(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, value.Text("сергей"), v)
+}
+
+func Test_Spread(t *testing.T) {
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{Array(Spread(Array())), value.Array(), nil},
+		{Array(Int(0), Spread(Array(Int(1), Int(2))), Spread(Array(Int(3)))),
+			value.Array(value.Int(0), value.Int(1), value.Int(2), value.Int(3)), nil},
+		{Array(Spread(Text("ab"))), value.Array(value.Text("a"), value.Text("b")), nil},
+		{Array(Spread(Object())), nil, cannotSpread(value.ObjectType, "массив")},
+		{Array(Spread(Null())), nil, cannotSpread(value.NullType, "массив")},
+
+		{Object(
+			KV{Value: Spread(Object(
+				KV{Key: Text("x"), Value: Int(1)},
+				KV{Key: Text("y"), Value: Int(2)},
+			))},
+			KV{Key: Text("y"), Value: Int(3)},
+		), value.Object(
+			value.KV{Key: value.Text("x"), Value: value.Int(1)},
+			value.KV{Key: value.Text("y"), Value: value.Int(3)},
+		), nil},
+		{Object(
+			KV{Key: Text("x"), Value: Int(1)},
+			KV{Value: Spread(Object(KV{Key: Text("x"), Value: Int(2)}))},
+		), value.Object(
+			value.KV{Key: value.Text("x"), Value: value.Int(2)},
+		), nil},
+		{Object(KV{Value: Spread(Array())}), nil, cannotSpread(value.ArrayType, "объект")},
+		{Object(KV{Value: Spread(Int(1))}), nil, cannotSpread(value.IntType, "объект")},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, namespace.New(nil))
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_Try(t *testing.T) {
+	at := func(line, column int, n Node) Node {
+		return At(pos.Span{Start: pos.Pos{Line: line, Column: column}}, n)
+	}
+
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{Try(Block(Int(1)), "e", Block(Int(2)), nil), value.Int(1), nil},
+		{Try(Block(Div(Int(1), Int(0))), "e", Block(Ident("e")), nil),
+			value.Error("деление на ноль", value.RuntimeErrorKind, 0, 0), nil},
+		{Try(Block(at(2, 3, Throw(Text("ошибка")))), "e", Block(Ident("e")), nil),
+			value.Error("ошибка", value.ErrorKind, 2, 3), nil},
+		{Try(Block(Throw(Text("ошибка"))), "", Block(Int(2)), nil), value.Int(2), nil},
+
+		//повторно выброшенная ошибка сохраняет вид и позицию
+		{Try(
+			Block(Try(Block(at(2, 3, Throw(Text("ошибка")))), "e", Block(at(4, 1, Throw(Ident("e")))), nil)),
+			"e", Block(Ident("e")), nil,
+		), value.Error("ошибка", value.ErrorKind, 2, 3), nil},
+
+		//finally выполняется всегда, ошибка из него заменяет результат
+		{Try(Block(Int(1)), "", nil, Block(Int(2))), value.Int(1), nil},
+		{Try(Block(Throw(Text("ошибка"))), "", nil, Block(Int(2))), nil, errors.New("ошибка")},
+		{Try(Block(Int(1)), "", nil, Block(Throw(Text("из finally")))), nil, errors.New("из finally")},
+
+		//return проходит через try, не попадая в catch
+		{Call(Function(Block(
+			Try(Block(Return(Int(1))), "e", Block(Return(Int(2))), nil),
+			Int(3),
+		))), value.Int(1), nil},
+		{Call(Function(Block(
+			Try(Block(Return(Int(1))), "", nil, Block(Return(Int(2)))),
+		))), value.Int(2), nil},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, namespace.New(nil))
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_Import_Export(t *testing.T) {
+	exports := value.Object()
+	n := namespace.New(map[string]value.Value{
+		ImportName: value.Function(func(args ...value.Value) (value.Value, error) {
+			return value.Object(value.KV{Key: value.Text("path"), Value: args[0]}), nil
+		}),
+		ExportName: exports,
+	})
+
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		{Import("lib.dpl", "lib"), value.Object(
+			value.KV{Key: value.Text("path"), Value: value.Text("lib.dpl")},
+		), nil},
+		{Member(Ident("lib"), "path"), value.Text("lib.dpl"), nil},
+		{Import("lib.dpl", "lib"), nil, namespace.VarAlreadyExists("lib")},
+
+		{Export(Ident("x"), Int(1)), value.Int(1), nil},
+		{Export(ArrayPattern(nil, Ident("y"), Ident("z")), Array(Int(2), Int(3))),
+			value.Array(value.Int(2), value.Int(3)), nil},
+		{Ident("z"), value.Int(3), nil},
+		{Export(Ident("x"), Int(1)), nil, namespace.VarAlreadyExists("x")},
+		{Export(Member(Ident("lib"), "x"), Int(1)), nil, idExpected()},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, n)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+
+	assert.Equal(t, value.Object(
+		value.KV{Key: value.Text("x"), Value: value.Int(1)},
+		value.KV{Key: value.Text("y"), Value: value.Int(2)},
+		value.KV{Key: value.Text("z"), Value: value.Int(3)},
+	), exports)
+
+	_, err := exec(Import("lib.dpl", "lib"), namespace.New(nil))
+	assert.EqualError(t, err, importUnavailable().Error())
+	_, err = exec(Export(Ident("x"), Int(1)), namespace.New(nil))
+	assert.EqualError(t, err, exportUnavailable().Error())
+}
+
+func Test_Compile(t *testing.T) {
+	//код компилируется один раз и выполняется в разных пространствах имен
+	code, err := Compile(Block(
+		Create(Ident("res"), Int(0)),
+		For([]Node{Ident("i")}, Ident("n"), Block(
+			If(Branch{Eq(Ident("i"), Int(3)), Break("")}),
+			Compound("+", Ident("res"), Ident("i")),
+		)),
+		Ident("res"),
+	))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		n             value.Value
+		expectedValue value.Value
+		expectedError error
+	}{
+		{value.Int(2), value.Int(1), nil},
+		{value.Int(10), value.Int(3), nil},
+		{value.Bool(true), nil, errors.New("тип bool не поддерживает итерацию")},
+	}
+
+	for _, test := range tests {
+		v, err := code.Run(namespace.New(map[string]value.Value{"n": test.n}), nil)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+}
+
+func Test_Resolve(t *testing.T) {
+	tests := []struct {
+		node          Node
+		expectedValue value.Value
+		expectedError error
+	}{
+		//функции видят переменные, объявленные после них
+		{Block(
+			Create(Ident("f"), Function(Block(Return(Call(Ident("g")))))),
+			Create(Ident("g"), Function(Block(Return(Int(1))))),
+			Call(Ident("f")),
+		), value.Int(1), nil},
+
+		//каждая итерация получает собственные переменные
+		{Block(
+			Create(Ident("fs"), Array()),
+			For([]Node{Ident("i")}, Int(3), Block(
+				Set(Ident("fs"), Array(Spread(Ident("fs")), Function(Block(Return(Ident("i")))))),
+			)),
+			Call(ElByIndex(Ident("fs"), Int(1))),
+		), value.Int(1), nil},
+
+		//присваивание в функции изменяет внешнюю переменную
+		{Block(
+			Create(Ident("n"), Int(0)),
+			Create(Ident("inc"), Function(Block(Compound("+", Ident("n"), Int(1))))),
+			Call(Ident("inc")),
+			Call(Ident("inc")),
+			Ident("n"),
+		), value.Int(2), nil},
+
+		//переменная вложенного пространства недоступна после него
+		{Block(
+			If(Branch{Bool(true), Create(Ident("x"), Int(1))}),
+			Ident("x"),
+		), nil, namespace.VarDoesNotExist("x")},
+
+		//тело try и finally - отдельные пространства
+		{Block(
+			Create(Ident("x"), Int(1)),
+			Try(Create(Ident("x"), Int(2)), "e", Null(), Create(Ident("x"), Int(3))),
+			Ident("x"),
+		), value.Int(1), nil},
+		{Block(
+			Try(Create(Ident("x"), Int(1)), "e", Null(), nil),
+			Try(Create(Ident("x"), Int(2)), "e", Null(), nil),
+		), value.Int(2), nil},
+		{Block(
+			Try(Create(Ident("x"), Int(1)), "e", Ident("x"), nil),
+		), nil, namespace.VarDoesNotExist("x")},
+		{Block(
+			Try(Null(), "", nil, Create(Ident("x"), Int(1))),
+			Ident("x"),
+		), nil, namespace.VarDoesNotExist("x")},
+		{Function(Null(), Ident("a"), Ident("a")), nil, namespace.VarAlreadyExists("a")},
+		{Create(ArrayPattern(nil, Ident("a"), Ident("a")), Array(Int(1), Int(2))), nil, namespace.VarAlreadyExists("a")},
+
+		//альтернативные пути объявляют одну переменную один раз
+		{Block(
+			Create(ArrayPattern(nil, Ident("a"), Default(Ident("b"), Int(2))), Array(Int(1))),
+			Array(Ident("a"), Ident("b")),
+		), value.Array(value.Int(1), value.Int(2)), nil},
+	}
+
+	for _, test := range tests {
+		v, err := exec(test.node, namespace.New(nil))
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+
+	//неизвестная переменная обнаруживается до выполнения
+	n := namespace.New(nil)
+	_, err := exec(Block(
+		Create(Ident("a"), Int(1)),
+		Create(Ident("f"), Function(Block(Return(Ident("missing"))))),
+	), n)
+	assert.EqualError(t, err, namespace.VarDoesNotExist("missing").Error())
+	_, err = n.Get("a")
+	assert.Error(t, err)
+
+	//переменные верхнего уровня остаются в пространстве имен после выполнения
+	_, err = exec(Block(Create(Ident("a"), Int(1)), Set(Ident("b"), Int(2))), n)
+	assert.NoError(t, err)
+	for name, expected := range map[string]value.Value{"a": value.Int(1), "b": value.Int(2)} {
+		v, err := n.Get(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, v)
+	}
+}
+
+func Test_Optimize(t *testing.T) {
+	span := pos.Span{Start: pos.Pos{Line: 1, Column: 5}, End: pos.Pos{Line: 1, Column: 10}}
+
+	tests := []struct {
+		node     Node
+		expected Node
+	}{
+		{Mul(Mul(Int(2), Real(3.14)), Ident("r")), Mul(Real(6.28), Ident("r"))},
+		{Concat(Text("a"), Text("b")), Text("ab")},
+		{Interpolation(Text("x="), Add(Int(1), Int(1))), Text("x=2")},
+		{Lt(Int(1), Real(1.5)), Bool(true)},
+		{Neg(Sub(Int(2), Int(5))), Int(3)},
+
+		//ошибки возникают при выполнении
+		{Div(Int(1), Sub(Int(2), Int(2))), Div(Int(1), Int(0))},
+		{At(span, Mod(Int(1), Int(0))), At(span, Mod(Int(1), Int(0)))},
+		{Div(Real(1), Null()), Div(Real(1), Null())},
+
+		{Not(Not(Lt(Ident("a"), Int(1)))), Lt(Ident("a"), Int(1))},
+		{Not(Not(Ident("a"))), Not(Not(Ident("a")))},
+		{Not(Not(Int(5))), Bool(true)},
+
+		{And(Bool(false), Div(Int(1), Int(0))), Bool(false)},
+		{Or(Int(1), Ident("a")), Bool(true)},
+		{AndValue(Text(""), Ident("a")), Text("")},
+		{OrValue(Null(), Ident("a")), OrValue(Null(), Ident("a"))},
+		{And(Bool(true), Eq(Ident("a"), Int(1))), Eq(Ident("a"), Int(1))},
+
+		{If(
+			Branch{Bool(false), Int(1)},
+			Branch{Ident("a"), Int(2)},
+			Branch{Bool(true), Int(3)},
+			Branch{Ident("b"), Int(4)},
+		), If(Branch{Ident("a"), Int(2)}, Branch{Bool(true), Int(3)})},
+		{If(Branch{Int(0), Int(1)}), Null()},
+		{While(Bool(false), Ident("a")), Null()},
+
+		//переменная, объявленная константой и не изменяемая, подставляется
+		{Block(
+			Create(Ident("pi"), Mul(Real(3.14), Int(1))),
+			Int(1),
+			Function(Block(Return(Mul(Ident("pi"), Int(2))))),
+		), Block(
+			Create(Ident("pi"), Real(3.14)),
+			Function(Block(Return(Real(6.28)))),
+		)},
+		{Block(
+			Create(Ident("n"), Int(1)),
+			Set(Ident("n"), Int(2)),
+			Ident("n"),
+		), Block(
+			Create(Ident("n"), Int(1)),
+			Set(Ident("n"), Int(2)),
+			Ident("n"),
+		)},
+		{Block(
+			Create(Ident("f"), Function(Block(Return(Ident("n"))))),
+			Create(Ident("n"), Int(1)),
+			Ident("n"),
+		), Block(
+			Create(Ident("f"), Function(Block(Return(Ident("n"))))),
+			Create(Ident("n"), Int(1)),
+			Int(1),
+		)},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, Optimize(test.node))
+	}
+
+	//ошибка остается на своем месте
+	_, err := exec(Optimize(Block(
+		Create(Ident("a"), Int(1)),
+		At(span, Div(Ident("a"), Sub(Int(2), Int(2)))),
+	)), namespace.New(nil))
+	assert.Equal(t, pos.Wrap(divByZero(), span.Start), err)
+}
+
+func Test_Limits(t *testing.T) {
+	//бесконечная рекурсия
+	recursion := Block(
+		Create(Ident("f"), Function(Block(Return(Call(Ident("f")))))),
+		Call(Ident("f")),
+	)
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		node          Node
+		budget        *Budget
+		expectedValue value.Value
+		expectedError error
+	}{
+		{While(Bool(true), Block()), NewBudget(nil, Limits{Steps: 1000}),
+			nil, &StepLimitError{Limit: 1000}},
+		{For([]Node{Ident("i")}, Int(10), Block()), NewBudget(nil, Limits{Steps: 1000}),
+			value.Null(), nil},
+		{recursion, NewBudget(nil, Limits{Depth: 50}), nil, &DepthLimitError{Limit: 50}},
+		{recursion, NewBudget(nil, Limits{}), nil, &DepthLimitError{Limit: DefaultDepth}},
+		{While(Bool(true), Block()), NewBudget(nil, Limits{Timeout: time.Millisecond}),
+			nil, &TimeoutError{Timeout: time.Millisecond}},
+		{While(Bool(true), Block()), NewBudget(canceled, Limits{}),
+			nil, &CanceledError{Err: context.Canceled}},
+
+		//try не перехватывает ошибку ограничения
+		{Try(Block(While(Bool(true), Block())), "e", Block(Int(1)), Block(Int(2))),
+			NewBudget(nil, Limits{Steps: 1000}), nil, &StepLimitError{Limit: 1000}},
 	}
 
 	for _, test := range tests {
-		v, err := test.node.Exec(namespace.New(nil))
+		code, err := Compile(test.node)
+		assert.NoError(t, err)
+		v, err := code.Run(namespace.New(nil), test.budget)
 
 		if test.expectedError != nil {
 			assert.EqualError(t, err, test.expectedError.Error())
+			assert.True(t, IsLimit(err))
 		} else {
 			assert.NoError(t, err)
 			assert.Equal(t, test.expectedValue, v)
@@ -0,0 +1,433 @@
+package node
+
+import (
+	"github.com/suprunchuksergey/dpl/internal/value"
+	"strings"
+)
+
+// Optimize упрощает дерево перед компиляцией: вычисляет выражения
+// из констант, удаляет ветви if и циклы while, которые никогда
+// не выполняются, сокращает not not x и подставляет значения переменных,
+// которые объявлены константой и не изменяются. Выражение, вычисление
+// которого приводит к ошибке (1 / 0), остается в дереве: ошибка возникает
+// при выполнении в том же месте
+func Optimize(n Node) Node {
+	o := &optimizer{
+		decls:    make(map[string]int),
+		assigned: make(map[string]bool),
+	}
+	n = o.node(n)
+
+	//объявления и присваивания известны после первого прохода;
+	//подстановка значений может сделать константами новые выражения
+	for name, count := range o.decls {
+		if count == 1 && !o.assigned[name] {
+			if o.constants == nil {
+				o.constants = make(map[string]bool)
+			}
+			o.constants[name] = true
+		}
+	}
+	if o.constants == nil {
+		return n
+	}
+	o.known = make(map[string]value.Value)
+	return o.node(n)
+}
+
+type optimizer struct {
+	//число объявлений и присваивания переменных по имени во всей программе
+	decls    map[string]int
+	assigned map[string]bool
+
+	//переменные, объявленные один раз и не изменяемые
+	constants map[string]bool
+	//значения переменных-констант, объявленных выше в текущем блоке
+	known map[string]value.Value
+}
+
+// значение узла, если оно известно до выполнения; массивы и объекты
+// изменяемы и не считаются константами
+func constant(n Node) (value.Value, bool) {
+	v, ok := unwrap(n).(valueNode)
+	if !ok {
+		return nil, false
+	}
+	switch v.v.Type() {
+	case value.IntType, value.RealType, value.TextType, value.BoolType, value.NullType:
+		return v.v, true
+	}
+	return nil, false
+}
+
+// значение узла всегда имеет тип bool
+func isBool(n Node) bool {
+	switch n := unwrap(n).(type) {
+	case valueNode:
+		return n.v.Type() == value.BoolType
+	case eq, neq, lt, gt, lte, gte, and, or, not:
+		return true
+	}
+	return false
+}
+
+// условие, которое всегда истинно: else и if true
+func always(n Node) bool {
+	v, ok := constant(n)
+	if !ok {
+		return false
+	}
+	b, err := v.Bool()
+	return err == nil && b
+}
+
+// условие, которое всегда ложно
+func never(n Node) bool {
+	v, ok := constant(n)
+	if !ok {
+		return false
+	}
+	b, err := v.Bool()
+	return err == nil && !b
+}
+
+func (o *optimizer) node(n Node) Node {
+	switch n := n.(type) {
+	case nil:
+		return nil
+	case spanned:
+		return spanned{n: o.node(n.n), span: n.span}
+
+	case ident:
+		if v, ok := o.known[n.v]; ok {
+			return valueNode{v: v}
+		}
+		return n
+
+	case add:
+		return o.fold(n.binary, opAdd, func(b binary) Node { return add{b} })
+	case sub:
+		return o.fold(n.binary, opSub, func(b binary) Node { return sub{b} })
+	case mul:
+		return o.fold(n.binary, opMul, func(b binary) Node { return mul{b} })
+	case div:
+		return o.fold(n.binary, opDiv, func(b binary) Node { return div{b} })
+	case mod:
+		return o.fold(n.binary, opMod, func(b binary) Node { return mod{b} })
+	case concat:
+		return o.fold(n.binary, opConcat, func(b binary) Node { return concat{b} })
+	case eq:
+		return o.fold(n.binary, opEq, func(b binary) Node { return eq{b} })
+	case neq:
+		return o.fold(n.binary, opNeq, func(b binary) Node { return neq{b} })
+	case lt:
+		return o.fold(n.binary, opLt, func(b binary) Node { return lt{b} })
+	case gt:
+		return o.fold(n.binary, opGt, func(b binary) Node { return gt{b} })
+	case lte:
+		return o.fold(n.binary, opLte, func(b binary) Node { return lte{b} })
+	case gte:
+		return o.fold(n.binary, opGte, func(b binary) Node { return gte{b} })
+
+	case and:
+		return o.logic(n.binary, "and", false, true, func(b binary) Node { return and{b} })
+	case andValue:
+		return o.logic(n.binary, "&&", false, false, func(b binary) Node { return andValue{b} })
+	case or:
+		return o.logic(n.binary, "or", true, true, func(b binary) Node { return or{b} })
+	case orValue:
+		return o.logic(n.binary, "?:", true, false, func(b binary) Node { return orValue{b} })
+
+	case neg:
+		v := o.node(n.v)
+		if x, ok := constant(v); ok {
+			if res, err := negate(x); err == nil {
+				return valueNode{v: res}
+			}
+		}
+		return neg{unary{v}}
+	case not:
+		v := o.node(n.v)
+		if x, ok := constant(v); ok && checkType("not", x, logicWhitelist) == nil {
+			if b, err := x.Bool(); err == nil {
+				return valueNode{v: value.Bool(!b)}
+			}
+		}
+		//not not x равно x, только если x уже имеет тип bool
+		if inner, ok := unwrap(v).(not); ok && isBool(inner.v) {
+			return inner.v
+		}
+		return not{unary{v}}
+
+	case interpolation:
+		parts := o.list(n.parts)
+		var str strings.Builder
+		for _, part := range parts {
+			v, ok := constant(part)
+			if !ok {
+				return interpolation{parts: parts}
+			}
+			str.WriteString(v.Text())
+		}
+		return valueNode{v: value.Text(str.String())}
+
+	case spread:
+		return spread{v: o.node(n.v)}
+	case named:
+		return named{name: n.name, v: o.node(n.v)}
+	case array:
+		return array{nodes: o.list(n.nodes)}
+	case object:
+		pairs := make([]KV, 0, len(n.pairs))
+		for _, pair := range n.pairs {
+			pairs = append(pairs, KV{Key: o.node(pair.Key), Value: o.node(pair.Value)})
+		}
+		return object{pairs: pairs}
+	case elByIndex:
+		return elByIndex{v: o.node(n.v), index: o.node(n.index)}
+	case sliceNode:
+		return sliceNode{start: o.node(n.start), end: o.node(n.end), step: o.node(n.step)}
+	case member:
+		return member{v: o.node(n.v), name: n.name}
+
+	case create:
+		return create{name: o.target(n.name, true), v: o.node(n.v)}
+	case set:
+		return set{name: o.target(n.name, false), v: o.node(n.v)}
+	case compound:
+		return compound{op: n.op, name: o.target(n.name, false), v: o.node(n.v)}
+	case exportNode:
+		return exportNode{name: o.target(n.name, true), v: o.node(n.v)}
+	case importNode:
+		o.decls[n.name]++
+		return n
+
+	case block:
+		return o.block(n)
+	case branch:
+		return o.branch(n)
+	case loop:
+		return loop{
+			label:      n.label,
+			recipients: o.targets(n.recipients),
+			from:       o.node(n.from),
+			body:       o.node(n.body),
+		}
+	case whileLoop:
+		cond := o.node(n.cond)
+		//тело не выполняется, результат цикла - null
+		if never(cond) {
+			return valueNode{v: value.Null()}
+		}
+		return whileLoop{label: n.label, cond: cond, body: o.node(n.body)}
+
+	case call:
+		return call{target: o.node(n.target), args: o.list(n.args)}
+	case returnNode:
+		return returnNode{v: o.node(n.v)}
+	case function:
+		f := function{params: o.targets(n.params), body: o.node(n.body)}
+		if n.rest != nil {
+			f.rest = o.target(n.rest, true)
+		}
+		return f
+
+	case throwNode:
+		return throwNode{v: o.node(n.v)}
+	case tryNode:
+		if n.name != "" {
+			o.decls[n.name]++
+		}
+		return tryNode{
+			body:    o.node(n.body),
+			name:    n.name,
+			catch:   o.node(n.catch),
+			finally: o.node(n.finally),
+		}
+
+	default:
+		//значения, break, continue и шаблоны вне объявления
+		return n
+	}
+}
+
+func (o *optimizer) list(nodes []Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	res := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		res = append(res, o.node(n))
+	}
+	return res
+}
+
+// получатель объявления (declare) или присваивания: идентификаторы
+// получателя не подставляются, упрощаются только значения по умолчанию
+// и индексы
+func (o *optimizer) target(n Node, declare bool) Node {
+	switch t := n.(type) {
+	case spanned:
+		return spanned{n: o.target(t.n, declare), span: t.span}
+	case ident:
+		if declare {
+			o.decls[t.v]++
+		} else {
+			o.assigned[t.v] = true
+		}
+		return t
+	case arrayPattern:
+		p := arrayPattern{elems: make([]Node, 0, len(t.elems))}
+		for _, elem := range t.elems {
+			p.elems = append(p.elems, o.target(elem, declare))
+		}
+		if t.rest != nil {
+			p.rest = o.target(t.rest, declare)
+		}
+		return p
+	case objectPattern:
+		p := objectPattern{props: make([]Prop, 0, len(t.props))}
+		for _, prop := range t.props {
+			p.props = append(p.props, Prop{Key: prop.Key, Target: o.target(prop.Target, declare)})
+		}
+		if t.rest != nil {
+			p.rest = o.target(t.rest, declare)
+		}
+		return p
+	case defaulted:
+		return defaulted{target: o.target(t.target, declare), v: o.node(t.v)}
+	case elByIndex:
+		return elByIndex{v: o.target(t.v, declare), index: o.node(t.index)}
+	case member:
+		return member{v: o.target(t.v, declare), name: t.name}
+	default:
+		return n
+	}
+}
+
+func (o *optimizer) targets(nodes []Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	res := make([]Node, 0, len(nodes))
+	for _, n := range nodes {
+		res = append(res, o.target(n, true))
+	}
+	return res
+}
+
+// вычисляет бинарный оператор над константами так же, как машина
+func (o *optimizer) fold(n binary, op opcode, build func(binary) Node) Node {
+	n = binary{a: o.node(n.a), b: o.node(n.b)}
+
+	a, ok := constant(n.a)
+	if !ok {
+		return build(n)
+	}
+	b, ok := constant(n.b)
+	if !ok {
+		return build(n)
+	}
+
+	var v value.Value
+	var err error
+	switch op {
+	case opConcat:
+		v = value.Text(a.Text() + b.Text())
+	case opEq, opNeq, opLt, opGt, opLte, opGte:
+		v, err = comparison(op, a, b)
+	default:
+		v, err = arithmetic(op, a, b)
+	}
+	if err != nil {
+		return build(n)
+	}
+	return valueNode{v: v}
+}
+
+// a and b, a && b, a or b, a ?: b с известным первым операндом
+func (o *optimizer) logic(n binary, op string, stop, toBool bool, build func(binary) Node) Node {
+	n = binary{a: o.node(n.a), b: o.node(n.b)}
+
+	a, ok := constant(n.a)
+	if !ok || checkType(op, a, logicWhitelist) != nil {
+		return build(n)
+	}
+	x, err := a.Bool()
+	if err != nil {
+		return build(n)
+	}
+	if x == stop {
+		if toBool {
+			return valueNode{v: value.Bool(x)}
+		}
+		return n.a
+	}
+
+	//результат определяет второй операнд
+	if b, ok := constant(n.b); ok && checkType(op, b, logicWhitelist) == nil {
+		if y, err := b.Bool(); err == nil {
+			if toBool {
+				return valueNode{v: value.Bool(y)}
+			}
+			return n.b
+		}
+	}
+	if isBool(n.b) {
+		return n.b
+	}
+	return build(n)
+}
+
+// конструкции блока; переменная-константа подставляется в конструкции,
+// которые следуют за ее объявлением, до конца блока
+func (o *optimizer) block(n block) Node {
+	cmds := make([]Node, 0, len(n.cmds))
+	var declared []string
+
+	for i, cmd := range n.cmds {
+		cmd = o.node(cmd)
+
+		//значение константы используется, только если она последняя
+		if _, ok := constant(cmd); ok && i != len(n.cmds)-1 {
+			continue
+		}
+
+		if c, ok := unwrap(cmd).(create); ok {
+			if id, ok := unwrap(c.name).(ident); ok && o.constants[id.v] {
+				if v, ok := constant(c.v); ok {
+					o.known[id.v] = v
+					declared = append(declared, id.v)
+				}
+			}
+		}
+
+		cmds = append(cmds, cmd)
+	}
+
+	for _, name := range declared {
+		delete(o.known, name)
+	}
+	return block{cmds: cmds}
+}
+
+// ветви с ложным условием удаляются, ветвь с истинным
+// условием становится последней
+func (o *optimizer) branch(n branch) Node {
+	branches := make([]Branch, 0, len(n.branches))
+	for _, b := range n.branches {
+		cond, body := o.node(b.Cond), o.node(b.Body)
+		if never(cond) {
+			continue
+		}
+		branches = append(branches, Branch{Cond: cond, Body: body})
+		if always(cond) {
+			break
+		}
+	}
+
+	if len(branches) == 0 {
+		return valueNode{v: value.Null()}
+	}
+	return branch{branches: branches}
+}
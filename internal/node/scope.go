@@ -0,0 +1,485 @@
+package node
+
+import (
+	"github.com/suprunchuksergey/dpl/internal/namespace"
+	"github.com/suprunchuksergey/dpl/internal/pos"
+	"github.com/suprunchuksergey/dpl/internal/value"
+	"maps"
+)
+
+// разрешение имен: каждый идентификатор при компиляции связывается
+// с ячейкой (глубина, слот) кадра пространства имен; имена, не найденные
+// в пространствах программы, берутся из namespace.Namespace при выполнении
+
+// переменная пространства
+type variable struct {
+	name string
+	//создана присваиванием x = v, а не объявлением: если при выполнении
+	//ячейка пуста, x ищется в глобальном пространстве, как раньше
+	dynamic bool
+}
+
+// пространство имен при компиляции: программа, тело функции, итерация
+// цикла, тело if и while, catch. Все переменные пространства известны
+// при входе в него, поэтому функция может обращаться к переменной,
+// объявленной после нее
+type scope struct {
+	parent *scope
+	vars   []variable
+	slots  map[string]int32
+	//переменные, объявленные до текущего места программы
+	visible map[string]bool
+	//пространство вызова функции
+	function bool
+}
+
+// кадр пространства создается, только если в нем есть переменные
+func (s *scope) frame() bool { return len(s.vars) > 0 }
+
+func (s *scope) add(name string, dynamic bool) {
+	if _, ok := s.slots[name]; ok {
+		return
+	}
+	s.slots[name] = int32(len(s.vars))
+	s.vars = append(s.vars, variable{name: name, dynamic: dynamic})
+}
+
+// ячейка переменной относительно текущего кадра
+type binding struct{ depth, slot int32 }
+
+// результат поиска имени: ячейки, которые при выполнении могут быть
+// еще пусты, в порядке поиска, и ячейка, в которой переменная точно есть;
+// если ее нет (found == false), имя ищется в глобальном пространстве
+type resolution struct {
+	maybe []binding
+	slot  binding
+	found bool
+}
+
+// находит переменную программы: в коде, выполняемом по порядку, видны
+// переменные, объявленные выше; в теле функции - все переменные
+// внешних пространств, так как функция вызывается позже. Переменная,
+// объявленная после функции, может быть еще не создана при ее вызове
+// или скрывать внешнюю переменную с тем же именем, поэтому поиск
+// продолжается во внешних пространствах, как и для переменных,
+// созданных присваиванием
+func (c *compiler) lookup(name string) resolution {
+	var (
+		r     resolution
+		depth int32
+	)
+	crossed := false
+	for s := c.scope; s != nil; s = s.parent {
+		if slot, ok := s.slots[name]; ok {
+			b := binding{depth: depth, slot: slot}
+			switch {
+			case !s.vars[slot].dynamic && s.visible[name]:
+				r.slot, r.found = b, true
+				return r
+			case s.vars[slot].dynamic || crossed:
+				r.maybe = append(r.maybe, b)
+			}
+		}
+		if s.frame() {
+			depth++
+		}
+		if s.function {
+			crossed = true
+		}
+	}
+	return r
+}
+
+// входит в пространство; declared - получатели, объявляемые
+// пространством (параметры, получатели цикла), body - его содержимое
+func (c *compiler) enterScope(function bool, declared []Node, body ...Node) *scope {
+	s := &scope{
+		parent:   c.scope,
+		slots:    make(map[string]int32),
+		visible:  make(map[string]bool),
+		function: function,
+	}
+	c.scope = s
+
+	var assigned []string
+	declare := func(name string) { s.add(name, false) }
+	assign := func(name string) { assigned = append(assigned, name) }
+
+	for _, target := range declared {
+		collectTargets(target, declare, assign)
+	}
+	for _, n := range body {
+		collect(n, declare, assign)
+	}
+
+	//присваивание необъявленной переменной создает ее в этом пространстве
+	for _, name := range assigned {
+		if _, ok := s.slots[name]; ok {
+			continue
+		}
+		if !c.lookup(name).found {
+			s.add(name, true)
+		}
+	}
+
+	return s
+}
+
+func (c *compiler) exitScope() { c.scope = c.scope.parent }
+
+// входит в пространство тела if, цикла или catch
+func (c *compiler) pushScope(declared []Node, body Node) {
+	s := c.enterScope(false, declared, body)
+	if s.frame() {
+		c.emit(opPushScope, int32(len(s.vars)), 0)
+	}
+}
+
+func (c *compiler) popScope() {
+	if c.scope.frame() {
+		c.emit(opPopScope, 0, 0)
+	}
+	c.exitScope()
+}
+
+// компилирует пути кода, из которых выполняется только один:
+// каждый путь может объявить одни и те же переменные
+func (c *compiler) alternatives(paths ...func()) {
+	before := c.scope.visible
+	after := maps.Clone(before)
+	for _, path := range paths {
+		c.scope.visible = maps.Clone(before)
+		path()
+		maps.Copy(after, c.scope.visible)
+	}
+	c.scope.visible = after
+}
+
+// ошибка компиляции; сообщается первая
+func (c *compiler) fail(err error) {
+	if c.root.err == nil {
+		c.root.err = pos.Wrap(err, c.pos)
+	}
+}
+
+// связывает значение на вершине стека с новой переменной
+// текущего пространства
+func (c *compiler) declare(name string, bind opcode) {
+	s := c.scope
+	if s.visible[name] {
+		c.fail(namespace.VarAlreadyExists(name))
+	}
+	s.visible[name] = true
+
+	//переменные верхнего уровня не должны существовать
+	//в пространстве имен, в котором выполняется программа
+	if s.parent == nil {
+		c.root.code.checks = append(c.root.code.checks, check{name: name, pos: c.pos, declared: true})
+	}
+
+	c.emit(bind, s.slots[name], c.name(name))
+}
+
+// присваивает значение на вершине стека переменной; create - переменная,
+// которой нет, создается в текущем пространстве, иначе изменяется
+// глобальная переменная
+func (c *compiler) assign(name string, create bool) {
+	r := c.lookup(name)
+	jumps := c.emitMaybe(opStoreSet, r)
+	switch slot, local := c.scope.slots[name]; {
+	case r.found:
+		c.emitVar(opStore, r.slot, name)
+	case create && local:
+		c.emitVar(opStoreDynamic, binding{slot: slot}, name)
+	default:
+		c.emit(opSetGlobal, c.name(name), 0)
+	}
+	c.patchMaybe(jumps)
+}
+
+// кладет на стек значение переменной
+func (c *compiler) load(name string) {
+	r := c.lookup(name)
+	jumps := c.emitMaybe(opLoadSet, r)
+	switch {
+	case r.found:
+		c.emitVar(opLoad, r.slot, name)
+	default:
+		//переменная, которая может быть в ячейках программы,
+		//проверяется только при выполнении
+		if len(r.maybe) == 0 && !c.root.globals[name] {
+			c.root.globals[name] = true
+			c.root.code.checks = append(c.root.code.checks, check{name: name, pos: c.pos})
+		}
+		c.emit(opGetGlobal, c.name(name), 0)
+	}
+	c.patchMaybe(jumps)
+}
+
+// проверяет ячейки, которые могут быть пусты: первая заполненная
+// используется, остальной поиск пропускается
+func (c *compiler) emitMaybe(op opcode, r resolution) []int {
+	jumps := make([]int, 0, len(r.maybe))
+	for _, b := range r.maybe {
+		jumps = append(jumps, c.emit(op, b.depth, b.slot))
+	}
+	return jumps
+}
+
+func (c *compiler) patchMaybe(jumps []int) {
+	for _, i := range jumps {
+		c.code.ops[i].c = c.here()
+	}
+}
+
+// собирает переменные, которые узел создает в текущем пространстве;
+// вложенные пространства (функции, тела if, циклов и catch) не просматриваются
+func collect(n Node, declare, assign func(name string)) {
+	switch n := unwrap(n).(type) {
+	case nil:
+	case create:
+		collectTargets(n.name, declare, assign)
+		collect(n.v, declare, assign)
+	case exportNode:
+		collectTargets(n.name, declare, assign)
+		collect(n.v, declare, assign)
+	case importNode:
+		declare(n.name)
+	case set:
+		collectAssigned(n.name, declare, assign)
+		collect(n.v, declare, assign)
+	case compound:
+		collectIndexes(n.name, declare, assign)
+		collect(n.v, declare, assign)
+
+	case function:
+	case branch:
+		for _, b := range n.branches {
+			collect(b.Cond, declare, assign)
+		}
+	case loop:
+		collect(n.from, declare, assign)
+	case whileLoop:
+		collect(n.cond, declare, assign)
+	case tryNode:
+
+	default:
+		for _, child := range children(n) {
+			collect(child, declare, assign)
+		}
+	}
+}
+
+// переменные получателя объявления; значения по умолчанию
+// вычисляются в том же пространстве
+func collectTargets(target Node, declare, assign func(name string)) {
+	switch t := unwrap(target).(type) {
+	case ident:
+		declare(t.v)
+	case arrayPattern:
+		for _, elem := range t.elems {
+			collectTargets(elem, declare, assign)
+		}
+		if t.rest != nil {
+			collectTargets(t.rest, declare, assign)
+		}
+	case objectPattern:
+		for _, prop := range t.props {
+			collectTargets(prop.Target, declare, assign)
+		}
+		if t.rest != nil {
+			collectTargets(t.rest, declare, assign)
+		}
+	case defaulted:
+		collectTargets(t.target, declare, assign)
+		collect(t.v, declare, assign)
+	}
+}
+
+// переменные получателя присваивания
+func collectAssigned(target Node, declare, assign func(name string)) {
+	switch t := unwrap(target).(type) {
+	case ident:
+		assign(t.v)
+	case arrayPattern:
+		for _, elem := range t.elems {
+			collectAssigned(elem, declare, assign)
+		}
+		if t.rest != nil {
+			collectAssigned(t.rest, declare, assign)
+		}
+	case objectPattern:
+		for _, prop := range t.props {
+			collectAssigned(prop.Target, declare, assign)
+		}
+		if t.rest != nil {
+			collectAssigned(t.rest, declare, assign)
+		}
+	case defaulted:
+		collectAssigned(t.target, declare, assign)
+		collect(t.v, declare, assign)
+	default:
+		collectIndexes(target, declare, assign)
+	}
+}
+
+// индексы цепочки a[i].b[j]
+func collectIndexes(target Node, declare, assign func(name string)) {
+	for {
+		switch t := unwrap(target).(type) {
+		case elByIndex:
+			collect(t.index, declare, assign)
+			target = t.v
+		case member:
+			target = t.v
+		default:
+			return
+		}
+	}
+}
+
+// вложенные выражения узла
+func children(n Node) []Node {
+	switch n := n.(type) {
+	case add:
+		return []Node{n.a, n.b}
+	case sub:
+		return []Node{n.a, n.b}
+	case mul:
+		return []Node{n.a, n.b}
+	case div:
+		return []Node{n.a, n.b}
+	case mod:
+		return []Node{n.a, n.b}
+	case concat:
+		return []Node{n.a, n.b}
+	case eq:
+		return []Node{n.a, n.b}
+	case neq:
+		return []Node{n.a, n.b}
+	case lt:
+		return []Node{n.a, n.b}
+	case gt:
+		return []Node{n.a, n.b}
+	case lte:
+		return []Node{n.a, n.b}
+	case gte:
+		return []Node{n.a, n.b}
+	case and:
+		return []Node{n.a, n.b}
+	case andValue:
+		return []Node{n.a, n.b}
+	case or:
+		return []Node{n.a, n.b}
+	case orValue:
+		return []Node{n.a, n.b}
+	case neg:
+		return []Node{n.v}
+	case not:
+		return []Node{n.v}
+	case interpolation:
+		return n.parts
+	case spread:
+		return []Node{n.v}
+	case named:
+		return []Node{n.v}
+	case array:
+		return n.nodes
+	case object:
+		nodes := make([]Node, 0, 2*len(n.pairs))
+		for _, pair := range n.pairs {
+			nodes = append(nodes, pair.Key, pair.Value)
+		}
+		return nodes
+	case elByIndex:
+		return []Node{n.v, n.index}
+	case sliceNode:
+		return []Node{n.start, n.end, n.step}
+	case member:
+		return []Node{n.v}
+	case block:
+		return n.cmds
+	case call:
+		return append([]Node{n.target}, n.args...)
+	case returnNode:
+		return []Node{n.v}
+	case throwNode:
+		return []Node{n.v}
+	default:
+		return nil
+	}
+}
+
+// КАДРЫ:
+
+// кадр пространства при выполнении: значения переменных по слотам;
+// пустая ячейка - переменная еще не создана
+type frame struct {
+	parent *frame
+	slots  []value.Value
+	//небольшие кадры размещаются одним выделением памяти
+	inline [4]value.Value
+}
+
+func newFrame(size int, parent *frame) *frame {
+	f := &frame{parent: parent}
+	if size <= len(f.inline) {
+		f.slots = f.inline[:size]
+	} else {
+		f.slots = make([]value.Value, size)
+	}
+	return f
+}
+
+func (f *frame) up(depth int32) *frame {
+	for range depth {
+		f = f.parent
+	}
+	return f
+}
+
+// проверка перед выполнением: переменная, которую программа читает
+// из глобального пространства, или переменная верхнего уровня,
+// которая не должна в нем существовать
+type check struct {
+	name     string
+	pos      pos.Pos
+	declared bool
+}
+
+// переменные глобального пространства, которых нет, и объявления,
+// повторяющие его переменные, обнаруживаются до выполнения программы
+func (c *Code) check(ns namespace.Namespace) error {
+	for _, ch := range c.checks {
+		if ch.declared {
+			//встроенные функции и глобальные переменные не скрываются
+			if _, err := ns.Get(ch.name); err == nil {
+				return pos.Wrap(namespace.VarAlreadyExists(ch.name), ch.pos)
+			}
+			continue
+		}
+		if _, err := ns.Get(ch.name); err != nil {
+			return pos.Wrap(err, ch.pos)
+		}
+	}
+	return nil
+}
+
+// переносит переменные верхнего уровня в пространство имен, чтобы они
+// были доступны после выполнения (объект модуля, следующие выполнения)
+func (c *Code) store(ns namespace.Namespace, f *frame) error {
+	for slot, v := range c.vars {
+		el := f.slots[slot]
+		if el == nil {
+			continue
+		}
+		if v.dynamic {
+			ns.Set(v.name, el)
+			continue
+		}
+		if err := ns.Create(v.name, el); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,2049 @@
+package node
+
+import (
+	"errors"
+	"github.com/suprunchuksergey/dpl/internal/namespace"
+	"github.com/suprunchuksergey/dpl/internal/pos"
+	"github.com/suprunchuksergey/dpl/internal/value"
+	"math"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// байт-код и стековая виртуальная машина: дерево узлов компилируется
+// в инструкции (Compile) и выполняется без рекурсивного обхода дерева
+
+type opcode uint8
+
+const (
+	opConst opcode = iota //значение consts[a]
+	opNil                 //отсутствующая часть среза
+	opPop
+	opDup
+	opNip //[a b] -> [b]
+	opRot //[a b c] -> [b c a]
+	opRaise
+
+	opLoad //переменная кадра: глубина a, слот b, имя names[c]
+	opStore
+	opLoadSet      //переменная кадра (a, b), если ячейка заполнена; затем переход на c
+	opStoreSet     //присваивание, если ячейка заполнена; затем переход на c
+	opStoreDynamic //переменная, созданная присваиванием: глобальная, если есть, или слот
+	opGetGlobal    //переменная names[a] глобального пространства
+	opSetGlobal
+	opDeclare //объявление в слоте a текущего кадра, имя names[b]
+	opExportDeclare
+	opExports
+
+	opAdd
+	opSub
+	opMul
+	opDiv
+	opMod
+	opConcat
+	opEq
+	opNeq
+	opLt
+	opGt
+	opLte
+	opGte
+	opNeg
+	opNot
+	opCheckLogic //проверка операнда логического оператора names[a]
+	opJumpIfBool //переход на a, если операнд, приведенный к bool, равен b
+	opToBool
+	opInterpolation
+
+	opMark //запоминает высоту стека для списков с развертыванием
+	opArray
+	opArrayMark
+	opSpread
+	opObject
+	opObjectMark
+	opSpreadObject
+
+	opCheckIndex
+	opIndex
+	opCheckSlice
+	opSlice
+	opMember
+	opRef      //место для присваивания: объект и индекс
+	opRefGet   //[obj index] -> [obj index el]
+	opSetIndex //[obj index v] -> b == 1 ? [v] : []
+
+	opJump
+	opJumpIfFalse
+	opPushScope //кадр из a слотов
+	opPopScope
+
+	opIter //итератор для a получателей
+	opNext //следующая итерация или переход на a
+	opEndIter
+	opEnterLoop
+	opExitLoop
+	opJumpOut //выход в цикл blocks[a] с переходом на b
+	opEscape  //break, continue или return вне цикла (функции)
+
+	opEnterTry
+	opExitTry
+	opUnwind //выход из блока try blocks[a] перед выполнением finally
+	opCatch  //ошибка в слот a нового кадра из b слотов
+	opReraise
+
+	opCheckCall
+	opCall
+	opCallMark
+	opNamedBegin
+	opNamedSlot
+	opNamedSet
+	opCallNamed
+	opFunction
+	opStoreRet
+	opReturn
+	opHalt
+
+	opThrow
+	opImport
+
+	opUnpackArray
+	opElem
+	opTooFew
+	opRestArray
+	opUnpackObject
+	opField
+	opRestObject
+	opEndUnpack
+
+	opArg
+	opRest
+)
+
+// виды выхода из функции (модуля) для opEscape
+const (
+	escapeBreak = iota
+	escapeContinue
+	escapeReturn
+)
+
+type instr struct {
+	op      opcode
+	a, b, c int32
+}
+
+// функция: код тела и имена параметров для именованных аргументов
+type proto struct {
+	code   *Code
+	params []string
+}
+
+// скомпилированный узел
+type Code struct {
+	ops []instr
+	//позиция инструкции для ошибок; нулевая, если неизвестна
+	pos    []pos.Pos
+	consts []value.Value
+	names  []string
+	errs   []error
+	//места для присваивания a.b[0] = v: шаги цепочки от внешнего
+	//к внутреннему, true - обращение через точку
+	refs  [][]bool
+	keys  [][]string
+	funcs []*proto
+
+	//размер кадра кода
+	slots int
+	//переменные верхнего уровня программы
+	vars   []variable
+	checks []check
+}
+
+// компилирует дерево в байт-код; код не изменяется при выполнении
+// и может выполняться одновременно в нескольких пространствах имен.
+// Повторное объявление переменной в одном пространстве - ошибка компиляции
+func Compile(n Node) (*Code, error) {
+	c := newCompiler(nil)
+	c.enterScope(false, nil, n)
+	c.compile(n)
+	c.emit(opHalt, 0, 0)
+	if c.err != nil {
+		return nil, c.err
+	}
+
+	c.code.slots = len(c.scope.vars)
+	c.code.vars = c.scope.vars
+	return c.code, nil
+}
+
+// компилирует дерево после оптимизации (Optimize). Ошибки компиляции
+// и переменные, которые проверяются перед выполнением, берутся
+// из исходного дерева: удаленный оптимизацией код тоже проверяется
+func CompileOptimized(n Node) (*Code, error) {
+	checked, err := Compile(n)
+	if err != nil {
+		return nil, err
+	}
+
+	code, err := Compile(Optimize(n))
+	if err != nil {
+		return nil, err
+	}
+	code.checks = checked.checks
+	return code, nil
+}
+
+// выполняет код в пространстве имен: переменные, которые читает код,
+// должны в нем существовать, а объявленные на верхнем уровне - нет.
+// budget может быть nil, тогда выполнение не ограничено
+func (c *Code) Run(namespace namespace.Namespace, budget *Budget) (value.Value, error) {
+	if err := c.check(namespace); err != nil {
+		return nil, err
+	}
+
+	var f *frame
+	if c.slots > 0 {
+		f = newFrame(c.slots, nil)
+	}
+
+	v, err := execute(c, f, namespace, budget, false, nil)
+	if f != nil {
+		if e := c.store(namespace, f); e != nil && err == nil {
+			return nil, e
+		}
+	}
+	return v, err
+}
+
+// КОМПИЛЯТОР:
+
+// цикл или блок try; порядок блоков совпадает с блоками машины
+type cblock struct {
+	loop  bool
+	label string
+	//переходы break и continue, адрес цикла известен после его компиляции
+	breaks, continues []int
+
+	//тело finally, выполняемое при выходе из блока через break,
+	//continue и return; nil у блока catch
+	finally Node
+	pos     pos.Pos
+	scope   *scope
+}
+
+type compiler struct {
+	code *Code
+	//позиция текущего узла для ошибок
+	pos    pos.Pos
+	blocks []*cblock
+	scope  *scope
+	//код тела функции: return завершает функцию
+	inFunction bool
+
+	names map[string]int32
+
+	//компилятор программы: проверки перед выполнением и первая ошибка
+	root    *compiler
+	globals map[string]bool
+	err     error
+}
+
+// компилятор программы или, если задан parent, тела функции
+func newCompiler(parent *compiler) *compiler {
+	c := &compiler{
+		code:  &Code{},
+		names: make(map[string]int32),
+	}
+	if parent == nil {
+		c.root = c
+		c.globals = make(map[string]bool)
+		return c
+	}
+	c.root = parent.root
+	c.scope = parent.scope
+	c.inFunction = true
+	return c
+}
+
+func (c *compiler) emit(op opcode, a, b int32) int {
+	c.code.ops = append(c.code.ops, instr{op: op, a: a, b: b})
+	c.code.pos = append(c.code.pos, c.pos)
+	return len(c.code.ops) - 1
+}
+
+// инструкция переменной с ячейкой b
+func (c *compiler) emitVar(op opcode, b binding, name string) {
+	c.emit(op, b.depth, b.slot)
+	c.code.ops[len(c.code.ops)-1].c = c.name(name)
+}
+
+func (c *compiler) here() int32 { return int32(len(c.code.ops)) }
+
+// задает адрес перехода инструкции
+func (c *compiler) patch(i int) { c.code.ops[i].a = c.here() }
+
+func (c *compiler) constant(v value.Value) int32 {
+	c.code.consts = append(c.code.consts, v)
+	return int32(len(c.code.consts) - 1)
+}
+
+func (c *compiler) name(name string) int32 {
+	if i, ok := c.names[name]; ok {
+		return i
+	}
+	c.code.names = append(c.code.names, name)
+	i := int32(len(c.code.names) - 1)
+	c.names[name] = i
+	return i
+}
+
+func (c *compiler) raise(err error) {
+	c.code.errs = append(c.code.errs, err)
+	c.emit(opRaise, int32(len(c.code.errs)-1), 0)
+}
+
+// компилирует узел с участком исходного кода: ошибки инструкций узла
+// привязываются к началу участка
+func (c *compiler) at(n Node) (restore func()) {
+	span, ok := SpanOf(n)
+	if !ok {
+		return func() {}
+	}
+	saved := c.pos
+	c.pos = span.Start
+	return func() { c.pos = saved }
+}
+
+// вычисляет узел; результат остается на стеке
+func (c *compiler) compile(n Node) {
+	if n == nil {
+		c.emit(opConst, c.constant(value.Null()), 0)
+		return
+	}
+
+	defer c.at(n)()
+
+	switch n := unwrap(n).(type) {
+	case valueNode:
+		c.emit(opConst, c.constant(n.v), 0)
+
+	case add:
+		c.binary(n.binary, opAdd)
+	case sub:
+		c.binary(n.binary, opSub)
+	case mul:
+		c.binary(n.binary, opMul)
+	case div:
+		c.binary(n.binary, opDiv)
+	case mod:
+		c.binary(n.binary, opMod)
+	case concat:
+		c.binary(n.binary, opConcat)
+	case eq:
+		c.binary(n.binary, opEq)
+	case neq:
+		c.binary(n.binary, opNeq)
+	case lt:
+		c.binary(n.binary, opLt)
+	case gt:
+		c.binary(n.binary, opGt)
+	case lte:
+		c.binary(n.binary, opLte)
+	case gte:
+		c.binary(n.binary, opGte)
+
+	case and:
+		c.shortCircuit(n.binary, "and", false, true)
+	case andValue:
+		c.shortCircuit(n.binary, "&&", false, false)
+	case or:
+		c.shortCircuit(n.binary, "or", true, true)
+	case orValue:
+		c.shortCircuit(n.binary, "?:", true, false)
+
+	case neg:
+		c.compile(n.v)
+		c.emit(opNeg, 0, 0)
+	case not:
+		c.compile(n.v)
+		c.emit(opNot, 0, 0)
+
+	case interpolation:
+		for _, part := range n.parts {
+			c.compile(part)
+		}
+		c.emit(opInterpolation, int32(len(n.parts)), 0)
+
+	case spread:
+		c.compile(n.v)
+	case named:
+		c.compile(n.v)
+
+	case array:
+		c.array(n)
+	case object:
+		c.object(n)
+
+	case elByIndex:
+		c.compile(n.v)
+		c.emit(opCheckIndex, 0, 0)
+		c.compile(n.index)
+		c.emit(opIndex, 0, 0)
+	case sliceNode:
+		for _, part := range []Node{n.start, n.end, n.step} {
+			if part == nil {
+				c.emit(opNil, 0, 0)
+				continue
+			}
+			c.compile(part)
+			c.emit(opCheckSlice, 0, 0)
+		}
+		c.emit(opSlice, 0, 0)
+	case member:
+		c.compile(n.v)
+		c.emit(opMember, c.name(n.name), 0)
+
+	case ident:
+		c.load(n.v)
+
+	case arrayPattern, objectPattern, defaulted:
+		c.raise(patternNotValue())
+
+	case create:
+		if err := checkPattern(n.name); err != nil {
+			c.raise(err)
+			return
+		}
+		c.compile(n.v)
+		c.emit(opDup, 0, 0)
+		c.pattern(n.name, opDeclare)
+	case set:
+		c.compile(n.v)
+		c.emit(opDup, 0, 0)
+		c.pattern(n.name, opStore)
+	case compound:
+		c.compound(n)
+
+	case block:
+		if len(n.cmds) == 0 {
+			c.emit(opConst, c.constant(value.Null()), 0)
+			return
+		}
+		for i, cmd := range n.cmds {
+			if i != 0 {
+				c.emit(opPop, 0, 0)
+			}
+			c.compile(cmd)
+		}
+	case branch:
+		c.branch(n)
+	case loop:
+		c.loop(n)
+	case whileLoop:
+		c.while(n)
+	case breakNode:
+		c.jumpOut(n.label, false)
+	case continueNode:
+		c.jumpOut(n.label, true)
+
+	case call:
+		c.call(n)
+	case returnNode:
+		c.compile(n.v)
+		c.emit(opStoreRet, 0, 0)
+		c.unwind(0)
+		if c.inFunction {
+			c.emit(opReturn, 0, 0)
+		} else {
+			c.emit(opEscape, escapeReturn, 0)
+		}
+	case function:
+		c.function(n)
+
+	case throwNode:
+		c.compile(n.v)
+		c.emit(opThrow, 0, 0)
+	case tryNode:
+		c.try(n)
+
+	case importNode:
+		c.emit(opImport, c.name(n.path), 0)
+		c.emit(opDup, 0, 0)
+		c.declare(n.name, opDeclare)
+	case exportNode:
+		if err := checkPattern(n.name); err != nil {
+			c.raise(err)
+			return
+		}
+		c.emit(opExports, 0, 0)
+		c.compile(n.v)
+		c.emit(opDup, 0, 0)
+		c.pattern(n.name, opExportDeclare)
+
+	default:
+		panic("неизвестный узел")
+	}
+}
+
+func (c *compiler) binary(n binary, op opcode) {
+	c.compile(n.a)
+	c.compile(n.b)
+	c.emit(op, 0, 0)
+}
+
+// a and b, a && b, a or b, a ?: b: b не вычисляется, если a,
+// приведенное к bool, равно stop
+func (c *compiler) shortCircuit(n binary, op string, stop, toBool bool) {
+	c.compile(n.a)
+	c.emit(opCheckLogic, c.name(op), 0)
+
+	var b int32
+	if stop {
+		b = 1
+	}
+	jump := c.emit(opJumpIfBool, 0, b)
+
+	c.compile(n.b)
+	c.emit(opCheckLogic, c.name(op), 0)
+	c.patch(jump)
+
+	if toBool {
+		c.emit(opToBool, 0, 0)
+	}
+}
+
+// элемент списка с развертыванием: ...v разворачивается
+// сразу после вычисления, в into - куда
+func (c *compiler) spreadElem(n Node, into int32) bool {
+	s, ok := unwrap(n).(spread)
+	if !ok {
+		return false
+	}
+
+	defer c.at(n)()
+	c.compile(s.v)
+	c.emit(opSpread, into, 0)
+	return true
+}
+
+const (
+	intoArray = iota
+	intoArgs
+)
+
+var spreadInto = [...]string{
+	intoArray: "массив",
+	intoArgs:  "аргументы вызова",
+}
+
+func hasSpread(nodes []Node) bool {
+	return slices.ContainsFunc(nodes, func(n Node) bool {
+		_, ok := unwrap(n).(spread)
+		return ok
+	})
+}
+
+func (c *compiler) array(n array) {
+	if !hasSpread(n.nodes) {
+		for _, el := range n.nodes {
+			c.compile(el)
+		}
+		c.emit(opArray, int32(len(n.nodes)), 0)
+		return
+	}
+
+	c.emit(opMark, 0, 0)
+	for _, el := range n.nodes {
+		if !c.spreadElem(el, intoArray) {
+			c.compile(el)
+		}
+	}
+	c.emit(opArrayMark, 0, 0)
+}
+
+func (c *compiler) object(n object) {
+	spreads := slices.ContainsFunc(n.pairs, func(pair KV) bool {
+		_, ok := unwrap(pair.Value).(spread)
+		return ok
+	})
+
+	if spreads {
+		c.emit(opMark, 0, 0)
+	}
+
+	for _, pair := range n.pairs {
+		if s, ok := unwrap(pair.Value).(spread); ok {
+			restore := c.at(pair.Value)
+			c.compile(s.v)
+			c.emit(opSpreadObject, 0, 0)
+			restore()
+			continue
+		}
+		c.compile(pair.Key)
+		c.compile(pair.Value)
+	}
+
+	if spreads {
+		c.emit(opObjectMark, 0, 0)
+	} else {
+		c.emit(opObject, int32(len(n.pairs)), 0)
+	}
+}
+
+// связывает значение на вершине стека с получателем target;
+// bind - инструкция для простого получателя: opDeclare, opStore
+// (присваивание) или opExportDeclare. Участки получателей не используются:
+// ошибки связывания относятся к конструкции, которая его выполняет
+func (c *compiler) pattern(target Node, bind opcode) {
+	switch t := unwrap(target).(type) {
+	case arrayPattern:
+		var rest int32
+		if t.rest != nil {
+			rest = 1
+		}
+		c.emit(opUnpackArray, int32(len(t.elems)), rest)
+
+		for i, elem := range t.elems {
+			var next int
+			c.alternatives(func() {
+				present := c.emit(opElem, 0, int32(i))
+				c.pattern(elem, bind)
+				next = c.emit(opJump, 0, 0)
+				c.patch(present)
+			}, func() {
+				if def, ok := unwrap(elem).(defaulted); ok {
+					c.compile(def.v)
+					c.pattern(def.target, bind)
+					return
+				}
+				//обязательны все элементы до последнего без значения по умолчанию
+				required := i + 1
+				for j := i + 1; j < len(t.elems); j++ {
+					if _, ok := unwrap(t.elems[j]).(defaulted); !ok {
+						required = j + 1
+					}
+				}
+				c.emit(opTooFew, int32(required), 0)
+			})
+			c.patch(next)
+		}
+
+		if t.rest != nil {
+			c.emit(opRestArray, int32(len(t.elems)), 0)
+			c.pattern(t.rest, bind)
+		}
+		c.emit(opEndUnpack, 0, 0)
+
+	case objectPattern:
+		c.emit(opUnpackObject, 0, 0)
+
+		keys := make([]string, 0, len(t.props))
+		for _, prop := range t.props {
+			keys = append(keys, prop.Key)
+
+			var next int
+			c.alternatives(func() {
+				present := c.emit(opField, 0, c.name(prop.Key))
+				c.pattern(prop.Target, bind)
+				next = c.emit(opJump, 0, 0)
+				c.patch(present)
+			}, func() {
+				//отсутствующее поле, как и при обращении по индексу, равно null
+				if def, ok := unwrap(prop.Target).(defaulted); ok {
+					c.compile(def.v)
+					c.pattern(def.target, bind)
+				} else {
+					c.emit(opConst, c.constant(value.Null()), 0)
+					c.pattern(prop.Target, bind)
+				}
+			})
+			c.patch(next)
+		}
+
+		if t.rest != nil {
+			c.code.keys = append(c.code.keys, keys)
+			c.emit(opRestObject, int32(len(c.code.keys)-1), 0)
+			c.pattern(t.rest, bind)
+		}
+		c.emit(opEndUnpack, 0, 0)
+
+	case defaulted:
+		//значение есть, значение по умолчанию не используется
+		c.pattern(t.target, bind)
+
+	case ident:
+		if bind == opStore {
+			c.assign(t.v, true)
+		} else {
+			c.declare(t.v, bind)
+		}
+
+	default:
+		if bind != opStore {
+			c.emit(opPop, 0, 0)
+			c.raise(idExpected())
+			return
+		}
+		if c.ref(target) {
+			c.emit(opRot, 0, 0)
+			c.emit(opSetIndex, 0, 0)
+		}
+	}
+}
+
+// вычисляет место присваивания по цепочке индексов a.b[i]:
+// индексы вычисляются от последнего к первому, ровно один раз,
+// затем переменная a; на стеке остаются объект и индекс. false, если цепочка
+// начинается не с идентификатора (инструкция выбрасывает ошибку)
+func (c *compiler) ref(target Node) bool {
+	var members []bool
+
+	id := unwrap(target)
+loop:
+	for {
+		switch index := id.(type) {
+		case elByIndex:
+			c.compile(index.index)
+			members = append(members, false)
+			id = unwrap(index.v)
+		case member:
+			c.emit(opConst, c.constant(value.Text(index.name)), 0)
+			members = append(members, true)
+			id = unwrap(index.v)
+		default:
+			break loop
+		}
+	}
+
+	name, ok := id.(ident)
+	if !ok || len(members) == 0 {
+		c.raise(idExpected())
+		return false
+	}
+
+	c.load(name.v)
+	c.code.refs = append(c.code.refs, members)
+	c.emit(opRef, int32(len(c.code.refs)-1), 0)
+	return true
+}
+
+func (c *compiler) compound(n compound) {
+	op := compoundOps[n.op]
+
+	if id, ok := unwrap(n.name).(ident); ok {
+		c.load(id.v)
+		c.compile(n.v)
+		c.emit(op, 0, 0)
+		c.emit(opDup, 0, 0)
+		c.assign(id.v, false)
+		return
+	}
+
+	if !c.ref(n.name) {
+		return
+	}
+	c.emit(opRefGet, 0, 0)
+	c.compile(n.v)
+	c.emit(op, 0, 0)
+	c.emit(opSetIndex, 0, 1)
+}
+
+func (c *compiler) branch(n branch) {
+	var ends []int
+	for _, b := range n.branches {
+		//else: условие не проверяется, следующие ветви не выполняются
+		if always(b.Cond) {
+			c.pushScope(nil, b.Body)
+			c.compile(b.Body)
+			c.popScope()
+			for _, end := range ends {
+				c.patch(end)
+			}
+			return
+		}
+
+		c.compile(b.Cond)
+		next := c.emit(opJumpIfFalse, 0, 0)
+		c.pushScope(nil, b.Body)
+		c.compile(b.Body)
+		c.popScope()
+		ends = append(ends, c.emit(opJump, 0, 0))
+		c.patch(next)
+	}
+
+	c.emit(opConst, c.constant(value.Null()), 0)
+	for _, end := range ends {
+		c.patch(end)
+	}
+}
+
+// результат цикла (значение последней завершенной итерации) лежит
+// на стеке под значением тела; break и continue возвращаются к нему
+func (c *compiler) enterLoop(label string) *cblock {
+	c.emit(opConst, c.constant(value.Null()), 0)
+	c.emit(opEnterLoop, 0, 0)
+
+	b := &cblock{loop: true, label: label}
+	c.blocks = append(c.blocks, b)
+	return b
+}
+
+func (c *compiler) exitLoop(b *cblock, next int32) {
+	for _, i := range b.breaks {
+		c.patch(i)
+	}
+	for _, i := range b.continues {
+		c.code.ops[i].b = next
+	}
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	c.emit(opExitLoop, 0, 0)
+}
+
+func (c *compiler) loop(n loop) {
+	for _, recipient := range n.recipients {
+		if err := checkPattern(recipient); err != nil {
+			c.raise(err)
+			return
+		}
+	}
+
+	c.compile(n.from)
+
+	switch len(n.recipients) {
+	case 0:
+		c.raise(tooFewRecipients())
+		return
+	case 1, 2:
+	default:
+		c.raise(tooManyRecipients())
+		return
+	}
+
+	c.emit(opIter, int32(len(n.recipients)), 0)
+	b := c.enterLoop(n.label)
+
+	next := c.here()
+	done := c.emit(opNext, 0, 0)
+	c.pushScope(n.recipients, n.body)
+	for _, recipient := range n.recipients {
+		c.pattern(recipient, opDeclare)
+	}
+	c.compile(n.body)
+	c.popScope()
+	c.emit(opNip, 0, 0)
+	c.emit(opJump, next, 0)
+	c.patch(done)
+
+	for _, i := range b.breaks {
+		c.code.ops[i].b = c.here()
+	}
+	b.breaks = nil
+	c.exitLoop(b, next)
+	c.emit(opEndIter, 0, 0)
+}
+
+func (c *compiler) while(n whileLoop) {
+	b := c.enterLoop(n.label)
+
+	next := c.here()
+	c.compile(n.cond)
+	done := c.emit(opJumpIfFalse, 0, 0)
+	c.pushScope(nil, n.body)
+	c.compile(n.body)
+	c.popScope()
+	c.emit(opNip, 0, 0)
+	c.emit(opJump, next, 0)
+	c.patch(done)
+
+	for _, i := range b.breaks {
+		c.code.ops[i].b = c.here()
+	}
+	b.breaks = nil
+	c.exitLoop(b, next)
+}
+
+// выполняет finally блоков try, из которых выходит break, continue
+// или return, начиная с самого вложенного, до блока depth
+func (c *compiler) unwind(depth int) {
+	for i := len(c.blocks) - 1; i >= depth; i-- {
+		b := c.blocks[i]
+		if b.finally == nil {
+			continue
+		}
+
+		c.emit(opUnwind, int32(i), 0)
+
+		//код finally выполняется в пространстве, окружающем блок try
+		blocks, p, s := c.blocks, c.pos, c.scope
+		c.blocks, c.pos, c.scope = slices.Clone(c.blocks[:i]), b.pos, b.scope
+		c.finally(b.finally)
+		c.blocks, c.pos, c.scope = blocks, p, s
+	}
+}
+
+func (c *compiler) jumpOut(label string, cont bool) {
+	target := -1
+	for i := len(c.blocks) - 1; i >= 0; i-- {
+		if b := c.blocks[i]; b.loop && (label == "" || label == b.label) {
+			target = i
+			break
+		}
+	}
+
+	c.unwind(target + 1)
+
+	if target == -1 {
+		kind := int32(escapeBreak)
+		if cont {
+			kind = escapeContinue
+		}
+		c.emit(opEscape, kind, c.name(label))
+		return
+	}
+
+	i := c.emit(opJumpOut, int32(target), 0)
+	if cont {
+		c.blocks[target].continues = append(c.blocks[target].continues, i)
+	} else {
+		c.blocks[target].breaks = append(c.blocks[target].breaks, i)
+	}
+}
+
+func (c *compiler) call(n call) {
+	c.compile(n.target)
+	c.emit(opCheckCall, 0, 0)
+
+	positional := make([]Node, 0, len(n.args))
+	var names []Node
+	for _, arg := range n.args {
+		if _, ok := unwrap(arg).(named); ok {
+			names = append(names, arg)
+			continue
+		}
+		positional = append(positional, arg)
+	}
+
+	if len(names) == 0 && !hasSpread(positional) {
+		for _, arg := range positional {
+			c.compile(arg)
+		}
+		c.emit(opCall, int32(len(positional)), 0)
+		return
+	}
+
+	c.emit(opMark, 0, 0)
+	for _, arg := range positional {
+		if !c.spreadElem(arg, intoArgs) {
+			c.compile(arg)
+		}
+	}
+
+	if len(names) == 0 {
+		c.emit(opCallMark, 0, 0)
+		return
+	}
+
+	//именованный аргумент занимает позицию своего параметра,
+	//пропущенные позиции остаются пустыми
+	c.emit(opNamedBegin, 0, 0)
+	for _, arg := range names {
+		restore := c.at(arg)
+		c.emit(opNamedSlot, c.name(unwrap(arg).(named).name), 0)
+		c.compile(unwrap(arg).(named).v)
+		c.emit(opNamedSet, 0, 0)
+		restore()
+	}
+	c.emit(opCallNamed, 0, 0)
+}
+
+func (c *compiler) function(n function) {
+	for _, param := range n.params {
+		if err := checkPattern(param); err != nil {
+			c.raise(err)
+			return
+		}
+	}
+	if n.rest != nil {
+		if err := checkPattern(n.rest); err != nil {
+			c.raise(err)
+			return
+		}
+	}
+
+	//код параметров не привязан к позициям: ошибки связывания
+	//аргументов относятся к вызову
+	declared := n.params
+	if n.rest != nil {
+		declared = append(slices.Clone(declared), n.rest)
+	}
+	seen := make(map[string]bool)
+	for _, param := range declared {
+		collectTargets(param, func(name string) {
+			if seen[name] {
+				c.fail(namespace.VarAlreadyExists(name))
+			}
+			seen[name] = true
+		}, func(string) {})
+	}
+
+	fc := newCompiler(c)
+	fc.enterScope(true, declared, n.body)
+	for i, param := range n.params {
+		var next int
+		fc.alternatives(func() {
+			present := fc.emit(opArg, 0, int32(i))
+			fc.pattern(param, opDeclare)
+			next = fc.emit(opJump, 0, 0)
+			fc.patch(present)
+		}, func() {
+			//значение по умолчанию вычисляется при вызове,
+			//в нем доступны предыдущие параметры
+			if def, ok := unwrap(param).(defaulted); ok {
+				fc.compile(def.v)
+				fc.pattern(def.target, opDeclare)
+			} else {
+				fc.emit(opConst, fc.constant(value.Null()), 0)
+				fc.pattern(param, opDeclare)
+			}
+		})
+		fc.patch(next)
+	}
+	if n.rest != nil {
+		fc.emit(opRest, int32(len(n.params)), 0)
+		fc.pattern(n.rest, opDeclare)
+	}
+	fc.compile(n.body)
+	fc.emit(opStoreRet, 0, 0)
+	fc.emit(opReturn, 0, 0)
+	fc.code.slots = len(fc.scope.vars)
+
+	names := make([]string, 0, len(n.params))
+	for _, param := range n.params {
+		names = append(names, paramName(param))
+	}
+
+	c.code.funcs = append(c.code.funcs, &proto{code: fc.code, params: names})
+	c.emit(opFunction, int32(len(c.code.funcs)-1), 0)
+}
+
+// try body catch name {catch} finally {finally}: блок finally охватывает
+// тело и catch, блок catch - только тело
+func (c *compiler) try(n tryNode) {
+	var fin *cblock
+	var enterFinally int
+	if n.finally != nil {
+		fin = &cblock{finally: n.finally, pos: c.pos, scope: c.scope}
+		enterFinally = c.emit(opEnterTry, 0, 0)
+		c.blocks = append(c.blocks, fin)
+	}
+
+	if n.catch != nil {
+		enterCatch := c.emit(opEnterTry, 0, 0)
+		c.blocks = append(c.blocks, &cblock{})
+		c.pushScope(nil, n.body)
+		c.compile(n.body)
+		c.popScope()
+		c.blocks = c.blocks[:len(c.blocks)-1]
+		c.emit(opExitTry, 0, 0)
+		done := c.emit(opJump, 0, 0)
+
+		c.patch(enterCatch)
+		var declared []Node
+		if n.name != "" {
+			declared = []Node{Ident(n.name)}
+		}
+		s := c.enterScope(false, declared, n.catch)
+		slot := int32(-1)
+		if n.name != "" {
+			slot = s.slots[n.name]
+			s.visible[n.name] = true
+		}
+		c.emit(opCatch, slot, int32(len(s.vars)))
+		c.compile(n.catch)
+		c.popScope()
+		c.patch(done)
+	} else {
+		c.pushScope(nil, n.body)
+		c.compile(n.body)
+		c.popScope()
+	}
+
+	if fin == nil {
+		return
+	}
+
+	//результат finally не используется; ошибка или return
+	//из finally заменяет результат try
+	c.blocks = c.blocks[:len(c.blocks)-1]
+	c.emit(opExitTry, 0, 0)
+	c.finally(n.finally)
+	done := c.emit(opJump, 0, 0)
+
+	c.patch(enterFinally)
+	c.finally(n.finally)
+	c.emit(opReraise, 0, 0)
+	c.patch(done)
+}
+
+// тело finally в собственном пространстве; результат не используется
+func (c *compiler) finally(body Node) {
+	c.pushScope(nil, body)
+	c.compile(body)
+	c.popScope()
+	c.emit(opPop, 0, 0)
+}
+
+// ВИРТУАЛЬНАЯ МАШИНА:
+
+// активный цикл или блок try
+type region struct {
+	//адрес обработчика ошибок блока try, -1 у цикла
+	handler int
+	//состояние машины при входе в блок
+	stack, aux int
+	frame      *frame
+}
+
+// итератор цикла for: целые числа 0..n-1 (для строк и массивов - индексы)
+// или ключи объекта, собранные при входе в цикл
+type iterator struct {
+	v    value.Value
+	two  bool
+	n, i int
+	keys []value.Value
+}
+
+// аргументы вызова с именованными аргументами
+type namedCall struct {
+	args   []value.Value
+	params []string
+	slot   int
+}
+
+// выполнение кода одной функции (модуля)
+type machine struct {
+	code  *Code
+	stack []value.Value
+	//вспомогательный стек: итераторы, разбираемые значения,
+	//отметки списков, ошибки для catch и finally
+	aux    []any
+	blocks []region
+	frame  *frame
+	//пространство имен, в котором выполняется программа
+	globals namespace.Namespace
+	budget  *Budget
+	//инструкции, еще не учтенные в budget
+	steps int64
+
+	//код функции: аргументы вызова
+	function bool
+	args     []value.Value
+	ret      value.Value
+}
+
+// машины переиспользуются, чтобы вызовы функций не выделяли стеки заново
+var machines = sync.Pool{New: func() any { return new(machine) }}
+
+func execute(
+	code *Code,
+	f *frame,
+	globals namespace.Namespace,
+	budget *Budget,
+	function bool,
+	args []value.Value,
+) (value.Value, error) {
+	m := machines.Get().(*machine)
+	m.code, m.frame, m.globals, m.budget = code, f, globals, budget
+	m.function, m.args = function, args
+
+	v, err := m.run()
+	if budget != nil {
+		budget.steps.Add(m.steps)
+	}
+
+	clear(m.stack)
+	clear(m.aux)
+	clear(m.blocks)
+	*m = machine{stack: m.stack[:0], aux: m.aux[:0], blocks: m.blocks[:0]}
+	machines.Put(m)
+
+	return v, err
+}
+
+func (m *machine) push(v value.Value) { m.stack = append(m.stack, v) }
+
+func (m *machine) pop() value.Value {
+	v := m.stack[len(m.stack)-1]
+	m.stack = m.stack[:len(m.stack)-1]
+	return v
+}
+
+func (m *machine) top() value.Value { return m.stack[len(m.stack)-1] }
+
+func (m *machine) popAux() any {
+	v := m.aux[len(m.aux)-1]
+	m.aux = m.aux[:len(m.aux)-1]
+	return v
+}
+
+func (m *machine) restore(b region) {
+	clear(m.stack[b.stack:])
+	m.stack = m.stack[:b.stack]
+	clear(m.aux[b.aux:])
+	m.aux = m.aux[:b.aux]
+	m.frame = b.frame
+}
+
+// значения над отметкой стека
+func (m *machine) popMark() []value.Value {
+	mark := m.popAux().(int)
+	values := slices.Clone(m.stack[mark:])
+	clear(m.stack[mark:])
+	m.stack = m.stack[:mark]
+	return values
+}
+
+func (m *machine) pushMark() { m.aux = append(m.aux, len(m.stack)) }
+
+// находит обработчик ошибки; false, если ошибку нужно вернуть
+func (m *machine) handle(err error) (int, bool) {
+	if IsLimit(err) {
+		return 0, false
+	}
+	for i := len(m.blocks) - 1; i >= 0; i-- {
+		b := m.blocks[i]
+		if b.handler < 0 {
+			continue
+		}
+		m.blocks = m.blocks[:i]
+		m.restore(b)
+		m.aux = append(m.aux, err)
+		return b.handler, true
+	}
+	return 0, false
+}
+
+func (m *machine) run() (value.Value, error) {
+	code := m.code
+	for pc := 0; ; {
+		in := code.ops[pc]
+		pc++
+		m.steps++
+
+		var err error
+		switch in.op {
+		case opConst:
+			m.push(code.consts[in.a])
+		case opNil:
+			m.push(nil)
+		case opPop:
+			m.pop()
+		case opDup:
+			m.push(m.top())
+		case opNip:
+			v := m.pop()
+			m.stack[len(m.stack)-1] = v
+		case opRot:
+			n := len(m.stack)
+			a := m.stack[n-3]
+			copy(m.stack[n-3:], m.stack[n-2:])
+			m.stack[n-1] = a
+		case opRaise:
+			err = code.errs[in.a]
+
+		case opLoad:
+			v := m.frame.up(in.a).slots[in.b]
+			if v == nil {
+				err = namespace.VarDoesNotExist(code.names[in.c])
+				break
+			}
+			m.push(v)
+		case opStore:
+			m.frame.up(in.a).slots[in.b] = m.pop()
+		case opLoadSet:
+			if v := m.frame.up(in.a).slots[in.b]; v != nil {
+				m.push(v)
+				pc = int(in.c)
+			}
+		case opStoreSet:
+			if slots := m.frame.up(in.a).slots; slots[in.b] != nil {
+				slots[in.b] = m.pop()
+				pc = int(in.c)
+			}
+		case opStoreDynamic:
+			slots := m.frame.up(in.a).slots
+			v := m.pop()
+			if slots[in.b] == nil {
+				//присваивание изменяет существующую глобальную переменную
+				name := code.names[in.c]
+				if _, e := m.globals.Get(name); e == nil {
+					m.globals.Set(name, v)
+					break
+				}
+			}
+			slots[in.b] = v
+		case opGetGlobal:
+			var v value.Value
+			v, err = m.globals.Get(code.names[in.a])
+			if err == nil {
+				m.push(v)
+			}
+		case opSetGlobal:
+			m.globals.Set(code.names[in.a], m.pop())
+		case opDeclare:
+			err = m.declare(in, m.pop())
+		case opExportDeclare:
+			v := m.pop()
+			if err = m.declare(in, v); err == nil {
+				exports, _ := m.globals.Get(ExportName)
+				err = exports.SetElByIndex(value.Text(code.names[in.b]), v)
+			}
+		case opExports:
+			if _, e := m.globals.Get(ExportName); e != nil {
+				err = exportUnavailable()
+			}
+
+		case opAdd, opSub, opMul, opDiv, opMod:
+			b := m.pop()
+			var v value.Value
+			v, err = arithmetic(in.op, m.top(), b)
+			if err == nil {
+				m.stack[len(m.stack)-1] = v
+			}
+		case opConcat:
+			b := m.pop()
+			m.stack[len(m.stack)-1] = value.Text(m.top().Text() + b.Text())
+		case opEq, opNeq, opLt, opGt, opLte, opGte:
+			b := m.pop()
+			var v value.Value
+			v, err = comparison(in.op, m.top(), b)
+			if err == nil {
+				m.stack[len(m.stack)-1] = v
+			}
+		case opNeg:
+			var v value.Value
+			v, err = negate(m.top())
+			if err == nil {
+				m.stack[len(m.stack)-1] = v
+			}
+		case opNot:
+			v := m.top()
+			if err = checkType("not", v, logicWhitelist); err == nil {
+				var b bool
+				if b, err = v.Bool(); err == nil {
+					m.stack[len(m.stack)-1] = value.Bool(!b)
+				}
+			}
+		case opCheckLogic:
+			err = checkType(code.names[in.a], m.top(), logicWhitelist)
+		case opJumpIfBool:
+			var b bool
+			if b, err = m.top().Bool(); err == nil {
+				if b == (in.b == 1) {
+					pc = int(in.a)
+				} else {
+					m.pop()
+				}
+			}
+		case opToBool:
+			var b bool
+			if b, err = m.top().Bool(); err == nil {
+				m.stack[len(m.stack)-1] = value.Bool(b)
+			}
+		case opInterpolation:
+			var str strings.Builder
+			parts := m.stack[len(m.stack)-int(in.a):]
+			for _, part := range parts {
+				str.WriteString(part.Text())
+			}
+			clear(parts)
+			m.stack = m.stack[:len(m.stack)-int(in.a)]
+			m.push(value.Text(str.String()))
+
+		case opMark:
+			m.pushMark()
+		case opArray:
+			n := len(m.stack) - int(in.a)
+			values := slices.Clone(m.stack[n:])
+			clear(m.stack[n:])
+			m.stack = m.stack[:n]
+			m.push(value.Array(values...))
+		case opArrayMark:
+			m.push(value.Array(m.popMark()...))
+		case opSpread:
+			v := m.pop()
+			if v.Type() != value.ArrayType && v.Type() != value.TextType {
+				err = cannotSpread(v.Type(), spreadInto[in.a])
+				break
+			}
+			var els []value.Value
+			if els, err = elements(v); err == nil {
+				m.stack = append(m.stack, els...)
+			}
+		case opObject:
+			n := len(m.stack) - 2*int(in.a)
+			pairs := make([]value.KV, 0, in.a)
+			for i := n; i < len(m.stack); i += 2 {
+				pairs = append(pairs, value.KV{Key: m.stack[i], Value: m.stack[i+1]})
+			}
+			clear(m.stack[n:])
+			m.stack = m.stack[:n]
+			m.push(value.Object(pairs...))
+		case opObjectMark:
+			values := m.popMark()
+			pairs := make([]value.KV, 0, len(values)/2)
+			for i := 0; i < len(values); i += 2 {
+				pairs = append(pairs, value.KV{Key: values[i], Value: values[i+1]})
+			}
+			m.push(value.Object(pairs...))
+		case opSpreadObject:
+			v := m.pop()
+			if v.Type() != value.ObjectType {
+				err = cannotSpread(v.Type(), "объект")
+				break
+			}
+			iter, _ := v.Iter2()
+			for k, el := range iter {
+				m.stack = append(m.stack, k, el)
+			}
+
+		case opCheckIndex:
+			err = checkType("[<index>]", m.top(), indexable)
+		case opIndex:
+			index := m.pop()
+			var v value.Value
+			v, err = elByIndexOf(m.top(), index)
+			if err == nil {
+				m.stack[len(m.stack)-1] = v
+			}
+		case opCheckSlice:
+			if v := m.top(); !slices.Contains(baseWhitelist, v.Type()) {
+				err = wrongIndex(v.Type())
+			}
+		case opSlice:
+			n := len(m.stack)
+			v := value.Slice(m.stack[n-3], m.stack[n-2], m.stack[n-1])
+			clear(m.stack[n-2:])
+			m.stack = m.stack[:n-2]
+			m.stack[n-3] = v
+		case opMember:
+			name := code.names[in.a]
+			v := m.top()
+			//поля ошибки доступны только для чтения
+			if err = checkType("."+name, v, members); err == nil {
+				if v, err = v.ElByIndex(value.Text(name)); err == nil {
+					m.stack[len(m.stack)-1] = v
+				}
+			}
+		case opRef:
+			err = m.ref(code.refs[in.a])
+		case opRefGet:
+			n := len(m.stack)
+			var v value.Value
+			if v, err = m.stack[n-2].ElByIndex(m.stack[n-1]); err == nil {
+				m.push(v)
+			}
+		case opSetIndex:
+			n := len(m.stack)
+			obj, index, v := m.stack[n-3], m.stack[n-2], m.stack[n-1]
+			clear(m.stack[n-3:])
+			m.stack = m.stack[:n-3]
+			if err = obj.SetElByIndex(index, v); err == nil && in.b == 1 {
+				m.push(v)
+			}
+
+		case opJump:
+			//переход назад - следующая итерация цикла
+			if int(in.a) < pc {
+				if err = m.tick(); err != nil {
+					break
+				}
+			}
+			pc = int(in.a)
+		case opJumpIfFalse:
+			var b bool
+			if b, err = m.pop().Bool(); err == nil && !b {
+				pc = int(in.a)
+			}
+		case opPushScope:
+			m.frame = newFrame(int(in.a), m.frame)
+		case opPopScope:
+			m.frame = m.frame.parent
+
+		case opIter:
+			var it *iterator
+			if it, err = newIterator(m.pop(), in.a == 2); err == nil {
+				m.aux = append(m.aux, it)
+			}
+		case opNext:
+			it := m.aux[len(m.aux)-1].(*iterator)
+			if it.i >= it.n {
+				pc = int(in.a)
+				break
+			}
+			err = it.next(m)
+		case opEndIter:
+			m.popAux()
+		case opEnterLoop:
+			m.blocks = append(m.blocks, region{handler: -1, stack: len(m.stack), aux: len(m.aux), frame: m.frame})
+		case opExitLoop, opExitTry:
+			m.blocks = m.blocks[:len(m.blocks)-1]
+		case opJumpOut:
+			//continue
+			if int(in.b) < pc {
+				if err = m.tick(); err != nil {
+					break
+				}
+			}
+			m.blocks = m.blocks[:in.a+1]
+			m.restore(m.blocks[in.a])
+			pc = int(in.b)
+		case opEscape:
+			return nil, pos.Wrap(m.escape(in), code.pos[pc-1])
+
+		case opEnterTry:
+			m.blocks = append(m.blocks, region{handler: int(in.a), stack: len(m.stack), aux: len(m.aux), frame: m.frame})
+		case opUnwind:
+			b := m.blocks[in.a]
+			m.blocks = m.blocks[:in.a]
+			m.restore(b)
+		case opCatch:
+			e := m.popAux().(error)
+			if in.b > 0 {
+				m.frame = newFrame(int(in.b), m.frame)
+			}
+			if in.a >= 0 {
+				m.frame.slots[in.a] = ErrorOf(e)
+			}
+		case opReraise:
+			err = m.popAux().(error)
+
+		case opCheckCall:
+			if v := m.top(); v.Type() != value.FunctionType {
+				err = opNotDefined("вызов функции", v.Type())
+			}
+		case opCall:
+			n := len(m.stack) - int(in.a)
+			args := slices.Clone(m.stack[n:])
+			clear(m.stack[n:])
+			m.stack = m.stack[:n]
+			err = m.call(args)
+		case opCallMark:
+			err = m.call(m.popMark())
+		case opNamedBegin:
+			args := m.popMark()
+			var params []string
+			if params, err = m.top().Params(); err == nil {
+				m.aux = append(m.aux, &namedCall{args: args, params: params})
+			}
+		case opNamedSlot:
+			err = m.aux[len(m.aux)-1].(*namedCall).reserve(code.names[in.a])
+		case opNamedSet:
+			c := m.aux[len(m.aux)-1].(*namedCall)
+			c.args[c.slot] = m.pop()
+		case opCallNamed:
+			err = m.call(m.popAux().(*namedCall).args)
+		case opFunction:
+			m.push(closure(code.funcs[in.a], m.frame, m.globals, m.budget))
+		case opStoreRet:
+			m.ret = m.pop()
+		case opReturn:
+			return m.ret, nil
+		case opHalt:
+			return m.pop(), nil
+
+		case opThrow:
+			err = throw(m.pop())
+		case opImport:
+			var module value.Value
+			if module, err = importModule(m.globals, code.names[in.a]); err == nil {
+				m.push(module)
+			}
+
+		case opUnpackArray:
+			err = m.unpackArray(int(in.a), in.b == 1)
+		case opElem:
+			arr := m.aux[len(m.aux)-1].([]value.Value)
+			if int(in.b) < len(arr) {
+				m.push(arr[in.b])
+			} else {
+				pc = int(in.a)
+			}
+		case opTooFew:
+			err = tooFewElements(int(in.a), len(m.aux[len(m.aux)-1].([]value.Value)))
+		case opRestArray:
+			arr := m.aux[len(m.aux)-1].([]value.Value)
+			rest := make([]value.Value, 0)
+			if len(arr) > int(in.a) {
+				rest = append(rest, arr[in.a:]...)
+			}
+			m.push(value.Array(rest...))
+		case opUnpackObject:
+			v := m.pop()
+			if v.Type() != value.ObjectType {
+				err = cannotDestructure(v.Type(), "объект")
+				break
+			}
+			var obj map[string]value.Value
+			if obj, err = fields(v); err == nil {
+				m.aux = append(m.aux, obj)
+			}
+		case opField:
+			obj := m.aux[len(m.aux)-1].(map[string]value.Value)
+			if el, ok := obj[code.names[in.b]]; ok {
+				m.push(el)
+			} else {
+				pc = int(in.a)
+			}
+		case opRestObject:
+			obj := m.aux[len(m.aux)-1].(map[string]value.Value)
+			keys := code.keys[in.a]
+			rest := make([]value.KV, 0)
+			for k, el := range obj {
+				if !slices.Contains(keys, k) {
+					rest = append(rest, value.KV{Key: value.Text(k), Value: el})
+				}
+			}
+			m.push(value.Object(rest...))
+		case opEndUnpack:
+			m.popAux()
+
+		case opArg:
+			if int(in.b) < len(m.args) && m.args[in.b] != nil {
+				m.push(m.args[in.b])
+			} else {
+				pc = int(in.a)
+			}
+		case opRest:
+			rest := make([]value.Value, 0)
+			if len(m.args) > int(in.a) {
+				rest = append(rest, m.args[in.a:]...)
+			}
+			m.push(value.Array(rest...))
+
+		default:
+			panic("неизвестная инструкция")
+		}
+
+		if err != nil {
+			err = pos.Wrap(err, code.pos[pc-1])
+			handler, ok := m.handle(err)
+			if !ok {
+				return nil, err
+			}
+			pc = handler
+		}
+	}
+}
+
+// break, continue или return, не попавшие в цикл (функцию):
+// в функции - ошибка вызова, вне функции - управляющая ошибка
+func (m *machine) escape(in instr) error {
+	var err error
+	switch in.a {
+	case escapeBreak:
+		err = breakErr{label: m.code.names[in.b]}
+	case escapeContinue:
+		err = continueErr{label: m.code.names[in.b]}
+	case escapeReturn:
+		return returnErr{v: m.ret}
+	}
+
+	//break и continue не выходят за пределы функции
+	if m.function {
+		return errors.New(err.Error())
+	}
+	return err
+}
+
+// объявляет переменную в слоте in.a текущего кадра; слот может быть
+// занят, если переменной присвоили значение до объявления
+func (m *machine) declare(in instr, v value.Value) error {
+	if m.frame.slots[in.a] != nil {
+		return namespace.VarAlreadyExists(m.code.names[in.b])
+	}
+	m.frame.slots[in.a] = v
+	return nil
+}
+
+// учитывает выполненные инструкции и проверяет ограничения
+func (m *machine) tick() error {
+	if m.budget == nil {
+		return nil
+	}
+	err := m.budget.spend(m.steps)
+	m.steps = 0
+	return err
+}
+
+// вызывает функцию под аргументами
+func (m *machine) call(args []value.Value) error {
+	if err := m.tick(); err != nil {
+		return err
+	}
+	var (
+		v   value.Value
+		err error
+	)
+	//функция языка выполняется с ограничениями текущего выполнения
+	if c, ok := m.top().(*closureValue); ok {
+		v, err = c.call(m.budget, args)
+	} else {
+		v, err = m.top().Call(args...)
+	}
+	if err != nil {
+		return err
+	}
+	m.stack[len(m.stack)-1] = v
+	return nil
+}
+
+func (c *namedCall) reserve(name string) error {
+	i := slices.Index(c.params, name)
+	if i == -1 {
+		return unknownParam(name)
+	}
+	for len(c.args) <= i {
+		c.args = append(c.args, nil)
+	}
+	if c.args[i] != nil {
+		return duplicateArg(name)
+	}
+	c.slot = i
+	return nil
+}
+
+// значение функции, встроенное в closureValue
+type callable = value.Value
+
+// функция, замкнутая на кадр, в котором она создана. Функция хранит
+// бюджет создавшего ее выполнения: вызов из Go во время этого выполнения
+// учитывается в тех же ограничениях и той же глубине вызовов
+type closureValue struct {
+	callable
+	proto   *proto
+	frame   *frame
+	globals namespace.Namespace
+	budget  *Budget
+}
+
+func closure(p *proto, f *frame, globals namespace.Namespace, budget *Budget) value.Value {
+	c := &closureValue{proto: p, frame: f, globals: globals, budget: budget}
+	c.callable = value.FunctionWithParams(p.params, c.Call)
+	return c
+}
+
+// вызов из Go, минуя машину. После окончания выполнения, создавшего
+// функцию, вызов ограничен только глубиной вызовов
+func (c *closureValue) Call(args ...value.Value) (value.Value, error) {
+	budget := c.budget
+	if budget == nil || budget.finished.Load() {
+		budget = NewBudget(nil, Limits{})
+	}
+	return c.call(budget, args)
+}
+
+func (c *closureValue) call(budget *Budget, args []value.Value) (value.Value, error) {
+	if budget != nil {
+		if err := budget.enter(); err != nil {
+			return nil, err
+		}
+		defer budget.exit()
+		if err := budget.spend(0); err != nil {
+			return nil, err
+		}
+	}
+
+	f := c.frame
+	if c.proto.code.slots > 0 {
+		f = newFrame(c.proto.code.slots, f)
+	}
+	return execute(c.proto.code, f, c.globals, budget, true, args)
+}
+
+// объект и индекс места присваивания; под значением переменной лежат
+// значения индексов в порядке вычисления, от внешнего шага цепочки к внутреннему
+func (m *machine) ref(members []bool) error {
+	obj := m.pop()
+	n := len(members)
+	steps := m.stack[len(m.stack)-n:]
+
+	var err error
+	for i := n - 1; i >= 0; i-- {
+		if members[i] {
+			if err := checkMember(obj, steps[i].Text()); err != nil {
+				return err
+			}
+		}
+
+		if i == 0 {
+			break
+		}
+
+		obj, err = obj.ElByIndex(steps[i])
+		if err != nil {
+			return err
+		}
+	}
+
+	index := steps[0]
+	clear(steps)
+	m.stack = m.stack[:len(m.stack)-n]
+	m.push(obj)
+	m.push(index)
+	return nil
+}
+
+func (m *machine) unpackArray(n int, rest bool) error {
+	v := m.pop()
+	if v.Type() != value.ArrayType {
+		return cannotDestructure(v.Type(), "массив")
+	}
+	arr, err := elements(v)
+	if err != nil {
+		return err
+	}
+
+	if !rest && len(arr) > n {
+		return tooManyElements(n, len(arr))
+	}
+
+	m.aux = append(m.aux, arr)
+	return nil
+}
+
+func newIterator(v value.Value, two bool) (*iterator, error) {
+	it := &iterator{v: v, two: two}
+
+	switch v.Type() {
+	case value.IntType, value.RealType:
+		if two {
+			_, err := v.Iter2()
+			return nil, err
+		}
+		n, err := v.Int()
+		if err != nil {
+			return nil, err
+		}
+		it.n = int(max(n, 0))
+
+	case value.TextType, value.ArrayType:
+		n, err := v.Len()
+		if err != nil {
+			return nil, err
+		}
+		it.n = int(n)
+
+	case value.ObjectType:
+		keys, err := v.Iter()
+		if err != nil {
+			return nil, err
+		}
+		for k := range keys {
+			it.keys = append(it.keys, k)
+		}
+		it.n = len(it.keys)
+
+	default:
+		var err error
+		if two {
+			_, err = v.Iter2()
+		} else {
+			_, err = v.Iter()
+		}
+		return nil, err
+	}
+
+	return it, nil
+}
+
+// кладет на стек значения следующей итерации: для двух получателей
+// значение, затем ключ, чтобы первым связывался ключ
+func (it *iterator) next(m *machine) error {
+	var key value.Value
+	if it.keys != nil {
+		key = it.keys[it.i]
+	} else {
+		key = value.Int(int64(it.i))
+	}
+	it.i++
+
+	if it.two {
+		v, err := it.v.ElByIndex(key)
+		if err != nil {
+			return err
+		}
+		m.push(v)
+	}
+	m.push(key)
+	return nil
+}
+
+// ОПЕРАЦИИ:
+
+var indexable = []string{value.TextType, value.ArrayType, value.ObjectType, value.ErrorType}
+
+var members = []string{value.ObjectType, value.ErrorType}
+
+func checkType(op string, v value.Value, whitelist []string) error {
+	if slices.Contains(whitelist, v.Type()) {
+		return nil
+	}
+	return opNotDefined(op, v.Type())
+}
+
+type arithmeticOp struct {
+	name string
+	real func(a, b float64) float64
+	int  func(a, b int64) int64
+	//деление: второй операнд не может быть нулем
+	div bool
+}
+
+var arithmeticOps = [...]arithmeticOp{
+	opAdd: {"+", addOp[float64], addOp[int64], false},
+	opSub: {"-", subOp[float64], subOp[int64], false},
+	opMul: {"*", mulOp[float64], mulOp[int64], false},
+	opDiv: {"/", divOp[float64], divOp[int64], true},
+	opMod: {"%", math.Mod, func(a, b int64) int64 { return a % b }, true},
+}
+
+func arithmetic(code opcode, a, b value.Value) (value.Value, error) {
+	op := arithmeticOps[code]
+
+	//целые числа - самый частый случай, проверки типов не нужны
+	if a.Type() == value.IntType && b.Type() == value.IntType {
+		x, _ := a.Int()
+		y, _ := b.Int()
+		if op.div && y == 0 {
+			return nil, divByZero()
+		}
+		return value.Int(op.int(x, y)), nil
+	}
+
+	if err := checkType(op.name, a, baseWhitelist); err != nil {
+		return nil, err
+	}
+	if err := checkType(op.name, b, baseWhitelist); err != nil {
+		return nil, err
+	}
+	if op.div {
+		if err := checkDivByZero(a, b); err != nil {
+			return nil, err
+		}
+	}
+
+	if a.IsReal() || b.IsReal() {
+		a, b, err := binaryToReal(a, b)
+		if err != nil {
+			return nil, err
+		}
+		return value.Real(op.real(a, b)), nil
+	}
+
+	x, y, err := binaryToInt(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return value.Int(op.int(x, y)), nil
+}
+
+type comparisonOp struct {
+	name string
+	text func(a, b string) bool
+	real func(a, b float64) bool
+}
+
+var comparisonOps = [...]comparisonOp{
+	opEq:  {"==", eqOp[string], eqOp[float64]},
+	opNeq: {"!=", neqOp[string], neqOp[float64]},
+	opLt:  {"<", ltOp[string], ltOp[float64]},
+	opGt:  {">", gtOp[string], gtOp[float64]},
+	opLte: {"<=", lteOp[string], lteOp[float64]},
+	opGte: {">=", gteOp[string], gteOp[float64]},
+}
+
+func comparison(code opcode, a, b value.Value) (value.Value, error) {
+	op := comparisonOps[code]
+
+	if err := checkType(op.name, a, baseWhitelist); err != nil {
+		return nil, err
+	}
+	if err := checkType(op.name, b, baseWhitelist); err != nil {
+		return nil, err
+	}
+
+	if a.IsText() && b.IsText() {
+		return value.Bool(op.text(a.Text(), b.Text())), nil
+	}
+
+	x, y, err := binaryToReal(a, b)
+	if err != nil {
+		return nil, err
+	}
+	return value.Bool(op.real(x, y)), nil
+}
+
+func negate(v value.Value) (value.Value, error) {
+	if err := checkType("унарный -", v, baseWhitelist); err != nil {
+		return nil, err
+	}
+
+	if v.IsReal() {
+		r, err := v.Real()
+		if err != nil {
+			return nil, err
+		}
+		return value.Real(-r), nil
+	}
+
+	i, err := v.Int()
+	if err != nil {
+		return nil, err
+	}
+	return value.Int(-i), nil
+}
+
+func elByIndexOf(v, index value.Value) (value.Value, error) {
+	if v.Type() == value.ObjectType || v.Type() == value.ErrorType {
+		return v.ElByIndex(index)
+	}
+
+	if index.Type() != value.SliceType &&
+		!slices.Contains(baseWhitelist, index.Type()) {
+		return nil, wrongIndex(index.Type())
+	}
+
+	return v.ElByIndex(index)
+}
+
+// ошибка throw: значение ошибки выбрасывается как есть,
+// любое другое значение становится сообщением ошибки вида error
+func throw(v value.Value) error {
+	if v.Type() != value.ErrorType {
+		return throwErr{message: v.Text(), kind: value.ErrorKind}
+	}
+
+	field := func(name string) value.Value {
+		f, _ := v.ElByIndex(value.Text(name))
+		return f
+	}
+
+	t := throwErr{message: field("message").Text(), kind: field("kind").Text()}
+
+	//повторно выброшенная ошибка сохраняет исходную позицию
+	line, _ := field("line").Int()
+	column, _ := field("column").Int()
+	if line > 0 {
+		return &pos.Error{Pos: pos.Pos{Line: int(line), Column: int(column)}, Err: t}
+	}
+
+	return t
+}
+
+func importModule(ns namespace.Namespace, path string) (value.Value, error) {
+	load, err := ns.Get(ImportName)
+	if err != nil {
+		return nil, importUnavailable()
+	}
+	return load.Call(value.Text(path))
+}
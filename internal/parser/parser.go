@@ -1,19 +1,36 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
+	"github.com/suprunchuksergey/dpl/ast"
 	"github.com/suprunchuksergey/dpl/internal/lexer"
-	"github.com/suprunchuksergey/dpl/internal/node"
+	"github.com/suprunchuksergey/dpl/internal/pos"
 	"strconv"
 )
 
 type parser struct {
 	tokens []lexer.Token
 	index  int
+	//сохранять в узлах участки исходного кода
+	spans bool
+	//продолжать разбор после ошибок, ошибки сохраняются в errors
+	recovering bool
+	errors     []error
+	//метки циклов, внутри которых находится разбираемая конструкция
+	//(пустая строка - цикл без метки); сбрасываются в теле функции
+	loops []string
 }
 
 func newParser(tokens []lexer.Token) *parser {
-	return &parser{tokens: tokens}
+	//комментарии не участвуют в разборе
+	filtered := make([]lexer.Token, 0, len(tokens))
+	for _, token := range tokens {
+		if token.ID() != lexer.Comment {
+			filtered = append(filtered, token)
+		}
+	}
+	return &parser{tokens: filtered}
 }
 
 func (p *parser) next() { p.index++ }
@@ -22,17 +39,103 @@ func (p *parser) token() lexer.Token { return p.tokens[p.index] }
 
 func (p *parser) id() uint8 { return p.token().ID() }
 
+// привязывает узел к участку исходного кода
+// от токена start до последнего прочитанного токена
+func at[T ast.Node](p *parser, start lexer.Token, n T) T {
+	if !p.spans {
+		return n
+	}
+
+	end := start.End()
+	if p.index > 0 {
+		end = p.tokens[p.index-1].End()
+	}
+
+	ast.SetSpan(n, pos.Span{Start: start.Pos(), End: end})
+	return n
+}
+
+func (p *parser) at(start lexer.Token, n ast.Node) ast.Node { return at(p, start, n) }
+
 func unexpectedToken(token lexer.Token) error {
-	return fmt.Errorf("неожиданный токен %s", token)
+	return pos.Wrap(fmt.Errorf("неожиданный токен %s", token), token.Pos())
+}
+
+func outsideLoop(token lexer.Token) error {
+	return pos.Wrap(fmt.Errorf("%s может использоваться только в цикле", token), token.Pos())
+}
+
+func notTopLevel(token lexer.Token) error {
+	return pos.Wrap(fmt.Errorf("%s может использоваться только на верхнем уровне модуля", token), token.Pos())
+}
+
+func positionalAfterNamed(token lexer.Token) error {
+	return pos.Wrap(errors.New("позиционный аргумент после именованного"), token.Pos())
+}
+
+func labelNotFound(token lexer.Token, label string) error {
+	return pos.Wrap(fmt.Errorf("метка %s не найдена", label), token.Pos())
+}
+
+func labelAlreadyUsed(token lexer.Token, label string) error {
+	return pos.Wrap(fmt.Errorf("метка %s уже используется", label), token.Pos())
+}
+
+func intOutOfRange(value string) error {
+	return fmt.Errorf("целое число %s не помещается в 64 бита", value)
+}
+
+func realOutOfRange(value string) error {
+	return fmt.Errorf("вещественное число %s вне допустимого диапазона", value)
+}
+
+func wrongNumber(value string) error {
+	return fmt.Errorf("неверное число %s", value)
+}
+
+// разбирает значение токена Int: 2187, 0xff, 0o17, 0b1010
+func parseInt(value string) (int64, error) {
+	digits, base := value, 10
+	if len(value) > 2 && value[0] == '0' {
+		switch value[1] {
+		case 'x':
+			digits, base = value[2:], 16
+		case 'o':
+			digits, base = value[2:], 8
+		case 'b':
+			digits, base = value[2:], 2
+		}
+	}
+
+	n, err := strconv.ParseInt(digits, base, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, intOutOfRange(value)
+		}
+		return 0, wrongNumber(value)
+	}
+	return n, nil
+}
+
+// разбирает значение токена Real: 2.187, 2.187e3
+func parseReal(value string) (float64, error) {
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		if errors.Is(err, strconv.ErrRange) {
+			return 0, realOutOfRange(value)
+		}
+		return 0, wrongNumber(value)
+	}
+	return n, nil
 }
 
-func (p *parser) commands(sep, stop uint8, handler func() (node.Node, error)) ([]node.Node, error) {
+func (p *parser) commands(sep, stop uint8, handler func() (ast.Node, error)) ([]ast.Node, error) {
 	if p.id() == stop {
 		p.next()
 		return nil, nil
 	}
 
-	var nodes []node.Node
+	var nodes []ast.Node
 	for {
 		n, err := handler()
 		if err != nil {
@@ -59,82 +162,84 @@ func (p *parser) commands(sep, stop uint8, handler func() (node.Node, error)) ([
 	return nodes, nil
 }
 
-func (p *parser) value() (node.Node, error) {
+func (p *parser) value() (ast.Node, error) {
+	start := p.token()
+
+	n, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.at(start, n), nil
+}
+
+func (p *parser) literal() (ast.Node, error) {
 	switch p.id() {
 	case lexer.Null:
 		p.next()
-		return node.Null(), nil
+		return &ast.Null{}, nil
 	case lexer.False:
 		p.next()
-		return node.Bool(false), nil
+		return &ast.Bool{Value: false}, nil
 	case lexer.True:
 		p.next()
-		return node.Bool(true), nil
+		return &ast.Bool{Value: true}, nil
 	case lexer.Ident:
 		value := p.token().(lexer.TokenWithValue).Value()
 		p.next()
-		return node.Ident(value), nil
+		return &ast.Ident{Name: value}, nil
 	case lexer.Int:
 		value := p.token().(lexer.TokenWithValue).Value()
 		p.next()
-		n, err := strconv.ParseInt(value, 10, 64)
+		n, err := parseInt(value)
 		if err != nil {
-			return nil, err
+			return nil, pos.Wrap(err, p.tokens[p.index-1].Pos())
 		}
-		return node.Int(n), nil
+		return &ast.Int{Value: n}, nil
 	case lexer.Real:
 		value := p.token().(lexer.TokenWithValue).Value()
 		p.next()
-		n, err := strconv.ParseFloat(value, 64)
+		n, err := parseReal(value)
 		if err != nil {
-			return nil, err
+			return nil, pos.Wrap(err, p.tokens[p.index-1].Pos())
 		}
-		return node.Real(n), nil
+		return &ast.Real{Value: n}, nil
 	case lexer.Text:
 		value := p.token().(lexer.TokenWithValue).Value()
 		p.next()
-		return node.Text(value), nil
+		return &ast.Text{Value: value}, nil
+	case lexer.InterpStart:
+		return p.interpolation()
 	case lexer.LBrack:
 		p.next()
 
-		nodes, err := p.commands(lexer.Comma, lexer.RBrack, p.expression)
+		nodes, err := p.commands(lexer.Comma, lexer.RBrack, p.spreadable)
 		if err != nil {
 			return nil, err
 		}
 
-		return node.Array(nodes...), nil
+		return &ast.Array{Elems: nodes}, nil
 	case lexer.LBrace:
 		p.next()
 
 		if p.id() == lexer.RBrace {
 			p.next()
-			return node.Object(), nil
+			return &ast.Object{}, nil
 		}
 
-		pairs := make([]node.KV, 0)
+		pairs := make([]ast.Pair, 0)
 		for {
-			k, err := p.expression()
-			if err != nil {
-				return nil, err
-			}
-
-			if p.id() != lexer.Colon {
-				return nil, unexpectedToken(p.token())
-			}
-			p.next()
-
-			v, err := p.expression()
+			pair, err := p.pair()
 			if err != nil {
 				return nil, err
 			}
-
-			pairs = append(pairs, node.KV{Key: k, Value: v})
+			pairs = append(pairs, pair)
 
 			if p.id() == lexer.Comma {
 				p.next()
 				if p.id() == lexer.RBrace {
 					p.next()
-					return node.Object(pairs...), nil
+					return &ast.Object{Pairs: pairs}, nil
 				}
 				continue
 			}
@@ -146,38 +251,117 @@ func (p *parser) value() (node.Node, error) {
 		}
 		p.next()
 
-		return node.Object(pairs...), nil
+		return &ast.Object{Pairs: pairs}, nil
 
 	default:
 		return nil, unexpectedToken(p.token())
 	}
 }
 
-func (p *parser) paren() (node.Node, error) {
-	if p.id() != lexer.LParen {
-		return p.value()
+// пара объекта: expression : expression или ...expression
+func (p *parser) pair() (ast.Pair, error) {
+	if p.id() == lexer.Ellipsis {
+		v, err := p.spreadable()
+		if err != nil {
+			return ast.Pair{}, err
+		}
+		return ast.Pair{Value: v}, nil
+	}
+
+	k, err := p.expression()
+	if err != nil {
+		return ast.Pair{}, err
+	}
+
+	if p.id() != lexer.Colon {
+		return ast.Pair{}, unexpectedToken(p.token())
 	}
 	p.next()
 
-	nodes, err := p.commands(lexer.Comma, lexer.RParen, p.expression)
+	v, err := p.expression()
 	if err != nil {
-		return nil, err
+		return ast.Pair{}, err
 	}
 
-	if p.id() == lexer.ArrowRight {
+	return ast.Pair{Key: k, Value: v}, nil
+}
+
+// строка с подстановками: InterpStart выражение (InterpMid выражение)* InterpEnd
+func (p *parser) interpolation() (ast.Node, error) {
+	parts := make([]ast.Node, 0)
+
+	text := func() {
+		start := p.token()
+		value := start.(lexer.TokenWithValue).Value()
 		p.next()
+		if len(value) != 0 {
+			parts = append(parts, p.at(start, &ast.Text{Value: value}))
+		}
+	}
+
+	text()
+	for {
+		n, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, n)
+
+		switch p.id() {
+		case lexer.InterpMid:
+			text()
+		case lexer.InterpEnd:
+			text()
+			return &ast.Interpolation{Parts: parts}, nil
+		default:
+			return nil, unexpectedToken(p.token())
+		}
+	}
+}
+
+func (p *parser) paren() (ast.Node, error) {
+	if p.id() != lexer.LParen {
+		return p.value()
+	}
+	start := p.token()
+	p.next()
 
-		if p.id() != lexer.LBrace {
+	//параметры функции могут быть шаблонами деструктуризации
+	var rest ast.Node
+	nodes, patternErr := try(p, func() ([]ast.Node, error) {
+		var nodes []ast.Node
+		var err error
+		nodes, rest, err = p.params()
+		if err != nil {
+			return nil, err
+		}
+		if p.id() != lexer.ArrowRight {
 			return nil, unexpectedToken(p.token())
 		}
+		return nodes, nil
+	})
+
+	if patternErr != nil {
+		var err error
+		nodes, err = p.commands(lexer.Comma, lexer.RParen, p.expression)
+		if err != nil {
+			return nil, further(patternErr, err)
+		}
+	}
+
+	if p.id() == lexer.ArrowRight {
 		p.next()
 
-		cmds, err := p.commands(lexer.Semicolon, lexer.RBrace, p.construction)
+		//break и continue в теле функции не относятся к внешним циклам
+		loops := p.loops
+		p.loops = nil
+		body, err := p.block()
+		p.loops = loops
 		if err != nil {
 			return nil, err
 		}
 
-		return node.Function(node.Block(cmds...), nodes...), nil
+		return p.at(start, &ast.Function{Params: nodes, Rest: rest, Body: body}), nil
 	}
 
 	if len(nodes) == 1 {
@@ -187,7 +371,122 @@ func (p *parser) paren() (node.Node, error) {
 	return nil, unexpectedToken(p.token())
 }
 
-func (p *parser) elByIndex() (node.Node, error) {
+// параметры функции после (: pattern [= expression], ..., ...pattern)
+func (p *parser) params() ([]ast.Node, ast.Node, error) {
+	var params []ast.Node
+	for {
+		if p.id() == lexer.RParen {
+			p.next()
+			return params, nil, nil
+		}
+
+		if p.id() == lexer.Ellipsis {
+			rest, err := p.patternRest(lexer.RParen)
+			if err != nil {
+				return nil, nil, err
+			}
+			return params, rest, nil
+		}
+
+		param, err := p.patternWithDefault()
+		if err != nil {
+			return nil, nil, err
+		}
+		params = append(params, param)
+
+		if p.id() == lexer.Comma {
+			p.next()
+			continue
+		}
+		if p.id() != lexer.RParen {
+			return nil, nil, unexpectedToken(p.token())
+		}
+	}
+}
+
+// элемент массива или аргумент вызова: expression или ...expression
+func (p *parser) spreadable() (ast.Node, error) {
+	if p.id() != lexer.Ellipsis {
+		return p.expression()
+	}
+	start := p.token()
+	p.next()
+
+	v, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.at(start, &ast.Spread{X: v}), nil
+}
+
+// аргумент вызова: expression, ...expression или name: expression
+func (p *parser) argument() (ast.Node, error) {
+	if p.id() != lexer.Ident || !p.peek(lexer.Colon) {
+		return p.spreadable()
+	}
+	start := p.token()
+	name := start.(lexer.TokenWithValue).Value()
+	p.next()
+	p.next()
+
+	v, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.at(start, &ast.Named{Name: name, Value: v}), nil
+}
+
+// индекс в квадратных скобках: [expression] или срез [start:end:step],
+// любая часть среза может отсутствовать
+func (p *parser) subscript() (ast.Node, error) {
+	start := p.token()
+	p.next()
+
+	//часть среза до : или ]
+	part := func() (ast.Node, error) {
+		if p.id() == lexer.Colon || p.id() == lexer.RBrack {
+			return nil, nil
+		}
+		return p.expression()
+	}
+
+	parts := make([]ast.Node, 0, 3)
+	for {
+		n, err := part()
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, n)
+
+		if p.id() != lexer.Colon || len(parts) == 3 {
+			break
+		}
+		p.next()
+	}
+
+	if p.id() != lexer.RBrack {
+		return nil, unexpectedToken(p.token())
+	}
+	p.next()
+
+	if len(parts) == 1 {
+		if parts[0] == nil {
+			return nil, unexpectedToken(p.tokens[p.index-1])
+		}
+		return parts[0], nil
+	}
+
+	for len(parts) < 3 {
+		parts = append(parts, nil)
+	}
+	return p.at(start, &ast.Slice{Start: parts[0], End: parts[1], Step: parts[2]}), nil
+}
+
+func (p *parser) elByIndex() (ast.Node, error) {
+	start := p.token()
+
 	n, err := p.paren()
 	if err != nil {
 		return nil, err
@@ -195,31 +494,51 @@ func (p *parser) elByIndex() (node.Node, error) {
 
 	for {
 		if p.id() == lexer.LBrack {
-			p.next()
-
-			i, err := p.expression()
+			i, err := p.subscript()
 			if err != nil {
 				return nil, err
 			}
 
-			if p.id() != lexer.RBrack {
+			n = p.at(start, &ast.Index{X: n, Index: i})
+			continue
+		}
+
+		if p.id() == lexer.Dot {
+			p.next()
+
+			if p.id() != lexer.Ident {
 				return nil, unexpectedToken(p.token())
 			}
+			name := p.token().(lexer.TokenWithValue).Value()
 			p.next()
 
-			n = node.ElByIndex(n, i)
+			n = p.at(start, &ast.Member{X: n, Name: name})
 			continue
 		}
 
 		if p.id() == lexer.LParen {
 			p.next()
 
-			nodes, err := p.commands(lexer.Comma, lexer.RParen, p.expression)
+			//позиционные аргументы (в том числе ...x) передаются до именованных
+			named := false
+			nodes, err := p.commands(lexer.Comma, lexer.RParen, func() (ast.Node, error) {
+				tok := p.token()
+				arg, err := p.argument()
+				if err != nil {
+					return nil, err
+				}
+				if _, ok := arg.(*ast.Named); ok {
+					named = true
+				} else if named {
+					return nil, positionalAfterNamed(tok)
+				}
+				return arg, nil
+			})
 			if err != nil {
 				return nil, err
 			}
 
-			n = node.Call(n, nodes...)
+			n = p.at(start, &ast.Call{Fn: n, Args: nodes})
 			continue
 		}
 
@@ -229,20 +548,42 @@ func (p *parser) elByIndex() (node.Node, error) {
 	return n, nil
 }
 
-func (p *parser) neg() (node.Node, error) {
+func (p *parser) neg() (ast.Node, error) {
 	if p.id() != lexer.Sub {
 		return p.elByIndex()
 	}
+	start := p.token()
 	p.next()
 
 	v, err := p.neg()
 	if err != nil {
 		return nil, err
 	}
-	return node.Neg(v), nil
+	return p.at(start, &ast.Unary{Op: ast.Neg, X: v}), nil
+}
+
+// бинарные операторы
+var binaryOps = map[uint8]ast.Op{
+	lexer.Add:      ast.Add,
+	lexer.Sub:      ast.Sub,
+	lexer.Mul:      ast.Mul,
+	lexer.Div:      ast.Div,
+	lexer.Mod:      ast.Mod,
+	lexer.Eq:       ast.Eq,
+	lexer.Neq:      ast.Neq,
+	lexer.Lt:       ast.Lt,
+	lexer.Gt:       ast.Gt,
+	lexer.Lte:      ast.Lte,
+	lexer.Gte:      ast.Gte,
+	lexer.And:      ast.And,
+	lexer.Or:       ast.Or,
+	lexer.AndValue: ast.AndValue,
+	lexer.OrValue:  ast.OrValue,
 }
 
-func (p *parser) mul() (node.Node, error) {
+func (p *parser) mul() (ast.Node, error) {
+	start := p.token()
+
 	n, err := p.neg()
 	if err != nil {
 		return nil, err
@@ -257,22 +598,15 @@ func (p *parser) mul() (node.Node, error) {
 			return nil, err
 		}
 
-		switch id {
-		case lexer.Mul:
-			n = node.Mul(n, v)
-		case lexer.Div:
-			n = node.Div(n, v)
-		case lexer.Mod:
-			n = node.Mod(n, v)
-		default:
-			panic("недостижимый")
-		}
+		n = p.at(start, &ast.Binary{Op: binaryOps[id], X: n, Y: v})
 	}
 
 	return n, nil
 }
 
-func (p *parser) add() (node.Node, error) {
+func (p *parser) add() (ast.Node, error) {
+	start := p.token()
+
 	n, err := p.mul()
 	if err != nil {
 		return nil, err
@@ -287,20 +621,15 @@ func (p *parser) add() (node.Node, error) {
 			return nil, err
 		}
 
-		switch id {
-		case lexer.Add:
-			n = node.Add(n, v)
-		case lexer.Sub:
-			n = node.Sub(n, v)
-		default:
-			panic("недостижимый")
-		}
+		n = p.at(start, &ast.Binary{Op: binaryOps[id], X: n, Y: v})
 	}
 
 	return n, nil
 }
 
-func (p *parser) concat() (node.Node, error) {
+func (p *parser) concat() (ast.Node, error) {
+	start := p.token()
+
 	n, err := p.add()
 	if err != nil {
 		return nil, err
@@ -314,13 +643,15 @@ func (p *parser) concat() (node.Node, error) {
 			return nil, err
 		}
 
-		n = node.Concat(n, v)
+		n = p.at(start, &ast.Binary{Op: ast.Concat, X: n, Y: v})
 	}
 
 	return n, nil
 }
 
-func (p *parser) eq() (node.Node, error) {
+func (p *parser) eq() (ast.Node, error) {
+	start := p.token()
+
 	n, err := p.concat()
 	if err != nil {
 		return nil, err
@@ -341,47 +672,36 @@ func (p *parser) eq() (node.Node, error) {
 			return nil, err
 		}
 
-		switch id {
-		case lexer.Eq:
-			n = node.Eq(n, v)
-		case lexer.Neq:
-			n = node.Neq(n, v)
-		case lexer.Lt:
-			n = node.Lt(n, v)
-		case lexer.Lte:
-			n = node.Lte(n, v)
-		case lexer.Gt:
-			n = node.Gt(n, v)
-		case lexer.Gte:
-			n = node.Gte(n, v)
-		default:
-			panic("недостижимый")
-		}
+		n = p.at(start, &ast.Binary{Op: binaryOps[id], X: n, Y: v})
 	}
 
 	return n, nil
 }
 
-func (p *parser) not() (node.Node, error) {
+func (p *parser) not() (ast.Node, error) {
 	if p.id() != lexer.Not {
 		return p.eq()
 	}
+	start := p.token()
 	p.next()
 
 	v, err := p.not()
 	if err != nil {
 		return nil, err
 	}
-	return node.Not(v), nil
+	return p.at(start, &ast.Unary{Op: ast.Not, X: v}), nil
 }
 
-func (p *parser) and() (node.Node, error) {
+func (p *parser) and() (ast.Node, error) {
+	start := p.token()
+
 	n, err := p.not()
 	if err != nil {
 		return nil, err
 	}
 
-	for p.id() == lexer.And {
+	for p.id() == lexer.And || p.id() == lexer.AndValue {
+		id := p.id()
 		p.next()
 
 		v, err := p.not()
@@ -389,19 +709,22 @@ func (p *parser) and() (node.Node, error) {
 			return nil, err
 		}
 
-		n = node.And(n, v)
+		n = p.at(start, &ast.Binary{Op: binaryOps[id], X: n, Y: v})
 	}
 
 	return n, nil
 }
 
-func (p *parser) or() (node.Node, error) {
+func (p *parser) or() (ast.Node, error) {
+	start := p.token()
+
 	n, err := p.and()
 	if err != nil {
 		return nil, err
 	}
 
-	for p.id() == lexer.Or {
+	for p.id() == lexer.Or || p.id() == lexer.OrValue {
+		id := p.id()
 		p.next()
 
 		v, err := p.and()
@@ -409,96 +732,414 @@ func (p *parser) or() (node.Node, error) {
 			return nil, err
 		}
 
-		n = node.Or(n, v)
+		n = p.at(start, &ast.Binary{Op: binaryOps[id], X: n, Y: v})
 	}
 
 	return n, nil
 }
 
-func (p *parser) set() (node.Node, error) {
-	n, err := p.or()
-	if err != nil {
-		return nil, err
-	}
-
-	if p.id() != lexer.Set && p.id() != lexer.Create {
-		return n, nil
-	}
-
-	id := p.id()
-	p.next()
+// пробует выполнить разбор с помощью parse; при ошибке позиция разбора
+// и список сохраненных ошибок восстанавливаются
+func try[T any](p *parser, parse func() (T, error)) (T, error) {
+	index, errs := p.index, len(p.errors)
 
-	v, err := p.set()
+	n, err := parse()
 	if err != nil {
-		return nil, err
+		p.index, p.errors = index, p.errors[:errs]
 	}
 
-	if id == lexer.Set {
-		return node.Set(n, v), nil
+	return n, err
+}
+
+// из ошибок двух вариантов разбора выбирает ту, что возникла дальше в тексте
+func further(a, b error) error {
+	var ea, eb *pos.Error
+	if errors.As(a, &ea) && errors.As(b, &eb) && ea.Pos.Offset > eb.Pos.Offset {
+		return a
 	}
-	return node.Create(n, v), nil
+	return b
 }
 
-func (p *parser) expression() (node.Node, error) { return p.set() }
+// получатель: идентификатор с цепочкой индексов и полей (a, a[0].b)
+// или шаблон деструктуризации
+func (p *parser) pattern() (ast.Node, error) {
+	switch p.id() {
+	case lexer.LBrack:
+		return p.arrayPattern()
+	case lexer.LBrace:
+		return p.objectPattern()
+	case lexer.Ident:
+	default:
+		return nil, unexpectedToken(p.token())
+	}
 
-func (p *parser) branch() (node.Node, error) {
-	if p.id() != lexer.If {
-		return p.expression()
+	start := p.token()
+	n, err := p.value()
+	if err != nil {
+		return nil, err
 	}
 
-	branches := make([]node.Branch, 0)
 	for {
-		p.next()
+		switch p.id() {
+		case lexer.LBrack:
+			i, err := p.subscript()
+			if err != nil {
+				return nil, err
+			}
 
-		cond, err := p.expression()
-		if err != nil {
-			return nil, err
-		}
+			n = p.at(start, &ast.Index{X: n, Index: i})
 
-		if p.id() != lexer.LBrace {
-			return nil, unexpectedToken(p.token())
-		}
-		p.next()
+		case lexer.Dot:
+			p.next()
 
-		cmds, err := p.commands(lexer.Semicolon, lexer.RBrace, p.construction)
-		if err != nil {
-			return nil, err
-		}
+			if p.id() != lexer.Ident {
+				return nil, unexpectedToken(p.token())
+			}
+			name := p.token().(lexer.TokenWithValue).Value()
+			p.next()
 
-		branches = append(branches, node.Branch{Cond: cond, Body: node.Block(cmds...)})
+			n = p.at(start, &ast.Member{X: n, Name: name})
 
-		if p.id() != lexer.Elif {
-			break
+		default:
+			return n, nil
 		}
 	}
+}
 
-	if p.id() == lexer.Else {
-		p.next()
+// получатель со значением по умолчанию: pattern [= expression]
+func (p *parser) patternWithDefault() (ast.Node, error) {
+	start := p.token()
 
-		if p.id() != lexer.LBrace {
-			return nil, unexpectedToken(p.token())
-		}
-		p.next()
+	n, err := p.pattern()
+	if err != nil {
+		return nil, err
+	}
 
-		cmds, err := p.commands(lexer.Semicolon, lexer.RBrace, p.construction)
-		if err != nil {
-			return nil, err
-		}
+	if p.id() != lexer.Set {
+		return n, nil
+	}
+	p.next()
 
-		branches = append(branches, node.Branch{Cond: node.Bool(true), Body: node.Block(cmds...)})
+	v, err := p.expression()
+	if err != nil {
+		return nil, err
 	}
 
-	return node.If(branches...), nil
+	return p.at(start, &ast.Default{Target: n, Value: v}), nil
 }
 
-func (p *parser) loop() (node.Node, error) {
-	if p.id() != lexer.For {
+// остаток: ...pattern, должен быть последним элементом шаблона
+func (p *parser) patternRest(stop uint8) (ast.Node, error) {
+	p.next()
+
+	rest, err := p.pattern()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.id() == lexer.Comma {
+		p.next()
+	}
+	if p.id() != stop {
+		return nil, unexpectedToken(p.token())
+	}
+	p.next()
+
+	return rest, nil
+}
+
+// [pattern [= expression], ..., ...pattern]
+func (p *parser) arrayPattern() (ast.Node, error) {
+	start := p.token()
+	p.next()
+
+	var elems []ast.Node
+	var rest ast.Node
+	for {
+		if p.id() == lexer.RBrack {
+			p.next()
+			break
+		}
+
+		if p.id() == lexer.Ellipsis {
+			var err error
+			rest, err = p.patternRest(lexer.RBrack)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		elem, err := p.patternWithDefault()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, elem)
+
+		if p.id() == lexer.Comma {
+			p.next()
+			continue
+		}
+		if p.id() != lexer.RBrack {
+			return nil, unexpectedToken(p.token())
+		}
+	}
+
+	return p.at(start, &ast.ArrayPattern{Elems: elems, Rest: rest}), nil
+}
+
+// {name [: pattern] [= expression], "key": pattern, ..., ...pattern}
+func (p *parser) objectPattern() (ast.Node, error) {
+	start := p.token()
+	p.next()
+
+	var props []ast.Prop
+	var rest ast.Node
+	for {
+		if p.id() == lexer.RBrace {
+			p.next()
+			break
+		}
+
+		if p.id() == lexer.Ellipsis {
+			var err error
+			rest, err = p.patternRest(lexer.RBrace)
+			if err != nil {
+				return nil, err
+			}
+			break
+		}
+
+		if p.id() != lexer.Ident && p.id() != lexer.Text {
+			return nil, unexpectedToken(p.token())
+		}
+		key := p.token()
+		name := key.(lexer.TokenWithValue).Value()
+
+		var target ast.Node
+		var err error
+		if p.peek(lexer.Colon) {
+			p.next()
+			p.next()
+			target, err = p.patternWithDefault()
+		} else if key.ID() == lexer.Ident {
+			//сокращенная запись: {x} - то же, что {x: x}
+			target, err = p.patternWithDefault()
+		} else {
+			p.next()
+			err = unexpectedToken(p.token())
+		}
+		if err != nil {
+			return nil, err
+		}
+		props = append(props, ast.Prop{Key: name, Target: target})
+
+		if p.id() == lexer.Comma {
+			p.next()
+			continue
+		}
+		if p.id() != lexer.RBrace {
+			return nil, unexpectedToken(p.token())
+		}
+	}
+
+	return p.at(start, &ast.ObjectPattern{Props: props, Rest: rest}), nil
+}
+
+// операторы составного присваивания
+var compoundOps = map[uint8]ast.Op{
+	lexer.AddSet:    ast.Add,
+	lexer.SubSet:    ast.Sub,
+	lexer.MulSet:    ast.Mul,
+	lexer.DivSet:    ast.Div,
+	lexer.ModSet:    ast.Mod,
+	lexer.ConcatSet: ast.Concat,
+}
+
+// индекс токена, закрывающего скобку с индексом i
+func (p *parser) closing(i int) int {
+	depth := 0
+	for ; i < len(p.tokens); i++ {
+		switch p.tokens[i].ID() {
+		case lexer.LParen, lexer.LBrack, lexer.LBrace:
+			depth++
+		case lexer.RParen, lexer.RBrack, lexer.RBrace:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(p.tokens) - 1
+}
+
+// шаблон деструктуризации, за которым следует := или =
+func (p *parser) assignPattern() (ast.Node, error) {
+	n, err := p.pattern()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.id() != lexer.Set && p.id() != lexer.Create {
+		return nil, unexpectedToken(p.token())
+	}
+
+	return n, nil
+}
+
+func (p *parser) set() (ast.Node, error) {
+	start := p.token()
+
+	var n ast.Node
+	var patternErr error
+	if p.id() == lexer.LBrack || p.id() == lexer.LBrace {
+		n, patternErr = try(p, p.assignPattern)
+	}
+
+	if n == nil {
+		from := p.index
+
+		var err error
+		n, err = p.or()
+		if err != nil {
+			return nil, further(patternErr, err)
+		}
+
+		//литерал массива или объекта не может быть получателем,
+		//ошибка шаблона точнее: [...tail, head] := arr
+		if patternErr != nil && (p.id() == lexer.Set || p.id() == lexer.Create) &&
+			p.index == p.closing(from)+1 {
+			return nil, patternErr
+		}
+	}
+
+	if op, ok := compoundOps[p.id()]; ok {
+		p.next()
+
+		v, err := p.set()
+		if err != nil {
+			return nil, err
+		}
+
+		return p.at(start, &ast.Compound{Op: op, Target: n, Value: v}), nil
+	}
+
+	if p.id() != lexer.Set && p.id() != lexer.Create {
+		return n, nil
+	}
+
+	id := p.id()
+	p.next()
+
+	v, err := p.set()
+	if err != nil {
+		return nil, err
+	}
+
+	if id == lexer.Set {
+		return p.at(start, &ast.Set{Target: n, Value: v}), nil
+	}
+	return p.at(start, &ast.Create{Target: n, Value: v}), nil
+}
+
+func (p *parser) expression() (ast.Node, error) { return p.set() }
+
+func (p *parser) branch() (ast.Node, error) {
+	if p.id() != lexer.If {
+		return p.expression()
+	}
+
+	start := p.token()
+
+	n := &ast.If{Branches: make([]ast.Branch, 0)}
+	for {
+		p.next()
+
+		cond, err := p.expression()
+		if err != nil {
+			return nil, err
+		}
+
+		body, err := p.block()
+		if err != nil {
+			return nil, err
+		}
+
+		n.Branches = append(n.Branches, ast.Branch{Cond: cond, Body: body})
+
+		if p.id() != lexer.Elif {
+			break
+		}
+	}
+
+	if p.id() == lexer.Else {
+		p.next()
+
+		var err error
+		n.Else, err = p.block()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p.at(start, n), nil
+}
+
+// является ли токен после текущего указанным
+func (p *parser) peek(id uint8) bool {
+	return p.index+1 < len(p.tokens) && p.tokens[p.index+1].ID() == id
+}
+
+// цикл, возможно с меткой: [метка:] for ... { ... } | [метка:] while ... { ... }
+func (p *parser) loop() (ast.Node, error) {
+	start := p.token()
+
+	label := ""
+	if p.id() == lexer.Ident && p.peek(lexer.Colon) {
+		label = start.(lexer.TokenWithValue).Value()
+		p.next()
+		p.next()
+
+		if p.id() != lexer.For && p.id() != lexer.While {
+			return nil, unexpectedToken(p.token())
+		}
+
+		for _, l := range p.loops {
+			if l == label {
+				return nil, labelAlreadyUsed(start, label)
+			}
+		}
+	}
+
+	var n ast.Node
+	var err error
+	switch p.id() {
+	case lexer.For:
+		n, err = p.forLoop(label)
+	case lexer.While:
+		n, err = p.whileLoop(label)
+	default:
 		return p.branch()
 	}
+	if err != nil {
+		return nil, err
+	}
+
+	return p.at(start, n), nil
+}
 
+// тело цикла с меткой label
+func (p *parser) loopBody(label string) (*ast.Block, error) {
+	p.loops = append(p.loops, label)
+	body, err := p.block()
+	p.loops = p.loops[:len(p.loops)-1]
+	return body, err
+}
+
+func (p *parser) forLoop(label string) (ast.Node, error) {
 	p.next()
 
-	recipients, err := p.commands(lexer.Comma, lexer.In, p.value)
+	recipients, err := p.commands(lexer.Comma, lexer.In, p.pattern)
 	if err != nil {
 		return nil, err
 	}
@@ -508,24 +1149,36 @@ func (p *parser) loop() (node.Node, error) {
 		return nil, err
 	}
 
-	if p.id() != lexer.LBrace {
-		return nil, unexpectedToken(p.token())
+	body, err := p.loopBody(label)
+	if err != nil {
+		return nil, err
 	}
+
+	return &ast.For{Label: label, Targets: recipients, From: from, Body: body}, nil
+}
+
+func (p *parser) whileLoop(label string) (ast.Node, error) {
 	p.next()
 
-	cmds, err := p.commands(lexer.Semicolon, lexer.RBrace, p.construction)
+	cond, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
 
-	return node.For(recipients, from, node.Block(cmds...)), nil
+	body, err := p.loopBody(label)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.While{Label: label, Cond: cond, Body: body}, nil
 }
 
-func (p *parser) ret() (node.Node, error) {
+func (p *parser) ret() (ast.Node, error) {
 	if p.id() != lexer.Return {
 		return p.loop()
 	}
 
+	start := p.token()
 	p.next()
 
 	v, err := p.expression()
@@ -533,17 +1186,311 @@ func (p *parser) ret() (node.Node, error) {
 		return nil, err
 	}
 
-	return node.Return(v), nil
+	return p.at(start, &ast.Return{Value: v}), nil
+}
+
+// break [метка] | continue [метка]
+func (p *parser) jump() (ast.Node, error) {
+	if p.id() != lexer.Break && p.id() != lexer.Continue {
+		return p.ret()
+	}
+
+	start := p.token()
+	p.next()
+
+	if len(p.loops) == 0 {
+		return nil, outsideLoop(start)
+	}
+
+	label := ""
+	if p.id() == lexer.Ident {
+		label = p.token().(lexer.TokenWithValue).Value()
+
+		found := false
+		for _, l := range p.loops {
+			if l == label {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, labelNotFound(p.token(), label)
+		}
+
+		p.next()
+	}
+
+	if start.ID() == lexer.Break {
+		return p.at(start, &ast.Break{Label: label}), nil
+	}
+	return p.at(start, &ast.Continue{Label: label}), nil
+}
+
+// { constructions }
+func (p *parser) block() (*ast.Block, error) {
+	if p.id() != lexer.LBrace {
+		return nil, unexpectedToken(p.token())
+	}
+	start := p.token()
+	p.next()
+
+	cmds, err := p.constructions(lexer.RBrace)
+	if err != nil {
+		return nil, err
+	}
+
+	return at(p, start, &ast.Block{List: cmds}), nil
+}
+
+// try {...} [catch [name] {...}] [finally {...}],
+// должен быть хотя бы один из catch и finally
+func (p *parser) tryCatch() (ast.Node, error) {
+	if p.id() != lexer.Try {
+		return p.jump()
+	}
+
+	start := p.token()
+	p.next()
+
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+
+	name := ""
+	var catch, finally *ast.Block
+
+	if p.id() == lexer.Catch {
+		p.next()
+
+		if p.id() == lexer.Ident {
+			name = p.token().(lexer.TokenWithValue).Value()
+			p.next()
+		}
+
+		catch, err = p.block()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if p.id() == lexer.Finally {
+		p.next()
+
+		finally, err = p.block()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if catch == nil && finally == nil {
+		return nil, unexpectedToken(p.token())
+	}
+
+	return p.at(start, &ast.Try{Body: body, Name: name, Catch: catch, Finally: finally}), nil
 }
 
-func (p *parser) construction() (node.Node, error) { return p.ret() }
+// throw expression
+func (p *parser) throw() (ast.Node, error) {
+	if p.id() != lexer.Throw {
+		return p.tryCatch()
+	}
+
+	start := p.token()
+	p.next()
 
-func (p *parser) parse() (node.Node, error) {
-	cmds, err := p.commands(lexer.Semicolon, lexer.EOF, p.construction)
+	v, err := p.expression()
 	if err != nil {
 		return nil, err
 	}
-	return node.Block(cmds...), nil
+
+	return p.at(start, &ast.Throw{Value: v}), nil
 }
 
-func Parse(tokens []lexer.Token) (node.Node, error) { return newParser(tokens).parse() }
+func (p *parser) construction() (ast.Node, error) {
+	if p.id() == lexer.Import || p.id() == lexer.Export {
+		return nil, notTopLevel(p.token())
+	}
+	return p.throw()
+}
+
+// import "path" as name
+func (p *parser) importModule() (ast.Node, error) {
+	start := p.token()
+	p.next()
+
+	if p.id() != lexer.Text {
+		return nil, unexpectedToken(p.token())
+	}
+	path := p.token().(lexer.TokenWithValue).Value()
+	p.next()
+
+	if p.id() != lexer.As {
+		return nil, unexpectedToken(p.token())
+	}
+	p.next()
+
+	if p.id() != lexer.Ident {
+		return nil, unexpectedToken(p.token())
+	}
+	name := p.token().(lexer.TokenWithValue).Value()
+	p.next()
+
+	return p.at(start, &ast.Import{Path: path, Name: name}), nil
+}
+
+// export pattern := expression
+func (p *parser) export() (ast.Node, error) {
+	start := p.token()
+	p.next()
+
+	target, err := p.pattern()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.id() != lexer.Create {
+		return nil, unexpectedToken(p.token())
+	}
+	p.next()
+
+	v, err := p.expression()
+	if err != nil {
+		return nil, err
+	}
+
+	return p.at(start, &ast.Export{Target: target, Value: v}), nil
+}
+
+// конструкция верхнего уровня: import, export или construction
+func (p *parser) statement() (ast.Node, error) {
+	switch p.id() {
+	case lexer.Import:
+		return p.importModule()
+	case lexer.Export:
+		return p.export()
+	default:
+		return p.construction()
+	}
+}
+
+// список конструкций, разделенных ;, до токена stop
+// на верхнем уровне (stop - EOF) допустимы также import и export
+func (p *parser) constructions(stop uint8) ([]ast.Node, error) {
+	handler := p.construction
+	if stop == lexer.EOF {
+		handler = p.statement
+	}
+
+	if !p.recovering {
+		return p.commands(lexer.Semicolon, stop, handler)
+	}
+
+	var nodes []ast.Node
+	for {
+		if p.id() == stop {
+			p.next()
+			return nodes, nil
+		}
+		if p.id() == lexer.EOF {
+			return nodes, unexpectedToken(p.token())
+		}
+
+		index := p.index
+		n, err := handler()
+		if err == nil {
+			nodes = append(nodes, n)
+
+			if p.id() == lexer.Semicolon {
+				p.next()
+				continue
+			}
+			if p.id() == stop {
+				continue
+			}
+			err = unexpectedToken(p.token())
+		}
+
+		p.report(err)
+		if p.index == index {
+			p.next()
+		}
+		p.sync()
+		if p.id() == lexer.Semicolon {
+			p.next()
+		}
+	}
+}
+
+// сохраняет ошибку, если в этой позиции ошибка еще не сохранена
+// (незакрытые вложенные блоки дают ошибку в конце текста на каждом уровне)
+func (p *parser) report(err error) {
+	if len(p.errors) != 0 {
+		var last, e *pos.Error
+		if errors.As(p.errors[len(p.errors)-1], &last) &&
+			errors.As(err, &e) && last.Pos == e.Pos {
+			return
+		}
+	}
+	p.errors = append(p.errors, err)
+}
+
+// пропускает токены до начала следующей конструкции:
+// до ;, до } (вложенные { } пропускаются целиком),
+// до ключевого слова, с которого начинается конструкция, или до конца текста
+func (p *parser) sync() {
+	depth := 0
+	for {
+		switch p.id() {
+		case lexer.EOF:
+			return
+		case lexer.LBrace:
+			depth++
+		case lexer.RBrace:
+			if depth == 0 {
+				return
+			}
+			depth--
+		case lexer.Semicolon, lexer.If, lexer.For, lexer.While,
+			lexer.Return, lexer.Break, lexer.Continue, lexer.Try, lexer.Throw,
+			lexer.Import, lexer.Export:
+			if depth == 0 {
+				return
+			}
+		}
+		p.next()
+	}
+}
+
+func (p *parser) parse() (*ast.Block, error) {
+	start := p.token()
+
+	cmds, err := p.constructions(lexer.EOF)
+	if err != nil {
+		return nil, err
+	}
+	return at(p, start, &ast.Block{List: cmds}), nil
+}
+
+func Parse(tokens []lexer.Token) (*ast.Block, error) {
+	p := newParser(tokens)
+	p.spans = true
+	return p.parse()
+}
+
+// разбирает программу, не останавливаясь на первой ошибке:
+// после ошибки разбор продолжается со следующей конструкции;
+// возвращает дерево из успешно разобранных конструкций
+// и все ошибки в порядке их появления
+func ParseRecover(tokens []lexer.Token) (*ast.Block, []error) {
+	p := newParser(tokens)
+	p.spans = true
+	p.recovering = true
+
+	n, err := p.parse()
+	if err != nil {
+		p.report(err)
+	}
+
+	return n, p.errors
+}
@@ -2,56 +2,98 @@ package parser
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/suprunchuksergey/dpl/ast"
 	"github.com/suprunchuksergey/dpl/internal/lexer"
-	"github.com/suprunchuksergey/dpl/internal/node"
+	"github.com/suprunchuksergey/dpl/internal/pos"
 	"testing"
 )
 
 func Test_value(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"null", node.Null(), nil},
-		{"false", node.Bool(false), nil},
-		{"true", node.Bool(true), nil},
-		{"2187", node.Int(2187), nil},
-		{"2.187", node.Real(2.187), nil},
-		{`"text"`, node.Text("text"), nil},
-
-		{"[]", node.Array(), nil},
-		{"[2187]", node.Array(node.Int(2187)), nil},
-		{"[2187,]", node.Array(node.Int(2187)), nil},
-		{`[2187,"text"]`, node.Array(node.Int(2187), node.Text("text")), nil},
+		{"null", &ast.Null{}, nil},
+		{"false", &ast.Bool{Value: false}, nil},
+		{"true", &ast.Bool{Value: true}, nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"2.187", &ast.Real{Value: 2.187}, nil},
+		{"1_000_000", &ast.Int{Value: 1000000}, nil},
+		{"0xFF", &ast.Int{Value: 255}, nil},
+		{"0o17", &ast.Int{Value: 15}, nil},
+		{"0b1010", &ast.Int{Value: 10}, nil},
+		{"1e6", &ast.Real{Value: 1e6}, nil},
+		{"2.5e-3", &ast.Real{Value: 2.5e-3}, nil},
+		{"9223372036854775807", &ast.Int{Value: 9223372036854775807}, nil},
+		{"0x7FFFFFFFFFFFFFFF", &ast.Int{Value: 9223372036854775807}, nil},
+		{`"text"`, &ast.Text{Value: "text"}, nil},
+		{`"x=${x}"`, &ast.Interpolation{Parts: []ast.Node{&ast.Text{Value: "x="}, &ast.Ident{Name: "x"}}}, nil},
+		{`"${x}"`, &ast.Interpolation{Parts: []ast.Node{&ast.Ident{Name: "x"}}}, nil},
+		{`"x=${x}, y=${y + 1}!"`, &ast.Interpolation{Parts: []ast.Node{
+			&ast.Text{Value: "x="},
+			&ast.Ident{Name: "x"},
+			&ast.Text{Value: ", y="},
+			&ast.Binary{Op: ast.Add, X: &ast.Ident{Name: "y"}, Y: &ast.Int{Value: 1}},
+			&ast.Text{Value: "!"},
+		}}, nil},
+		{`"a${"b${c}"}"`, &ast.Interpolation{Parts: []ast.Node{
+			&ast.Text{Value: "a"},
+			&ast.Interpolation{Parts: []ast.Node{&ast.Text{Value: "b"}, &ast.Ident{Name: "c"}}},
+		}}, nil},
+
+		{"[]", &ast.Array{}, nil},
+		{"[2187]", &ast.Array{Elems: []ast.Node{&ast.Int{Value: 2187}}}, nil},
+		{"[2187,]", &ast.Array{Elems: []ast.Node{&ast.Int{Value: 2187}}}, nil},
+		{`[2187,"text"]`, &ast.Array{Elems: []ast.Node{&ast.Int{Value: 2187}, &ast.Text{Value: "text"}}}, nil},
 		{`[2187,"text",[]]`,
-			node.Array(
-				node.Int(2187),
-				node.Text("text"),
-				node.Array(),
-			), nil},
+			&ast.Array{Elems: []ast.Node{
+				&ast.Int{Value: 2187},
+				&ast.Text{Value: "text"},
+				&ast.Array{},
+			}}, nil},
 		{`[2187,"text",[true]]`,
-			node.Array(
-				node.Int(2187),
-				node.Text("text"),
-				node.Array(node.Bool(true)),
-			), nil},
-
-		{"{}", node.Object(), nil},
-		{`{"text": 2187}`, node.Object(
-			node.KV{Key: node.Text("text"), Value: node.Int(2187)},
-		), nil},
-		{`{"text": 2187,}`, node.Object(
-			node.KV{Key: node.Text("text"), Value: node.Int(2187)},
-		), nil},
-		{`{"text": 2187,"name": "сергей"}`, node.Object(
-			node.KV{Key: node.Text("text"), Value: node.Int(2187)},
-			node.KV{Key: node.Text("name"), Value: node.Text("сергей")},
-		), nil},
-
-		{"name", node.Ident("name"), nil},
+			&ast.Array{Elems: []ast.Node{
+				&ast.Int{Value: 2187},
+				&ast.Text{Value: "text"},
+				&ast.Array{Elems: []ast.Node{&ast.Bool{Value: true}}},
+			}}, nil},
+
+		{"[...a, 1, ...b,]", &ast.Array{Elems: []ast.Node{
+			&ast.Spread{X: &ast.Ident{Name: "a"}},
+			&ast.Int{Value: 1},
+			&ast.Spread{X: &ast.Ident{Name: "b"}},
+		}}, nil},
+
+		{"{}", &ast.Object{}, nil},
+		{`{"text": 2187}`, &ast.Object{Pairs: []ast.Pair{
+			{Key: &ast.Text{Value: "text"}, Value: &ast.Int{Value: 2187}},
+		}}, nil},
+		{`{"text": 2187,}`, &ast.Object{Pairs: []ast.Pair{
+			{Key: &ast.Text{Value: "text"}, Value: &ast.Int{Value: 2187}},
+		}}, nil},
+		{`{"text": 2187,"name": "сергей"}`, &ast.Object{Pairs: []ast.Pair{
+			{Key: &ast.Text{Value: "text"}, Value: &ast.Int{Value: 2187}},
+			{Key: &ast.Text{Value: "name"}, Value: &ast.Text{Value: "сергей"}},
+		}}, nil},
+
+		{`{...defaults, "x": 1, ...overrides}`, &ast.Object{Pairs: []ast.Pair{
+			{Value: &ast.Spread{X: &ast.Ident{Name: "defaults"}}},
+			{Key: &ast.Text{Value: "x"}, Value: &ast.Int{Value: 1}},
+			{Value: &ast.Spread{X: &ast.Ident{Name: "overrides"}}},
+		}}, nil},
+
+		{"name", &ast.Ident{Name: "name"}, nil},
+
+		{"9223372036854775808", nil, intOutOfRange("9223372036854775808")},
+		{"0x8000000000000000", nil, intOutOfRange("0x8000000000000000")},
+		{"1e400", nil, realOutOfRange("1e400")},
 
 		{"+", nil, unexpectedToken(lexer.NewToken(lexer.Add))},
+		{`"a${x y}"`, nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Ident, "y"))},
+		{`"a${}"`, nil, unexpectedToken(lexer.NewTokenWithValue(lexer.InterpEnd, ""))},
+		{"[...]", nil, unexpectedToken(lexer.NewToken(lexer.RBrack))},
+		{"{...a: 1}", nil, unexpectedToken(lexer.NewToken(lexer.Colon))},
 		{"[2187", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
 		{`{"text": 2187`, nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
 		{`{"text" 2187}`, nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Int, "2187"))},
@@ -77,37 +119,73 @@ func Test_value(t *testing.T) {
 func Test_paren(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-
-		{"(2187)", node.Int(2187), nil},
-
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"(name) -> {}", node.Function(node.Block(), node.Ident("name")), nil},
-		{"(name, age) -> {}", node.Function(
-			node.Block(),
-			node.Ident("name"), node.Ident("age"),
-		), nil},
-		{"(name, age) -> {name}", node.Function(
-			node.Block(node.Ident("name")),
-			node.Ident("name"), node.Ident("age"),
-		), nil},
-		{"(name, age) -> {name;}", node.Function(
-			node.Block(node.Ident("name")),
-			node.Ident("name"), node.Ident("age"),
-		), nil},
-		{"(name, age) -> {name;age}", node.Function(
-			node.Block(node.Ident("name"), node.Ident("age")),
-			node.Ident("name"), node.Ident("age"),
-		), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"(name) -> {}", &ast.Function{Params: []ast.Node{&ast.Ident{Name: "name"}}, Body: &ast.Block{}}, nil},
+		{"(name, age) -> {}", &ast.Function{
+			Params: []ast.Node{
+				&ast.Ident{Name: "name"},
+				&ast.Ident{Name: "age"},
+			},
+			Body: &ast.Block{},
+		}, nil},
+		{"(name, age) -> {name}", &ast.Function{
+			Params: []ast.Node{
+				&ast.Ident{Name: "name"},
+				&ast.Ident{Name: "age"},
+			},
+			Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "name"}}},
+		}, nil},
+		{"(name, age) -> {name;}", &ast.Function{
+			Params: []ast.Node{
+				&ast.Ident{Name: "name"},
+				&ast.Ident{Name: "age"},
+			},
+			Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "name"}}},
+		}, nil},
+		{"(name, age) -> {name;age}", &ast.Function{
+			Params: []ast.Node{
+				&ast.Ident{Name: "name"},
+				&ast.Ident{Name: "age"},
+			},
+			Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "name"}, &ast.Ident{Name: "age"}}},
+		}, nil},
+
+		{"(...args) -> {}", &ast.Function{Rest: &ast.Ident{Name: "args"}, Body: &ast.Block{}}, nil},
+		{"(first, ...rest,) -> {}", &ast.Function{
+			Params: []ast.Node{
+				&ast.Ident{Name: "first"},
+			},
+			Rest: &ast.Ident{Name: "rest"},
+			Body: &ast.Block{},
+		}, nil},
+		{"(...[a, b]) -> {}", &ast.Function{
+			Rest: &ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "a"}, &ast.Ident{Name: "b"}}},
+			Body: &ast.Block{},
+		}, nil},
+
+		{"(w = 640, [a, b] = [], ...rest) -> {}", &ast.Function{
+			Params: []ast.Node{
+				&ast.Default{Target: &ast.Ident{Name: "w"}, Value: &ast.Int{Value: 640}},
+				&ast.Default{Target: &ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "a"}, &ast.Ident{Name: "b"}}}, Value: &ast.Array{}},
+			},
+			Rest: &ast.Ident{Name: "rest"},
+			Body: &ast.Block{},
+		}, nil},
 
 		{"()", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
 		{"(name, age)", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
 		{"(name, age) ->", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
 		{"(name, age) -> {name;", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
 		{"(name, age) -> []", nil, unexpectedToken(lexer.NewToken(lexer.LBrack))},
+		{"(...rest, last) -> {}", nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Ident, "last"))},
+		{"(...args)", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
 	}
 
 	for _, test := range tests {
@@ -130,35 +208,92 @@ func Test_paren(t *testing.T) {
 func Test_elByIndex(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
 
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
 		{"array[1][3]",
-			node.ElByIndex(
-				node.ElByIndex(node.Ident("array"), node.Int(1)),
-				node.Int(3),
-			), nil},
-
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"factorial(3)", node.Call(node.Ident("factorial"), node.Int(3)), nil},
+			&ast.Index{
+				X:     &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}},
+				Index: &ast.Int{Value: 3},
+			}, nil},
+
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"factorial(3)", &ast.Call{Fn: &ast.Ident{Name: "factorial"}, Args: []ast.Node{&ast.Int{Value: 3}}}, nil},
+		{"f(...args, 1)", &ast.Call{
+			Fn: &ast.Ident{Name: "f"},
+			Args: []ast.Node{
+				&ast.Spread{X: &ast.Ident{Name: "args"}},
+				&ast.Int{Value: 1},
+			},
+		}, nil},
+		{`draw(x, y, color: "red")`, &ast.Call{
+			Fn: &ast.Ident{Name: "draw"},
+			Args: []ast.Node{
+				&ast.Ident{Name: "x"},
+				&ast.Ident{Name: "y"},
+				&ast.Named{Name: "color", Value: &ast.Text{Value: "red"}},
+			},
+		}, nil},
 		{"factorial(3)(1)",
-			node.Call(
-				node.Call(node.Ident("factorial"), node.Int(3)),
-				node.Int(1),
-			), nil},
+			&ast.Call{
+				Fn: &ast.Call{Fn: &ast.Ident{Name: "factorial"}, Args: []ast.Node{&ast.Int{Value: 3}}},
+				Args: []ast.Node{
+					&ast.Int{Value: 1},
+				},
+			}, nil},
 		{"factorial(3)(1,8)",
-			node.Call(
-				node.Call(node.Ident("factorial"), node.Int(3)),
-				node.Int(1), node.Int(8),
-			), nil},
+			&ast.Call{
+				Fn: &ast.Call{Fn: &ast.Ident{Name: "factorial"}, Args: []ast.Node{&ast.Int{Value: 3}}},
+				Args: []ast.Node{
+					&ast.Int{Value: 1},
+					&ast.Int{Value: 8},
+				},
+			}, nil},
+
+		{"point.x", &ast.Member{X: &ast.Ident{Name: "point"}, Name: "x"}, nil},
+		{"a.b[0].c", &ast.Member{
+			X: &ast.Index{
+				X:     &ast.Member{X: &ast.Ident{Name: "a"}, Name: "b"},
+				Index: &ast.Int{Value: 0},
+			},
+			Name: "c",
+		}, nil},
+		{"canvas.draw(1, 2)", &ast.Call{
+			Fn: &ast.Member{X: &ast.Ident{Name: "canvas"}, Name: "draw"},
+			Args: []ast.Node{
+				&ast.Int{Value: 1},
+				&ast.Int{Value: 2},
+			},
+		}, nil},
+		{"f().x", &ast.Member{X: &ast.Call{Fn: &ast.Ident{Name: "f"}}, Name: "x"}, nil},
+
+		{"array[-1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 1}}}, nil},
+		{"array[1:3]", &ast.Index{
+			X:     &ast.Ident{Name: "array"},
+			Index: &ast.Slice{Start: &ast.Int{Value: 1}, End: &ast.Int{Value: 3}},
+		}, nil},
+		{"array[:]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Slice{}}, nil},
+		{"array[::2]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Slice{Step: &ast.Int{Value: 2}}}, nil},
+		{"array[1:][0]", &ast.Index{
+			X:     &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Slice{Start: &ast.Int{Value: 1}}},
+			Index: &ast.Int{Value: 0},
+		}, nil},
 
 		{"array[1", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
+		{"array[]", nil, unexpectedToken(lexer.NewToken(lexer.RBrack))},
+		{"array[1:2:3:4]", nil, unexpectedToken(lexer.NewToken(lexer.Colon))},
 		{"factorial(1", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
+		{"f(x:)", nil, unexpectedToken(lexer.NewToken(lexer.RParen))},
+		{`f("x": 1)`, nil, unexpectedToken(lexer.NewToken(lexer.Colon))},
+		{"f(b: 1, 5)", nil, positionalAfterNamed(lexer.NewToken(lexer.Int))},
+		{"f(b: 1, ...args)", nil, positionalAfterNamed(lexer.NewToken(lexer.Ellipsis))},
+		{"point.", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
+		{"point.if", nil, unexpectedToken(lexer.NewToken(lexer.If))},
 	}
 
 	for _, test := range tests {
@@ -181,17 +316,17 @@ func Test_elByIndex(t *testing.T) {
 func Test_neg(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-
-		{"-2187", node.Neg(node.Int(2187)), nil},
-		{"--2187", node.Neg(node.Neg(node.Int(2187))), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+		{"--2187", &ast.Unary{Op: ast.Neg, X: &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}}, nil},
 	}
 
 	for _, test := range tests {
@@ -214,26 +349,26 @@ func Test_neg(t *testing.T) {
 func Test_mul(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"-2187", node.Neg(node.Int(2187)), nil},
-
-		{"27*8", node.Mul(node.Int(27), node.Int(8)), nil},
-		{"27/8", node.Div(node.Int(27), node.Int(8)), nil},
-		{"27%8", node.Mod(node.Int(27), node.Int(8)), nil},
-
-		{"27*8*16", node.Mul(node.Mul(node.Int(27), node.Int(8)), node.Int(16)), nil},
-		{"27*8/16", node.Div(node.Mul(node.Int(27), node.Int(8)), node.Int(16)), nil},
-		{"27*8/16%4", node.Mod(node.Div(node.Mul(node.Int(27), node.Int(8)), node.Int(16)), node.Int(4)), nil},
-		{"27*8/16%-4", node.Mod(node.Div(node.Mul(node.Int(27), node.Int(8)), node.Int(16)), node.Neg(node.Int(4))), nil},
-
-		{"27*(8*16)", node.Mul(node.Int(27), node.Mul(node.Int(8), node.Int(16))), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+
+		{"27*8", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27/8", &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27%8", &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+
+		{"27*8*16", &ast.Binary{Op: ast.Mul, X: &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, Y: &ast.Int{Value: 16}}, nil},
+		{"27*8/16", &ast.Binary{Op: ast.Div, X: &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, Y: &ast.Int{Value: 16}}, nil},
+		{"27*8/16%4", &ast.Binary{Op: ast.Mod, X: &ast.Binary{Op: ast.Div, X: &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, Y: &ast.Int{Value: 16}}, Y: &ast.Int{Value: 4}}, nil},
+		{"27*8/16%-4", &ast.Binary{Op: ast.Mod, X: &ast.Binary{Op: ast.Div, X: &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, Y: &ast.Int{Value: 16}}, Y: &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 4}}}, nil},
+
+		{"27*(8*16)", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 8}, Y: &ast.Int{Value: 16}}}, nil},
 	}
 
 	for _, test := range tests {
@@ -256,26 +391,26 @@ func Test_mul(t *testing.T) {
 func Test_add(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"-2187", node.Neg(node.Int(2187)), nil},
-		{"27*8", node.Mul(node.Int(27), node.Int(8)), nil},
-		{"27/8", node.Div(node.Int(27), node.Int(8)), nil},
-		{"27%8", node.Mod(node.Int(27), node.Int(8)), nil},
-
-		{"27+8", node.Add(node.Int(27), node.Int(8)), nil},
-		{"27-8", node.Sub(node.Int(27), node.Int(8)), nil},
-
-		{"27+8+16", node.Add(node.Add(node.Int(27), node.Int(8)), node.Int(16)), nil},
-		{"27+8-16", node.Sub(node.Add(node.Int(27), node.Int(8)), node.Int(16)), nil},
-
-		{"27-8*16", node.Sub(node.Int(27), node.Mul(node.Int(8), node.Int(16))), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+		{"27*8", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27/8", &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27%8", &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+
+		{"27+8", &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27-8", &ast.Binary{Op: ast.Sub, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+
+		{"27+8+16", &ast.Binary{Op: ast.Add, X: &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, Y: &ast.Int{Value: 16}}, nil},
+		{"27+8-16", &ast.Binary{Op: ast.Sub, X: &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, Y: &ast.Int{Value: 16}}, nil},
+
+		{"27-8*16", &ast.Binary{Op: ast.Sub, X: &ast.Int{Value: 27}, Y: &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 8}, Y: &ast.Int{Value: 16}}}, nil},
 	}
 
 	for _, test := range tests {
@@ -298,23 +433,23 @@ func Test_add(t *testing.T) {
 func Test_concat(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"-2187", node.Neg(node.Int(2187)), nil},
-		{"27*8", node.Mul(node.Int(27), node.Int(8)), nil},
-		{"27/8", node.Div(node.Int(27), node.Int(8)), nil},
-		{"27%8", node.Mod(node.Int(27), node.Int(8)), nil},
-		{"27+8", node.Add(node.Int(27), node.Int(8)), nil},
-		{"27-8", node.Sub(node.Int(27), node.Int(8)), nil},
-
-		{`"привет "||"мир"`, node.Concat(node.Text("привет "), node.Text("мир")), nil},
-		{`27+8||"рублей"`, node.Concat(node.Add(node.Int(27), node.Int(8)), node.Text("рублей")), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+		{"27*8", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27/8", &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27%8", &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27+8", &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27-8", &ast.Binary{Op: ast.Sub, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+
+		{`"привет "||"мир"`, &ast.Binary{Op: ast.Concat, X: &ast.Text{Value: "привет "}, Y: &ast.Text{Value: "мир"}}, nil},
+		{`27+8||"рублей"`, &ast.Binary{Op: ast.Concat, X: &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, Y: &ast.Text{Value: "рублей"}}, nil},
 	}
 
 	for _, test := range tests {
@@ -337,28 +472,28 @@ func Test_concat(t *testing.T) {
 func Test_eq(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"-2187", node.Neg(node.Int(2187)), nil},
-		{"27*8", node.Mul(node.Int(27), node.Int(8)), nil},
-		{"27/8", node.Div(node.Int(27), node.Int(8)), nil},
-		{"27%8", node.Mod(node.Int(27), node.Int(8)), nil},
-		{"27+8", node.Add(node.Int(27), node.Int(8)), nil},
-		{"27-8", node.Sub(node.Int(27), node.Int(8)), nil},
-		{`"привет "||"мир"`, node.Concat(node.Text("привет "), node.Text("мир")), nil},
-
-		{"27==8", node.Eq(node.Int(27), node.Int(8)), nil},
-		{"27!=8", node.Neq(node.Int(27), node.Int(8)), nil},
-		{"27<8", node.Lt(node.Int(27), node.Int(8)), nil},
-		{"27<=8", node.Lte(node.Int(27), node.Int(8)), nil},
-		{"27>8", node.Gt(node.Int(27), node.Int(8)), nil},
-		{"27>=8", node.Gte(node.Int(27), node.Int(8)), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+		{"27*8", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27/8", &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27%8", &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27+8", &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27-8", &ast.Binary{Op: ast.Sub, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{`"привет "||"мир"`, &ast.Binary{Op: ast.Concat, X: &ast.Text{Value: "привет "}, Y: &ast.Text{Value: "мир"}}, nil},
+
+		{"27==8", &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27!=8", &ast.Binary{Op: ast.Neq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<8", &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<=8", &ast.Binary{Op: ast.Lte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>8", &ast.Binary{Op: ast.Gt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>=8", &ast.Binary{Op: ast.Gte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
 	}
 
 	for _, test := range tests {
@@ -381,30 +516,30 @@ func Test_eq(t *testing.T) {
 func Test_not(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"-2187", node.Neg(node.Int(2187)), nil},
-		{"27*8", node.Mul(node.Int(27), node.Int(8)), nil},
-		{"27/8", node.Div(node.Int(27), node.Int(8)), nil},
-		{"27%8", node.Mod(node.Int(27), node.Int(8)), nil},
-		{"27+8", node.Add(node.Int(27), node.Int(8)), nil},
-		{"27-8", node.Sub(node.Int(27), node.Int(8)), nil},
-		{`"привет "||"мир"`, node.Concat(node.Text("привет "), node.Text("мир")), nil},
-		{"27==8", node.Eq(node.Int(27), node.Int(8)), nil},
-		{"27!=8", node.Neq(node.Int(27), node.Int(8)), nil},
-		{"27<8", node.Lt(node.Int(27), node.Int(8)), nil},
-		{"27<=8", node.Lte(node.Int(27), node.Int(8)), nil},
-		{"27>8", node.Gt(node.Int(27), node.Int(8)), nil},
-		{"27>=8", node.Gte(node.Int(27), node.Int(8)), nil},
-
-		{"not true", node.Not(node.Bool(true)), nil},
-		{"not not true", node.Not(node.Not(node.Bool(true))), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+		{"27*8", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27/8", &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27%8", &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27+8", &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27-8", &ast.Binary{Op: ast.Sub, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{`"привет "||"мир"`, &ast.Binary{Op: ast.Concat, X: &ast.Text{Value: "привет "}, Y: &ast.Text{Value: "мир"}}, nil},
+		{"27==8", &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27!=8", &ast.Binary{Op: ast.Neq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<8", &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<=8", &ast.Binary{Op: ast.Lte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>8", &ast.Binary{Op: ast.Gt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>=8", &ast.Binary{Op: ast.Gte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+
+		{"not true", &ast.Unary{Op: ast.Not, X: &ast.Bool{Value: true}}, nil},
+		{"not not true", &ast.Unary{Op: ast.Not, X: &ast.Unary{Op: ast.Not, X: &ast.Bool{Value: true}}}, nil},
 	}
 
 	for _, test := range tests {
@@ -427,34 +562,35 @@ func Test_not(t *testing.T) {
 func Test_and(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"-2187", node.Neg(node.Int(2187)), nil},
-		{"27*8", node.Mul(node.Int(27), node.Int(8)), nil},
-		{"27/8", node.Div(node.Int(27), node.Int(8)), nil},
-		{"27%8", node.Mod(node.Int(27), node.Int(8)), nil},
-		{"27+8", node.Add(node.Int(27), node.Int(8)), nil},
-		{"27-8", node.Sub(node.Int(27), node.Int(8)), nil},
-		{`"привет "||"мир"`, node.Concat(node.Text("привет "), node.Text("мир")), nil},
-		{"27==8", node.Eq(node.Int(27), node.Int(8)), nil},
-		{"27!=8", node.Neq(node.Int(27), node.Int(8)), nil},
-		{"27<8", node.Lt(node.Int(27), node.Int(8)), nil},
-		{"27<=8", node.Lte(node.Int(27), node.Int(8)), nil},
-		{"27>8", node.Gt(node.Int(27), node.Int(8)), nil},
-		{"27>=8", node.Gte(node.Int(27), node.Int(8)), nil},
-		{"not true", node.Not(node.Bool(true)), nil},
-
-		{"false and true", node.And(node.Bool(false), node.Bool(true)), nil},
-		{"false and true and false", node.And(
-			node.And(node.Bool(false), node.Bool(true)),
-			node.Bool(false),
-		), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+		{"27*8", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27/8", &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27%8", &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27+8", &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27-8", &ast.Binary{Op: ast.Sub, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{`"привет "||"мир"`, &ast.Binary{Op: ast.Concat, X: &ast.Text{Value: "привет "}, Y: &ast.Text{Value: "мир"}}, nil},
+		{"27==8", &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27!=8", &ast.Binary{Op: ast.Neq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<8", &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<=8", &ast.Binary{Op: ast.Lte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>8", &ast.Binary{Op: ast.Gt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>=8", &ast.Binary{Op: ast.Gte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"not true", &ast.Unary{Op: ast.Not, X: &ast.Bool{Value: true}}, nil},
+
+		{"false and true", &ast.Binary{Op: ast.And, X: &ast.Bool{Value: false}, Y: &ast.Bool{Value: true}}, nil},
+		{"false and true and false", &ast.Binary{
+			Op: ast.And,
+			X:  &ast.Binary{Op: ast.And, X: &ast.Bool{Value: false}, Y: &ast.Bool{Value: true}},
+			Y:  &ast.Bool{Value: false},
+		}, nil},
 	}
 
 	for _, test := range tests {
@@ -477,35 +613,47 @@ func Test_and(t *testing.T) {
 func Test_or(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"-2187", node.Neg(node.Int(2187)), nil},
-		{"27*8", node.Mul(node.Int(27), node.Int(8)), nil},
-		{"27/8", node.Div(node.Int(27), node.Int(8)), nil},
-		{"27%8", node.Mod(node.Int(27), node.Int(8)), nil},
-		{"27+8", node.Add(node.Int(27), node.Int(8)), nil},
-		{"27-8", node.Sub(node.Int(27), node.Int(8)), nil},
-		{`"привет "||"мир"`, node.Concat(node.Text("привет "), node.Text("мир")), nil},
-		{"27==8", node.Eq(node.Int(27), node.Int(8)), nil},
-		{"27!=8", node.Neq(node.Int(27), node.Int(8)), nil},
-		{"27<8", node.Lt(node.Int(27), node.Int(8)), nil},
-		{"27<=8", node.Lte(node.Int(27), node.Int(8)), nil},
-		{"27>8", node.Gt(node.Int(27), node.Int(8)), nil},
-		{"27>=8", node.Gte(node.Int(27), node.Int(8)), nil},
-		{"not true", node.Not(node.Bool(true)), nil},
-		{"false and true", node.And(node.Bool(false), node.Bool(true)), nil},
-
-		{"false or true", node.Or(node.Bool(false), node.Bool(true)), nil},
-		{"false or true or false", node.Or(
-			node.Or(node.Bool(false), node.Bool(true)),
-			node.Bool(false),
-		), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+		{"27*8", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27/8", &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27%8", &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27+8", &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27-8", &ast.Binary{Op: ast.Sub, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{`"привет "||"мир"`, &ast.Binary{Op: ast.Concat, X: &ast.Text{Value: "привет "}, Y: &ast.Text{Value: "мир"}}, nil},
+		{"27==8", &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27!=8", &ast.Binary{Op: ast.Neq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<8", &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<=8", &ast.Binary{Op: ast.Lte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>8", &ast.Binary{Op: ast.Gt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>=8", &ast.Binary{Op: ast.Gte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"not true", &ast.Unary{Op: ast.Not, X: &ast.Bool{Value: true}}, nil},
+		{"false and true", &ast.Binary{Op: ast.And, X: &ast.Bool{Value: false}, Y: &ast.Bool{Value: true}}, nil},
+
+		{"false or true", &ast.Binary{Op: ast.Or, X: &ast.Bool{Value: false}, Y: &ast.Bool{Value: true}}, nil},
+		{`name ?: "гость"`, &ast.Binary{Op: ast.OrValue, X: &ast.Ident{Name: "name"}, Y: &ast.Text{Value: "гость"}}, nil},
+		{"a ?: b && c or d", &ast.Binary{
+			Op: ast.Or,
+			X:  &ast.Binary{Op: ast.OrValue, X: &ast.Ident{Name: "a"}, Y: &ast.Binary{Op: ast.AndValue, X: &ast.Ident{Name: "b"}, Y: &ast.Ident{Name: "c"}}},
+			Y:  &ast.Ident{Name: "d"},
+		}, nil},
+		{"x != null and x[0] > 1", &ast.Binary{
+			Op: ast.And,
+			X:  &ast.Binary{Op: ast.Neq, X: &ast.Ident{Name: "x"}, Y: &ast.Null{}},
+			Y:  &ast.Binary{Op: ast.Gt, X: &ast.Index{X: &ast.Ident{Name: "x"}, Index: &ast.Int{Value: 0}}, Y: &ast.Int{Value: 1}},
+		}, nil},
+		{"false or true or false", &ast.Binary{
+			Op: ast.Or,
+			X:  &ast.Binary{Op: ast.Or, X: &ast.Bool{Value: false}, Y: &ast.Bool{Value: true}},
+			Y:  &ast.Bool{Value: false},
+		}, nil},
 	}
 
 	for _, test := range tests {
@@ -528,37 +676,102 @@ func Test_or(t *testing.T) {
 func Test_set(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"2187", node.Int(2187), nil},
-		{"(2187)", node.Int(2187), nil},
-		{"() -> {}", node.Function(node.Block()), nil},
-		{"array[1]", node.ElByIndex(node.Ident("array"), node.Int(1)), nil},
-		{"factorial()", node.Call(node.Ident("factorial")), nil},
-		{"-2187", node.Neg(node.Int(2187)), nil},
-		{"27*8", node.Mul(node.Int(27), node.Int(8)), nil},
-		{"27/8", node.Div(node.Int(27), node.Int(8)), nil},
-		{"27%8", node.Mod(node.Int(27), node.Int(8)), nil},
-		{"27+8", node.Add(node.Int(27), node.Int(8)), nil},
-		{"27-8", node.Sub(node.Int(27), node.Int(8)), nil},
-		{`"привет "||"мир"`, node.Concat(node.Text("привет "), node.Text("мир")), nil},
-		{"27==8", node.Eq(node.Int(27), node.Int(8)), nil},
-		{"27!=8", node.Neq(node.Int(27), node.Int(8)), nil},
-		{"27<8", node.Lt(node.Int(27), node.Int(8)), nil},
-		{"27<=8", node.Lte(node.Int(27), node.Int(8)), nil},
-		{"27>8", node.Gt(node.Int(27), node.Int(8)), nil},
-		{"27>=8", node.Gte(node.Int(27), node.Int(8)), nil},
-		{"not true", node.Not(node.Bool(true)), nil},
-		{"false and true", node.And(node.Bool(false), node.Bool(true)), nil},
-		{"false or true", node.Or(node.Bool(false), node.Bool(true)), nil},
-
-		{"age:=27", node.Create(node.Ident("age"), node.Int(27)), nil},
-		{"age=27", node.Set(node.Ident("age"), node.Int(27)), nil},
-		{"age = number = 27", node.Set(
-			node.Ident("age"),
-			node.Set(node.Ident("number"), node.Int(27)),
-		), nil},
+		{"2187", &ast.Int{Value: 2187}, nil},
+		{"(2187)", &ast.Int{Value: 2187}, nil},
+		{"() -> {}", &ast.Function{Body: &ast.Block{}}, nil},
+		{"array[1]", &ast.Index{X: &ast.Ident{Name: "array"}, Index: &ast.Int{Value: 1}}, nil},
+		{"factorial()", &ast.Call{Fn: &ast.Ident{Name: "factorial"}}, nil},
+		{"-2187", &ast.Unary{Op: ast.Neg, X: &ast.Int{Value: 2187}}, nil},
+		{"27*8", &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27/8", &ast.Binary{Op: ast.Div, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27%8", &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27+8", &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27-8", &ast.Binary{Op: ast.Sub, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{`"привет "||"мир"`, &ast.Binary{Op: ast.Concat, X: &ast.Text{Value: "привет "}, Y: &ast.Text{Value: "мир"}}, nil},
+		{"27==8", &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27!=8", &ast.Binary{Op: ast.Neq, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<8", &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27<=8", &ast.Binary{Op: ast.Lte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>8", &ast.Binary{Op: ast.Gt, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"27>=8", &ast.Binary{Op: ast.Gte, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 8}}, nil},
+		{"not true", &ast.Unary{Op: ast.Not, X: &ast.Bool{Value: true}}, nil},
+		{"false and true", &ast.Binary{Op: ast.And, X: &ast.Bool{Value: false}, Y: &ast.Bool{Value: true}}, nil},
+		{"false or true", &ast.Binary{Op: ast.Or, X: &ast.Bool{Value: false}, Y: &ast.Bool{Value: true}}, nil},
+
+		{"age:=27", &ast.Create{Target: &ast.Ident{Name: "age"}, Value: &ast.Int{Value: 27}}, nil},
+		{"age=27", &ast.Set{Target: &ast.Ident{Name: "age"}, Value: &ast.Int{Value: 27}}, nil},
+		{"point.x = 27", &ast.Set{Target: &ast.Member{X: &ast.Ident{Name: "point"}, Name: "x"}, Value: &ast.Int{Value: 27}}, nil},
+		{"age = number = 27", &ast.Set{
+			Target: &ast.Ident{Name: "age"},
+			Value:  &ast.Set{Target: &ast.Ident{Name: "number"}, Value: &ast.Int{Value: 27}},
+		}, nil},
+
+		{"sum += 1", &ast.Compound{Op: ast.Add, Target: &ast.Ident{Name: "sum"}, Value: &ast.Int{Value: 1}}, nil},
+		{"arr[i][j] -= 2*3", &ast.Compound{
+			Op:     ast.Sub,
+			Target: &ast.Index{X: &ast.Index{X: &ast.Ident{Name: "arr"}, Index: &ast.Ident{Name: "i"}}, Index: &ast.Ident{Name: "j"}},
+			Value:  &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 2}, Y: &ast.Int{Value: 3}},
+		}, nil},
+		{"a *= b /= 2", &ast.Compound{
+			Op:     ast.Mul,
+			Target: &ast.Ident{Name: "a"},
+			Value:  &ast.Compound{Op: ast.Div, Target: &ast.Ident{Name: "b"}, Value: &ast.Int{Value: 2}},
+		}, nil},
+		{"a %= 2", &ast.Compound{Op: ast.Mod, Target: &ast.Ident{Name: "a"}, Value: &ast.Int{Value: 2}}, nil},
+		{`s ||= "!"`, &ast.Compound{Op: ast.Concat, Target: &ast.Ident{Name: "s"}, Value: &ast.Text{Value: "!"}}, nil},
+		{"[a, b] := pair", &ast.Create{
+			Target: &ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "a"}, &ast.Ident{Name: "b"}}},
+			Value:  &ast.Ident{Name: "pair"},
+		}, nil},
+		{"[a, [b, c = 0],] = [b, a]", &ast.Set{
+			Target: &ast.ArrayPattern{Elems: []ast.Node{
+				&ast.Ident{Name: "a"},
+				&ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "b"}, &ast.Default{Target: &ast.Ident{Name: "c"}, Value: &ast.Int{Value: 0}}}},
+			}},
+			Value: &ast.Array{Elems: []ast.Node{&ast.Ident{Name: "b"}, &ast.Ident{Name: "a"}}},
+		}, nil},
+		{"[head, ...tail] := arr", &ast.Create{
+			Target: &ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "head"}}, Rest: &ast.Ident{Name: "tail"}},
+			Value:  &ast.Ident{Name: "arr"},
+		}, nil},
+		{"[point.x, arr[0]] = pair", &ast.Set{
+			Target: &ast.ArrayPattern{Elems: []ast.Node{
+				&ast.Member{X: &ast.Ident{Name: "point"}, Name: "x"},
+				&ast.Index{X: &ast.Ident{Name: "arr"}, Index: &ast.Int{Value: 0}},
+			}},
+			Value: &ast.Ident{Name: "pair"},
+		}, nil},
+		{`{x, y: [a], "сумма": s, z = 1, ...rest} := point`, &ast.Create{
+			Target: &ast.ObjectPattern{
+				Props: []ast.Prop{
+					{Key: "x", Target: &ast.Ident{Name: "x"}},
+					{Key: "y", Target: &ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "a"}}}},
+					{Key: "сумма", Target: &ast.Ident{Name: "s"}},
+					{Key: "z", Target: &ast.Default{Target: &ast.Ident{Name: "z"}, Value: &ast.Int{Value: 1}}},
+				},
+				Rest: &ast.Ident{Name: "rest"},
+			},
+			Value: &ast.Ident{Name: "point"},
+		}, nil},
+		{"[] := arr", &ast.Create{Target: &ast.ArrayPattern{}, Value: &ast.Ident{Name: "arr"}}, nil},
+		{"[...a, b] = pair", nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Ident, "b"))},
+		{"{...a} = b", &ast.Set{Target: &ast.ObjectPattern{Rest: &ast.Ident{Name: "a"}}, Value: &ast.Ident{Name: "b"}}, nil},
+		{"[a, b][0] = 1", &ast.Set{
+			Target: &ast.Index{X: &ast.Array{Elems: []ast.Node{&ast.Ident{Name: "a"}, &ast.Ident{Name: "b"}}}, Index: &ast.Int{Value: 0}},
+			Value:  &ast.Int{Value: 1},
+		}, nil},
+		{`{"a": 1}`, &ast.Object{Pairs: []ast.Pair{{Key: &ast.Text{Value: "a"}, Value: &ast.Int{Value: 1}}}}, nil},
+		{"([a, b], {c}) -> {}", &ast.Function{
+			Params: []ast.Node{
+				&ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "a"}, &ast.Ident{Name: "b"}}},
+				&ast.ObjectPattern{Props: []ast.Prop{{Key: "c", Target: &ast.Ident{Name: "c"}}}},
+			},
+			Body: &ast.Block{},
+		}, nil},
+		{"[...tail, head] := arr", nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Ident, "head"))},
 	}
 
 	for _, test := range tests {
@@ -581,61 +794,81 @@ func Test_set(t *testing.T) {
 func Test_expression(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
 		{"res:=(4+9)*27/16",
-			node.Create(
-				node.Ident("res"),
-				node.Div(
-					node.Mul(
-						node.Add(node.Int(4), node.Int(9)),
-						node.Int(27)),
-					node.Int(16)),
-			), nil},
+			&ast.Create{
+				Target: &ast.Ident{Name: "res"},
+				Value: &ast.Binary{
+					Op: ast.Div,
+					X: &ast.Binary{
+						Op: ast.Mul,
+						X:  &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 4}, Y: &ast.Int{Value: 9}},
+						Y:  &ast.Int{Value: 27},
+					},
+					Y: &ast.Int{Value: 16},
+				},
+			}, nil},
 
 		{"res=(4+9)*27/16 <= 19683%2187",
-			node.Set(
-				node.Ident("res"),
-				node.Lte(
-					node.Div(
-						node.Mul(
-							node.Add(node.Int(4), node.Int(9)),
-							node.Int(27)),
-						node.Int(16)),
-					node.Mod(node.Int(19683), node.Int(2187)),
-				),
-			), nil},
+			&ast.Set{
+				Target: &ast.Ident{Name: "res"},
+				Value: &ast.Binary{
+					Op: ast.Lte,
+					X: &ast.Binary{
+						Op: ast.Div,
+						X: &ast.Binary{
+							Op: ast.Mul,
+							X:  &ast.Binary{Op: ast.Add, X: &ast.Int{Value: 4}, Y: &ast.Int{Value: 9}},
+							Y:  &ast.Int{Value: 27},
+						},
+						Y: &ast.Int{Value: 16},
+					},
+					Y: &ast.Binary{Op: ast.Mod, X: &ast.Int{Value: 19683}, Y: &ast.Int{Value: 2187}},
+				},
+			}, nil},
 
 		{"-(res[4+9*27]) > -(27*9)",
-			node.Gt(
-				node.Neg(
-					node.ElByIndex(
-						node.Ident("res"),
-						node.Add(
-							node.Int(4),
-							node.Mul(node.Int(9), node.Int(27)),
-						)),
-				),
-				node.Neg(node.Mul(node.Int(27), node.Int(9))),
-			), nil},
+			&ast.Binary{
+				Op: ast.Gt,
+				X: &ast.Unary{
+					Op: ast.Neg,
+					X: &ast.Index{
+						X: &ast.Ident{Name: "res"},
+						Index: &ast.Binary{
+							Op: ast.Add,
+							X:  &ast.Int{Value: 4},
+							Y:  &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 9}, Y: &ast.Int{Value: 27}},
+						},
+					},
+				},
+				Y: &ast.Unary{Op: ast.Neg, X: &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 9}}},
+			}, nil},
 
 		{"(res) -> {-(res[4+9*27]) > -(27*9)}",
-			node.Function(
-				node.Block(
-					node.Gt(
-						node.Neg(
-							node.ElByIndex(
-								node.Ident("res"),
-								node.Add(
-									node.Int(4),
-									node.Mul(node.Int(9), node.Int(27)),
-								)),
-						),
-						node.Neg(node.Mul(node.Int(27), node.Int(9))),
-					),
-				), node.Ident("res"),
-			), nil},
+			&ast.Function{
+				Params: []ast.Node{
+					&ast.Ident{Name: "res"},
+				},
+				Body: &ast.Block{List: []ast.Node{
+					&ast.Binary{
+						Op: ast.Gt,
+						X: &ast.Unary{
+							Op: ast.Neg,
+							X: &ast.Index{
+								X: &ast.Ident{Name: "res"},
+								Index: &ast.Binary{
+									Op: ast.Add,
+									X:  &ast.Int{Value: 4},
+									Y:  &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 9}, Y: &ast.Int{Value: 27}},
+								},
+							},
+						},
+						Y: &ast.Unary{Op: ast.Neg, X: &ast.Binary{Op: ast.Mul, X: &ast.Int{Value: 27}, Y: &ast.Int{Value: 9}}},
+					},
+				}},
+			}, nil},
 	}
 
 	for _, test := range tests {
@@ -658,75 +891,73 @@ func Test_expression(t *testing.T) {
 func Test_branch(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"if 21<87 {81}", node.If(
-			node.Branch{
-				Cond: node.Lt(node.Int(21), node.Int(87)),
-				Body: node.Block(node.Int(81)),
-			},
-		), nil},
-
-		{"if 21<87 {81} elif 16==27 {125;625}", node.If(
-			node.Branch{
-				Cond: node.Lt(node.Int(21), node.Int(87)),
-				Body: node.Block(node.Int(81)),
-			},
-			node.Branch{
-				Cond: node.Eq(node.Int(16), node.Int(27)),
-				Body: node.Block(node.Int(125), node.Int(625)),
+		{"if 21<87 {81}", &ast.If{Branches: []ast.Branch{
+			{
+				Cond: &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 21}, Y: &ast.Int{Value: 87}},
+				Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 81}}},
 			},
-		), nil},
+		}}, nil},
 
-		{"if 21<87 {81} elif 16==27 {125;625} elif 9>3 {1}", node.If(
-			node.Branch{
-				Cond: node.Lt(node.Int(21), node.Int(87)),
-				Body: node.Block(node.Int(81)),
-			},
-			node.Branch{
-				Cond: node.Eq(node.Int(16), node.Int(27)),
-				Body: node.Block(node.Int(125), node.Int(625)),
+		{"if 21<87 {81} elif 16==27 {125;625}", &ast.If{Branches: []ast.Branch{
+			{
+				Cond: &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 21}, Y: &ast.Int{Value: 87}},
+				Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 81}}},
 			},
-			node.Branch{
-				Cond: node.Gt(node.Int(9), node.Int(3)),
-				Body: node.Block(node.Int(1)),
+			{
+				Cond: &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 16}, Y: &ast.Int{Value: 27}},
+				Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 125}, &ast.Int{Value: 625}}},
 			},
-		), nil},
+		}}, nil},
 
-		{"if 21<87 {81} elif 16==27 {125;625} else {1}", node.If(
-			node.Branch{
-				Cond: node.Lt(node.Int(21), node.Int(87)),
-				Body: node.Block(node.Int(81)),
+		{"if 21<87 {81} elif 16==27 {125;625} elif 9>3 {1}", &ast.If{Branches: []ast.Branch{
+			{
+				Cond: &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 21}, Y: &ast.Int{Value: 87}},
+				Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 81}}},
 			},
-			node.Branch{
-				Cond: node.Eq(node.Int(16), node.Int(27)),
-				Body: node.Block(node.Int(125), node.Int(625)),
+			{
+				Cond: &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 16}, Y: &ast.Int{Value: 27}},
+				Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 125}, &ast.Int{Value: 625}}},
 			},
-			node.Branch{
-				Cond: node.Bool(true),
-				Body: node.Block(node.Int(1)),
+			{
+				Cond: &ast.Binary{Op: ast.Gt, X: &ast.Int{Value: 9}, Y: &ast.Int{Value: 3}},
+				Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 1}}},
 			},
-		), nil},
+		}}, nil},
 
-		{"if 21<87 {81} elif 16==27 {125;625} elif 9>3 {1} else {64}", node.If(
-			node.Branch{
-				Cond: node.Lt(node.Int(21), node.Int(87)),
-				Body: node.Block(node.Int(81)),
-			},
-			node.Branch{
-				Cond: node.Eq(node.Int(16), node.Int(27)),
-				Body: node.Block(node.Int(125), node.Int(625)),
-			},
-			node.Branch{
-				Cond: node.Gt(node.Int(9), node.Int(3)),
-				Body: node.Block(node.Int(1)),
+		{"if 21<87 {81} elif 16==27 {125;625} else {1}", &ast.If{
+			Branches: []ast.Branch{
+				{
+					Cond: &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 21}, Y: &ast.Int{Value: 87}},
+					Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 81}}},
+				},
+				{
+					Cond: &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 16}, Y: &ast.Int{Value: 27}},
+					Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 125}, &ast.Int{Value: 625}}},
+				},
 			},
-			node.Branch{
-				Cond: node.Bool(true),
-				Body: node.Block(node.Int(64)),
+			Else: &ast.Block{List: []ast.Node{&ast.Int{Value: 1}}},
+		}, nil},
+
+		{"if 21<87 {81} elif 16==27 {125;625} elif 9>3 {1} else {64}", &ast.If{
+			Branches: []ast.Branch{
+				{
+					Cond: &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 21}, Y: &ast.Int{Value: 87}},
+					Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 81}}},
+				},
+				{
+					Cond: &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 16}, Y: &ast.Int{Value: 27}},
+					Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 125}, &ast.Int{Value: 625}}},
+				},
+				{
+					Cond: &ast.Binary{Op: ast.Gt, X: &ast.Int{Value: 9}, Y: &ast.Int{Value: 3}},
+					Body: &ast.Block{List: []ast.Node{&ast.Int{Value: 1}}},
+				},
 			},
-		), nil},
+			Else: &ast.Block{List: []ast.Node{&ast.Int{Value: 64}}},
+		}, nil},
 	}
 
 	for _, test := range tests {
@@ -749,24 +980,54 @@ func Test_branch(t *testing.T) {
 func Test_loop(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"for i in 81 {i}", node.For(
-			[]node.Node{node.Ident("i")},
-			node.Int(81),
-			node.Block(node.Ident("i")),
-		), nil},
-		{"for i, in 81 {i}", node.For(
-			[]node.Node{node.Ident("i")},
-			node.Int(81),
-			node.Block(node.Ident("i")),
-		), nil},
-		{"for i,j in [81] {i;j}", node.For(
-			[]node.Node{node.Ident("i"), node.Ident("j")},
-			node.Array(node.Int(81)),
-			node.Block(node.Ident("i"), node.Ident("j")),
-		), nil},
+		{"for i in 81 {i}", &ast.For{
+			Targets: []ast.Node{&ast.Ident{Name: "i"}},
+			From:    &ast.Int{Value: 81},
+			Body:    &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}}},
+		}, nil},
+		{"for i, in 81 {i}", &ast.For{
+			Targets: []ast.Node{&ast.Ident{Name: "i"}},
+			From:    &ast.Int{Value: 81},
+			Body:    &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}}},
+		}, nil},
+		{"for i,j in [81] {i;j}", &ast.For{
+			Targets: []ast.Node{&ast.Ident{Name: "i"}, &ast.Ident{Name: "j"}},
+			From:    &ast.Array{Elems: []ast.Node{&ast.Int{Value: 81}}},
+			Body:    &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}, &ast.Ident{Name: "j"}}},
+		}, nil},
+		{"for i, [a, b] in pairs {a}", &ast.For{
+			Targets: []ast.Node{&ast.Ident{Name: "i"}, &ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "a"}, &ast.Ident{Name: "b"}}}},
+			From:    &ast.Ident{Name: "pairs"},
+			Body:    &ast.Block{List: []ast.Node{&ast.Ident{Name: "a"}}},
+		}, nil},
+		{"while i < 81 {i}", &ast.While{
+			Cond: &ast.Binary{Op: ast.Lt, X: &ast.Ident{Name: "i"}, Y: &ast.Int{Value: 81}},
+			Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}}},
+		}, nil},
+		{"for i in 81 {break; continue}", &ast.For{
+			Targets: []ast.Node{&ast.Ident{Name: "i"}},
+			From:    &ast.Int{Value: 81},
+			Body:    &ast.Block{List: []ast.Node{&ast.Break{}, &ast.Continue{}}},
+		}, nil},
+		{"outer: for i in 81 {while true {continue outer; break}}", &ast.For{Label: "outer",
+			Targets: []ast.Node{&ast.Ident{Name: "i"}},
+			From:    &ast.Int{Value: 81},
+			Body: &ast.Block{List: []ast.Node{
+				&ast.While{
+					Cond: &ast.Bool{Value: true},
+					Body: &ast.Block{List: []ast.Node{&ast.Continue{Label: "outer"}, &ast.Break{}}},
+				},
+			}},
+		}, nil},
+		{"outer: x := 1", nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Ident, "x"))},
+		{"outer: for i in 81 {outer: while true {}}", nil,
+			labelAlreadyUsed(lexer.NewTokenWithValue(lexer.Ident, "outer"), "outer")},
+		{"for i in 81 {break inner}", nil,
+			labelNotFound(lexer.NewTokenWithValue(lexer.Ident, "inner"), "inner")},
+		{"for i in 81 {f := () -> {break}}", nil, outsideLoop(lexer.NewToken(lexer.Break))},
 	}
 
 	for _, test := range tests {
@@ -789,10 +1050,10 @@ func Test_loop(t *testing.T) {
 func Test_ret(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
-		{"return 81", node.Return(node.Int(81)), nil},
+		{"return 81", &ast.Return{Value: &ast.Int{Value: 81}}, nil},
 	}
 
 	for _, test := range tests {
@@ -812,42 +1073,63 @@ func Test_ret(t *testing.T) {
 	}
 }
 
+func Test_jump(t *testing.T) {
+	tests := []struct {
+		data          string
+		expectedError error
+	}{
+		{"break", outsideLoop(lexer.NewToken(lexer.Break))},
+		{"continue", outsideLoop(lexer.NewToken(lexer.Continue))},
+		{"continue outer", outsideLoop(lexer.NewToken(lexer.Continue))},
+	}
+
+	for _, test := range tests {
+		tokens, err := lexer.Tokenize(test.data)
+		assert.NoError(t, err)
+
+		p := newParser(tokens)
+
+		_, err = p.jump()
+		assert.EqualError(t, err, test.expectedError.Error())
+	}
+}
+
 func Test_construction(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
 		{
 			`if 21<87 {for i in 81 {i}};`,
-			node.If(
-				node.Branch{
-					Cond: node.Lt(node.Int(21), node.Int(87)),
-					Body: node.Block(
-						node.For([]node.Node{node.Ident("i")}, node.Int(81), node.Block(node.Ident("i"))),
-					),
+			&ast.If{Branches: []ast.Branch{
+				{
+					Cond: &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 21}, Y: &ast.Int{Value: 87}},
+					Body: &ast.Block{List: []ast.Node{
+						&ast.For{Targets: []ast.Node{&ast.Ident{Name: "i"}}, From: &ast.Int{Value: 81}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}}}},
+					}},
 				},
-			), nil},
+			}}, nil},
 
 		{
 			`
 if 21<87 {for i in 81 {i}}
 elif 16==27 {for j in 21 {j}};
 `,
-			node.If(
-				node.Branch{
-					Cond: node.Lt(node.Int(21), node.Int(87)),
-					Body: node.Block(
-						node.For([]node.Node{node.Ident("i")}, node.Int(81), node.Block(node.Ident("i"))),
-					),
+			&ast.If{Branches: []ast.Branch{
+				{
+					Cond: &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 21}, Y: &ast.Int{Value: 87}},
+					Body: &ast.Block{List: []ast.Node{
+						&ast.For{Targets: []ast.Node{&ast.Ident{Name: "i"}}, From: &ast.Int{Value: 81}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}}}},
+					}},
 				},
-				node.Branch{
-					Cond: node.Eq(node.Int(16), node.Int(27)),
-					Body: node.Block(
-						node.For([]node.Node{node.Ident("j")}, node.Int(21), node.Block(node.Ident("j"))),
-					),
+				{
+					Cond: &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 16}, Y: &ast.Int{Value: 27}},
+					Body: &ast.Block{List: []ast.Node{
+						&ast.For{Targets: []ast.Node{&ast.Ident{Name: "j"}}, From: &ast.Int{Value: 21}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "j"}}}},
+					}},
 				},
-			), nil},
+			}}, nil},
 
 		{
 			`
@@ -855,26 +1137,25 @@ if 21<87 {for i in 81 {i}}
 elif 16==27 {for j in 21 {j}}
 else {for k in 1 {k}};
 `,
-			node.If(
-				node.Branch{
-					Cond: node.Lt(node.Int(21), node.Int(87)),
-					Body: node.Block(
-						node.For([]node.Node{node.Ident("i")}, node.Int(81), node.Block(node.Ident("i"))),
-					),
-				},
-				node.Branch{
-					Cond: node.Eq(node.Int(16), node.Int(27)),
-					Body: node.Block(
-						node.For([]node.Node{node.Ident("j")}, node.Int(21), node.Block(node.Ident("j"))),
-					),
-				},
-				node.Branch{
-					Cond: node.Bool(true),
-					Body: node.Block(
-						node.For([]node.Node{node.Ident("k")}, node.Int(1), node.Block(node.Ident("k"))),
-					),
+			&ast.If{
+				Branches: []ast.Branch{
+					{
+						Cond: &ast.Binary{Op: ast.Lt, X: &ast.Int{Value: 21}, Y: &ast.Int{Value: 87}},
+						Body: &ast.Block{List: []ast.Node{
+							&ast.For{Targets: []ast.Node{&ast.Ident{Name: "i"}}, From: &ast.Int{Value: 81}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}}}},
+						}},
+					},
+					{
+						Cond: &ast.Binary{Op: ast.Eq, X: &ast.Int{Value: 16}, Y: &ast.Int{Value: 27}},
+						Body: &ast.Block{List: []ast.Node{
+							&ast.For{Targets: []ast.Node{&ast.Ident{Name: "j"}}, From: &ast.Int{Value: 21}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "j"}}}},
+						}},
+					},
 				},
-			), nil},
+				Else: &ast.Block{List: []ast.Node{
+					&ast.For{Targets: []ast.Node{&ast.Ident{Name: "k"}}, From: &ast.Int{Value: 1}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "k"}}}},
+				}},
+			}, nil},
 
 		{`
 for n in 81 {
@@ -883,32 +1164,31 @@ for n in 81 {
 	else {for k in 1 {k}};
 };
 `,
-			node.For(
-				[]node.Node{node.Ident("n")},
-				node.Int(81),
-				node.Block(
-					node.If(
-						node.Branch{
-							Cond: node.Lt(node.Ident("n"), node.Int(87)),
-							Body: node.Block(
-								node.For([]node.Node{node.Ident("i")}, node.Int(81), node.Block(node.Ident("i"))),
-							),
+			&ast.For{
+				Targets: []ast.Node{&ast.Ident{Name: "n"}},
+				From:    &ast.Int{Value: 81},
+				Body: &ast.Block{List: []ast.Node{
+					&ast.If{
+						Branches: []ast.Branch{
+							{
+								Cond: &ast.Binary{Op: ast.Lt, X: &ast.Ident{Name: "n"}, Y: &ast.Int{Value: 87}},
+								Body: &ast.Block{List: []ast.Node{
+									&ast.For{Targets: []ast.Node{&ast.Ident{Name: "i"}}, From: &ast.Int{Value: 81}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}}}},
+								}},
+							},
+							{
+								Cond: &ast.Binary{Op: ast.Eq, X: &ast.Ident{Name: "n"}, Y: &ast.Int{Value: 27}},
+								Body: &ast.Block{List: []ast.Node{
+									&ast.For{Targets: []ast.Node{&ast.Ident{Name: "j"}}, From: &ast.Int{Value: 21}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "j"}}}},
+								}},
+							},
 						},
-						node.Branch{
-							Cond: node.Eq(node.Ident("n"), node.Int(27)),
-							Body: node.Block(
-								node.For([]node.Node{node.Ident("j")}, node.Int(21), node.Block(node.Ident("j"))),
-							),
-						},
-						node.Branch{
-							Cond: node.Bool(true),
-							Body: node.Block(
-								node.For([]node.Node{node.Ident("k")}, node.Int(1), node.Block(node.Ident("k"))),
-							),
-						},
-					),
-				),
-			),
+						Else: &ast.Block{List: []ast.Node{
+							&ast.For{Targets: []ast.Node{&ast.Ident{Name: "k"}}, From: &ast.Int{Value: 1}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "k"}}}},
+						}},
+					},
+				}},
+			},
 			nil},
 
 		{`
@@ -921,39 +1201,59 @@ for n in 81 {
 	return l;
 };
 `,
-			node.Function(
-				node.Block(
-					node.For(
-						[]node.Node{node.Ident("n")},
-						node.Ident("l"),
-						node.Block(
-							node.If(
-								node.Branch{
-									Cond: node.Lt(node.Ident("n"), node.Int(87)),
-									Body: node.Block(
-										node.For([]node.Node{node.Ident("i")}, node.Int(81), node.Block(node.Ident("i"))),
-									),
-								},
-								node.Branch{
-									Cond: node.Eq(node.Ident("n"), node.Int(27)),
-									Body: node.Block(
-										node.For([]node.Node{node.Ident("j")}, node.Int(21), node.Block(node.Ident("j"))),
-									),
-								},
-								node.Branch{
-									Cond: node.Bool(true),
-									Body: node.Block(
-										node.For([]node.Node{node.Ident("k")}, node.Int(1), node.Block(node.Ident("k"))),
-									),
+			&ast.Function{
+				Params: []ast.Node{
+					&ast.Ident{Name: "l"},
+				},
+				Body: &ast.Block{List: []ast.Node{
+					&ast.For{
+						Targets: []ast.Node{&ast.Ident{Name: "n"}},
+						From:    &ast.Ident{Name: "l"},
+						Body: &ast.Block{List: []ast.Node{
+							&ast.If{
+								Branches: []ast.Branch{
+									{
+										Cond: &ast.Binary{Op: ast.Lt, X: &ast.Ident{Name: "n"}, Y: &ast.Int{Value: 87}},
+										Body: &ast.Block{List: []ast.Node{
+											&ast.For{Targets: []ast.Node{&ast.Ident{Name: "i"}}, From: &ast.Int{Value: 81}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "i"}}}},
+										}},
+									},
+									{
+										Cond: &ast.Binary{Op: ast.Eq, X: &ast.Ident{Name: "n"}, Y: &ast.Int{Value: 27}},
+										Body: &ast.Block{List: []ast.Node{
+											&ast.For{Targets: []ast.Node{&ast.Ident{Name: "j"}}, From: &ast.Int{Value: 21}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "j"}}}},
+										}},
+									},
 								},
-							),
-						),
-					),
-					node.Return(node.Ident("l")),
-				),
-				node.Ident("l"),
-			),
+								Else: &ast.Block{List: []ast.Node{
+									&ast.For{Targets: []ast.Node{&ast.Ident{Name: "k"}}, From: &ast.Int{Value: 1}, Body: &ast.Block{List: []ast.Node{&ast.Ident{Name: "k"}}}},
+								}},
+							},
+						}},
+					},
+					&ast.Return{Value: &ast.Ident{Name: "l"}},
+				}},
+			},
 			nil},
+
+		{`try {f()} catch e {e.message} finally {done()}`,
+			&ast.Try{
+				Body:    &ast.Block{List: []ast.Node{&ast.Call{Fn: &ast.Ident{Name: "f"}}}},
+				Name:    "e",
+				Catch:   &ast.Block{List: []ast.Node{&ast.Member{X: &ast.Ident{Name: "e"}, Name: "message"}}},
+				Finally: &ast.Block{List: []ast.Node{&ast.Call{Fn: &ast.Ident{Name: "done"}}}},
+			}, nil},
+		{"try {\n\tf()\n}\ncatch {\n}", &ast.Try{
+			Body:  &ast.Block{List: []ast.Node{&ast.Call{Fn: &ast.Ident{Name: "f"}}}},
+			Catch: &ast.Block{},
+		}, nil},
+		{"try {} finally {}", &ast.Try{Body: &ast.Block{}, Finally: &ast.Block{}}, nil},
+		{`throw error("нет файла", "io")`, &ast.Throw{Value: &ast.Call{Fn: &ast.Ident{Name: "error"}, Args: []ast.Node{&ast.Text{Value: "нет файла"}, &ast.Text{Value: "io"}}}}, nil},
+
+		{"try {}", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
+		{"try {} catch e", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
+		{"try f()", nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Ident, "f"))},
+		{"throw", nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
 	}
 
 	for _, test := range tests {
@@ -976,7 +1276,7 @@ for n in 81 {
 func Test_parse(t *testing.T) {
 	tests := []struct {
 		data          string
-		expectedValue node.Node
+		expectedValue ast.Node
 		expectedError error
 	}{
 		{`
@@ -988,17 +1288,104 @@ if n<87 {
 
 print(n);
 `,
-			node.Block(
-				node.Create(node.Ident("n"), node.Int(2187)),
-				node.If(
-					node.Branch{
-						Cond: node.Lt(node.Ident("n"), node.Int(87)),
-						Body: node.Block(node.Set(node.Ident("n"), node.Int(7))),
+			&ast.Block{List: []ast.Node{
+				&ast.Create{Target: &ast.Ident{Name: "n"}, Value: &ast.Int{Value: 2187}},
+				&ast.If{Branches: []ast.Branch{
+					{
+						Cond: &ast.Binary{Op: ast.Lt, X: &ast.Ident{Name: "n"}, Y: &ast.Int{Value: 87}},
+						Body: &ast.Block{List: []ast.Node{&ast.Set{Target: &ast.Ident{Name: "n"}, Value: &ast.Int{Value: 7}}}},
 					},
-				),
-				node.Call(node.Ident("print"), node.Ident("n")),
-			),
+				}},
+				&ast.Call{Fn: &ast.Ident{Name: "print"}, Args: []ast.Node{&ast.Ident{Name: "n"}}},
+			}},
 			nil},
+		{`
+n := 2187
+
+if n<87 {
+	n = 7
+}
+else {
+	print(
+		n,
+		{
+			"n": n
+		}
+	)
+}
+
+f := (x) -> {
+	return x
+}
+`,
+			&ast.Block{List: []ast.Node{
+				&ast.Create{Target: &ast.Ident{Name: "n"}, Value: &ast.Int{Value: 2187}},
+				&ast.If{
+					Branches: []ast.Branch{
+						{
+							Cond: &ast.Binary{Op: ast.Lt, X: &ast.Ident{Name: "n"}, Y: &ast.Int{Value: 87}},
+							Body: &ast.Block{List: []ast.Node{&ast.Set{Target: &ast.Ident{Name: "n"}, Value: &ast.Int{Value: 7}}}},
+						},
+					},
+					Else: &ast.Block{List: []ast.Node{
+						&ast.Call{
+							Fn: &ast.Ident{Name: "print"},
+							Args: []ast.Node{
+								&ast.Ident{Name: "n"},
+								&ast.Object{Pairs: []ast.Pair{{Key: &ast.Text{Value: "n"}, Value: &ast.Ident{Name: "n"}}}},
+							},
+						},
+					}},
+				},
+				&ast.Create{
+					Target: &ast.Ident{Name: "f"},
+					Value: &ast.Function{
+						Params: []ast.Node{
+							&ast.Ident{Name: "x"},
+						},
+						Body: &ast.Block{List: []ast.Node{&ast.Return{Value: &ast.Ident{Name: "x"}}}},
+					},
+				},
+			}},
+			nil},
+		{"n := 2187\n+ 1", nil, unexpectedToken(lexer.NewToken(lexer.Add))},
+
+		{`
+import "lib/math.dpl" as math
+export square := (x) -> { return math.pow(x, 2) }
+export [a, b] := [1, 2]
+`,
+			&ast.Block{List: []ast.Node{
+				&ast.Import{Path: "lib/math.dpl", Name: "math"},
+				&ast.Export{
+					Target: &ast.Ident{Name: "square"},
+					Value: &ast.Function{
+						Params: []ast.Node{
+							&ast.Ident{Name: "x"},
+						},
+						Body: &ast.Block{List: []ast.Node{
+							&ast.Return{Value: &ast.Call{
+								Fn: &ast.Member{X: &ast.Ident{Name: "math"}, Name: "pow"},
+								Args: []ast.Node{
+									&ast.Ident{Name: "x"},
+									&ast.Int{Value: 2},
+								},
+							}},
+						}},
+					},
+				},
+				&ast.Export{
+					Target: &ast.ArrayPattern{Elems: []ast.Node{&ast.Ident{Name: "a"}, &ast.Ident{Name: "b"}}},
+					Value:  &ast.Array{Elems: []ast.Node{&ast.Int{Value: 1}, &ast.Int{Value: 2}}},
+				},
+			}},
+			nil},
+		{`import lib as lib`, nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Ident, "lib"))},
+		{`import "lib.dpl"`, nil, unexpectedToken(lexer.NewToken(lexer.EOF))},
+		{`import "lib.dpl" as "lib"`, nil, unexpectedToken(lexer.NewTokenWithValue(lexer.Text, "lib"))},
+		{`export x = 1`, nil, unexpectedToken(lexer.NewToken(lexer.Set))},
+		{`if true { export x := 1 }`, nil, notTopLevel(lexer.NewToken(lexer.Export))},
+		{`f := () -> { import "lib.dpl" as lib }`, nil, notTopLevel(lexer.NewToken(lexer.Import))},
 	}
 
 	for _, test := range tests {
@@ -1017,3 +1404,144 @@ print(n);
 		}
 	}
 }
+
+func Test_Parse_Comments(t *testing.T) {
+	tokens, err := lexer.TokenizeWithComments(`
+// комментарий
+n := 2187; /* ещё один */
+`)
+	assert.NoError(t, err)
+
+	p := newParser(tokens)
+
+	v, err := p.parse()
+	assert.NoError(t, err)
+	assert.Equal(t, &ast.Block{List: []ast.Node{&ast.Create{Target: &ast.Ident{Name: "n"}, Value: &ast.Int{Value: 2187}}}}, v)
+}
+
+func Test_Parse_Span(t *testing.T) {
+	tests := []struct {
+		data          string
+		expectedValue pos.Span
+	}{
+		{"27", pos.Span{
+			Start: pos.Pos{Line: 1, Column: 1},
+			End:   pos.Pos{Line: 1, Column: 3, Offset: 2},
+		}},
+		{"a + b*c", pos.Span{
+			Start: pos.Pos{Line: 1, Column: 1},
+			End:   pos.Pos{Line: 1, Column: 8, Offset: 7},
+		}},
+		{"\n  f(1)[2]", pos.Span{
+			Start: pos.Pos{Line: 2, Column: 3, Offset: 3},
+			End:   pos.Pos{Line: 2, Column: 10, Offset: 10},
+		}},
+		{"if a {b} else {c}", pos.Span{
+			Start: pos.Pos{Line: 1, Column: 1},
+			End:   pos.Pos{Line: 1, Column: 18, Offset: 17},
+		}},
+	}
+
+	for _, test := range tests {
+		tokens, err := lexer.Tokenize(test.data)
+		assert.NoError(t, err)
+
+		p := newParser(tokens)
+		p.spans = true
+
+		v, err := p.construction()
+		assert.NoError(t, err)
+
+		assert.Equal(t, test.expectedValue, v.Span())
+	}
+}
+
+func Test_unexpectedToken_Pos(t *testing.T) {
+	tokens, err := lexer.Tokenize("[1,\n  2 3]")
+	assert.NoError(t, err)
+
+	_, err = Parse(tokens)
+
+	var e *pos.Error
+	if assert.ErrorAs(t, err, &e) {
+		assert.Equal(t, pos.Pos{Line: 2, Column: 5, Offset: 8}, e.Pos)
+	}
+}
+
+func Test_ParseRecover(t *testing.T) {
+	tests := []struct {
+		data           string
+		expectedValue  ast.Node
+		expectedErrors []pos.Pos
+	}{
+		{`
+a := 1;
+b := ;
+c := 3;
+`,
+			&ast.Block{List: []ast.Node{
+				&ast.Create{Target: &ast.Ident{Name: "a"}, Value: &ast.Int{Value: 1}},
+				&ast.Create{Target: &ast.Ident{Name: "c"}, Value: &ast.Int{Value: 3}},
+			}},
+			[]pos.Pos{{Line: 3, Column: 6, Offset: 14}}},
+
+		{`
+a := (1;
+if a { b := ) } else { c };
+for i in 10 { x := [1 2] };
+return a
+`,
+			&ast.Block{List: []ast.Node{
+				&ast.If{
+					Branches: []ast.Branch{
+						{Cond: &ast.Ident{Name: "a"}, Body: &ast.Block{}},
+					},
+					Else: &ast.Block{List: []ast.Node{&ast.Ident{Name: "c"}}},
+				},
+				&ast.For{
+					Targets: []ast.Node{&ast.Ident{Name: "i"}},
+					From:    &ast.Int{Value: 10},
+					Body:    &ast.Block{},
+				},
+				&ast.Return{Value: &ast.Ident{Name: "a"}},
+			}},
+			[]pos.Pos{
+				{Line: 2, Column: 8, Offset: 8},
+				{Line: 3, Column: 13, Offset: 22},
+				{Line: 4, Column: 23, Offset: 60},
+			}},
+
+		{`
+) a := 1 } b := 2;
+f := (x) -> {
+	x +
+`,
+			&ast.Block{},
+			[]pos.Pos{
+				{Line: 2, Column: 1, Offset: 1},
+				{Line: 2, Column: 10, Offset: 10},
+				{Line: 5, Column: 1, Offset: 39},
+			}},
+	}
+
+	for _, test := range tests {
+		tokens, err := lexer.Tokenize(test.data)
+		assert.NoError(t, err)
+
+		p := newParser(tokens)
+		p.recovering = true
+
+		v, err := p.parse()
+		assert.NoError(t, err)
+		assert.Equal(t, test.expectedValue, v)
+
+		positions := make([]pos.Pos, 0, len(p.errors))
+		for _, err := range p.errors {
+			var e *pos.Error
+			if assert.ErrorAs(t, err, &e) {
+				positions = append(positions, e.Pos)
+			}
+		}
+		assert.Equal(t, test.expectedErrors, positions)
+	}
+}
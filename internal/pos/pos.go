@@ -0,0 +1,139 @@
+package pos
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// позиция в исходном коде
+type Pos struct {
+	Line   int //номер строки, начиная с 1
+	Column int //номер символа в строке, начиная с 1
+	Offset int //смещение в байтах от начала текста
+}
+
+func (p Pos) IsValid() bool { return p.Line > 0 }
+
+func (p Pos) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// участок исходного кода [Start, End)
+type Span struct{ Start, End Pos }
+
+func (s Span) String() string { return s.Start.String() }
+
+// ошибка, привязанная к позиции в исходном коде
+type Error struct {
+	Pos Pos
+	Err error
+}
+
+// текст ошибки не содержит позиции, позиция добавляется при выводе (Report)
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// привязывает ошибку к позиции, если она еще не привязана
+func Wrap(err error, p Pos) error {
+	if err == nil || !p.IsValid() {
+		return err
+	}
+
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+
+	return &Error{Pos: p, Err: err}
+}
+
+// ошибка с именем файла и фрагментом исходного кода
+type ReportError struct {
+	Filename string
+	Source   string
+	Err      error
+}
+
+func (r *ReportError) Error() string {
+	var e *Error
+	if !errors.As(r.Err, &e) {
+		return fmt.Sprintf("%s: %s", r.Filename, r.Err.Error())
+	}
+
+	var str strings.Builder
+	fmt.Fprintf(&str, "%s:%s: %s", r.Filename, e.Pos, r.Err.Error())
+
+	//ошибка в коде без исходного текста (например, в синтаксическом дереве)
+	line, ok := Line(r.Source, e.Pos.Line)
+	if !ok || r.Source == "" {
+		return str.String()
+	}
+
+	str.WriteByte('\n')
+	str.WriteString(line)
+	str.WriteByte('\n')
+	str.WriteString(Caret(line, e.Pos.Column))
+
+	return str.String()
+}
+
+func (r *ReportError) Unwrap() error { return r.Err }
+
+// оформляет ошибку для вывода; ошибка, уже оформленная для другого файла
+// (например, из импортированного модуля), возвращается без изменений
+func Report(filename, source string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var r *ReportError
+	if errors.As(err, &r) {
+		return err
+	}
+	return &ReportError{Filename: filename, Source: source, Err: err}
+}
+
+// возвращает строку исходного кода по номеру (начиная с 1)
+func Line(source string, n int) (string, bool) {
+	if n < 1 {
+		return "", false
+	}
+
+	lines := strings.Split(source, "\n")
+	if n > len(lines) {
+		return "", false
+	}
+
+	return strings.TrimRight(lines[n-1], "\r"), true
+}
+
+// строит строку с указателем ^ под символом column (начиная с 1),
+// табуляции сохраняются, чтобы указатель совпадал с исходной строкой
+func Caret(line string, column int) string {
+	var str strings.Builder
+
+	i := 1
+	for _, r := range line {
+		if i >= column {
+			break
+		}
+		if r == '\t' {
+			str.WriteRune('\t')
+		} else {
+			str.WriteRune(' ')
+		}
+		i++
+	}
+
+	for ; i < column; i++ {
+		str.WriteRune(' ')
+	}
+
+	str.WriteRune('^')
+	return str.String()
+}
@@ -0,0 +1,71 @@
+package pos
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_Wrap(t *testing.T) {
+	err := errors.New("ошибка")
+
+	assert.Nil(t, Wrap(nil, Pos{Line: 1, Column: 1}))
+	assert.Equal(t, err, Wrap(err, Pos{}))
+
+	wrapped := Wrap(err, Pos{Line: 2, Column: 3})
+	assert.Equal(t, &Error{Pos: Pos{Line: 2, Column: 3}, Err: err}, wrapped)
+	assert.EqualError(t, wrapped, "ошибка")
+	assert.ErrorIs(t, wrapped, err)
+
+	//повторная привязка сохраняет первую (самую точную) позицию
+	assert.Equal(t, wrapped, Wrap(wrapped, Pos{Line: 1, Column: 1}))
+}
+
+func Test_Caret(t *testing.T) {
+	tests := []struct {
+		line          string
+		column        int
+		expectedValue string
+	}{
+		{"abc", 1, "^"},
+		{"abc", 3, "  ^"},
+		{"abc", 4, "   ^"},
+		{"\tabc", 3, "\t ^"},
+		{"ёжик", 2, " ^"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expectedValue, Caret(test.line, test.column))
+	}
+}
+
+func Test_Report(t *testing.T) {
+	tests := []struct {
+		source        string
+		err           error
+		expectedValue string
+	}{
+		{"a := 1;\nb := a / 0;",
+			Wrap(errors.New("деление на ноль"), Pos{Line: 2, Column: 6, Offset: 13}),
+			"main.dpl:2:6: деление на ноль\nb := a / 0;\n     ^"},
+		{"a := 1;\r\nb := c;",
+			Wrap(errors.New("нет c"), Pos{Line: 2, Column: 6}),
+			"main.dpl:2:6: нет c\nb := c;\n     ^"},
+		{"a := 1;",
+			Wrap(errors.New("ошибка"), Pos{Line: 5, Column: 1}),
+			"main.dpl:5:1: ошибка"},
+		{"a := 1;",
+			errors.New("ошибка"),
+			"main.dpl: ошибка"},
+		//ошибка из другого файла не оформляется повторно
+		{"a := 1;",
+			Wrap(Report("lib.dpl", "x := y", Wrap(errors.New("нет y"), Pos{Line: 1, Column: 6})), Pos{Line: 1, Column: 1}),
+			"lib.dpl:1:6: нет y\nx := y\n     ^"},
+	}
+
+	for _, test := range tests {
+		assert.EqualError(t, Report("main.dpl", test.source, test.err), test.expectedValue)
+	}
+
+	assert.Nil(t, Report("main.dpl", "", nil))
+}
@@ -4,7 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"iter"
+	"math"
 	"reflect"
+	"slices"
 	"strconv"
 	"strings"
 	"unicode"
@@ -28,6 +30,7 @@ type Value interface {
 	Iter2() (iter.Seq2[Value, Value], error)
 
 	Call(args ...Value) (Value, error)
+	Params() ([]string, error)
 
 	Len() (int64, error)
 
@@ -47,6 +50,16 @@ const (
 	ObjectType   = "object"
 	FunctionType = "function"
 	NullType     = "null"
+	SliceType    = "slice"
+	ErrorType    = "error"
+)
+
+// виды ошибок
+const (
+	//внутренние ошибки: деление на ноль, выход за границы и т.п.
+	RuntimeErrorKind = "runtime"
+	//ошибки, выброшенные throw без указания вида
+	ErrorKind = "error"
 )
 
 type valueT interface {
@@ -54,9 +67,13 @@ type valueT interface {
 		float64 |
 		string |
 		bool |
-		[]Value |
+		//массив хранится по указателю, чтобы изменение его размера
+		//(присваивание срезу) было видно во всех местах, где он используется
+		*[]Value |
 		map[string]Value |
-		func(args ...Value) (Value, error) |
+		function |
+		slice |
+		errorValue |
 		struct{} //nil
 }
 
@@ -64,20 +81,33 @@ type value[T valueT] struct{ value T }
 
 func (v value[T]) Value() any {
 	switch v := any(v.value).(type) {
-	case int64, float64, string, bool,
-		func(...Value) (Value, error):
+	case int64, float64, string, bool:
 		return v
 
+	case function:
+		return v.call
+
 	case struct{}:
 		return nil
 
-	case []Value:
-		sl := make([]any, 0, len(v))
-		for _, i := range v {
+	case *[]Value:
+		sl := make([]any, 0, len(*v))
+		for _, i := range *v {
 			sl = append(sl, i.Value())
 		}
 		return sl
 
+	case slice:
+		return v.Text()
+
+	case errorValue:
+		return map[string]any{
+			"message": v.message,
+			"kind":    v.kind,
+			"line":    v.line,
+			"column":  v.column,
+		}
+
 	case map[string]Value:
 		m := make(map[string]any, len(v))
 		for k, v := range v {
@@ -95,13 +125,13 @@ func noAppendSupport(typ string) error {
 }
 
 func (v value[T]) Append(values ...Value) (Value, error) {
-	arr, ok := any(v.value).([]Value)
+	arr, ok := any(v.value).(*[]Value)
 	if !ok {
 		return nil, noAppendSupport(v.Type())
 	}
 
-	newArr := make([]Value, len(arr))
-	copy(newArr, arr)
+	newArr := make([]Value, len(*arr))
+	copy(newArr, *arr)
 	newArr = append(newArr, values...)
 
 	return Array(newArr...), nil
@@ -167,9 +197,9 @@ func (v value[T]) Text() string {
 		return strconv.FormatBool(value)
 	case struct{}:
 		return "null"
-	case []Value:
-		strs := make([]string, 0, len(value))
-		for _, v := range value {
+	case *[]Value:
+		strs := make([]string, 0, len(*value))
+		for _, v := range *value {
 			strs = append(strs, v.Text())
 		}
 		return fmt.Sprintf("[%s]", strings.Join(strs, ","))
@@ -179,14 +209,21 @@ func (v value[T]) Text() string {
 			strs = append(strs, fmt.Sprintf("%s:%s", k, v.Text()))
 		}
 		return fmt.Sprintf("{%s}", strings.Join(strs, ","))
-	case func(...Value) (Value, error):
+	case function:
 		//в дальнейшем это может быть изменено на что-то другое
 		return FunctionType
+	case slice:
+		return value.Text()
+	case errorValue:
+		return value.message
 	default:
 		panic("неизвестный тип данных")
 	}
 }
 
+// истинность значения (используется в if, while, not, and, or, &&, ?:):
+// ложны 0, 0.0, пустая строка, false, null, пустой массив и пустой объект,
+// остальные значения истинны; функции к bool не приводятся
 func (v value[T]) Bool() (bool, error) {
 	switch value := any(v.value).(type) {
 	case int64:
@@ -199,10 +236,12 @@ func (v value[T]) Bool() (bool, error) {
 		return value, nil
 	case struct{}:
 		return false, nil
-	case []Value:
-		return len(value) != 0, nil
+	case *[]Value:
+		return len(*value) != 0, nil
 	case map[string]Value:
 		return len(value) != 0, nil
+	case errorValue:
+		return true, nil
 	default:
 		return false, conversionError(v.Type(), BoolType)
 	}
@@ -240,55 +279,222 @@ func noSetIndexSupport(typ string) error {
 	return fmt.Errorf("тип %s не поддерживает изменение элемента по индексу", typ)
 }
 
+func noSliceSupport(typ string) error {
+	return fmt.Errorf("тип %s не поддерживает срезы", typ)
+}
+
+func zeroSliceStep() error {
+	return errors.New("шаг среза не может быть равен нулю")
+}
+
+func sliceValueExpected(typ string) error {
+	return fmt.Errorf("срезу можно присвоить только массив, получено значение типа %s", typ)
+}
+
+func sliceSizeMismatch(expected, got int) error {
+	return fmt.Errorf("срезу из %d элементов нельзя присвоить %d элементов", expected, got)
+}
+
+// индекс-срез: start:end:step; отсутствующие части равны null
+type slice struct{ start, end, step Value }
+
+func (s slice) Text() string {
+	part := func(v Value) string {
+		if v.Type() == NullType {
+			return ""
+		}
+		return v.Text()
+	}
+	return fmt.Sprintf("%s:%s:%s", part(s.start), part(s.end), part(s.step))
+}
+
+// границы среза для последовательности длины length (как в Python):
+// отрицательные границы отсчитываются с конца, выходящие за пределы - обрезаются
+func (s slice) bounds(length int) (start, end, step int, err error) {
+	step = 1
+	if s.step.Type() != NullType {
+		st, err := s.step.Int()
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		if st == 0 {
+			return 0, 0, 0, zeroSliceStep()
+		}
+		step = int(st)
+	}
+
+	//допустимый диапазон границ
+	lower, upper := 0, length
+	if step < 0 {
+		lower, upper = -1, length-1
+	}
+
+	bound := func(b Value, def int) (int, error) {
+		if b.Type() == NullType {
+			return def, nil
+		}
+		i, err := b.Int()
+		if err != nil {
+			return 0, err
+		}
+		if i < 0 {
+			i += int64(length)
+		}
+		return int(max(min(i, int64(upper)), int64(lower))), nil
+	}
+
+	if step > 0 {
+		start, err = bound(s.start, lower)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		end, err = bound(s.end, upper)
+	} else {
+		start, err = bound(s.start, upper)
+		if err != nil {
+			return 0, 0, 0, err
+		}
+		end, err = bound(s.end, lower)
+	}
+	return start, end, step, err
+}
+
+// индексы элементов среза для последовательности длины length
+func (s slice) indices(length int) ([]int, error) {
+	start, end, step, err := s.bounds(length)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]int, 0)
+	for i := start; step > 0 && i < end || step < 0 && i > end; i += step {
+		res = append(res, i)
+	}
+	return res, nil
+}
+
+// индекс-срез для ElByIndex и SetElByIndex; nil - отсутствующая часть
+func Slice(start, end, step Value) Value {
+	if start == nil {
+		start = Null()
+	}
+	if end == nil {
+		end = Null()
+	}
+	if step == nil {
+		step = Null()
+	}
+	return value[slice]{slice{start: start, end: end, step: step}}
+}
+
+func sliceOf(index Value) (slice, bool) {
+	s, ok := index.(value[slice])
+	return s.value, ok
+}
+
+// индекс элемента последовательности длины length;
+// отрицательные индексы отсчитываются с конца: -1 - последний элемент
+func elementIndex(index Value, length int) (int, error) {
+	i, err := index.Int()
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 {
+		i += int64(length)
+	}
+	if i < 0 || i >= int64(length) {
+		return 0, indexOutOfRange()
+	}
+	return int(i), nil
+}
+
 func (v value[T]) ElByIndex(index Value) (Value, error) {
+	s, isSlice := sliceOf(index)
+
 	switch value := any(v.value).(type) {
 	case string:
-		i, err := index.Int()
+		runes := []rune(value)
+
+		if isSlice {
+			indices, err := s.indices(len(runes))
+			if err != nil {
+				return nil, err
+			}
+			res := make([]rune, 0, len(indices))
+			for _, i := range indices {
+				res = append(res, runes[i])
+			}
+			return Text(string(res)), nil
+		}
+
+		i, err := elementIndex(index, len(runes))
 		if err != nil {
 			return nil, err
 		}
-		runes := []rune(value)
-		if i < 0 || int(i) >= len(runes) {
-			return nil, indexOutOfRange()
+		return Text(string(runes[i])), nil
+
+	case *[]Value:
+		if isSlice {
+			indices, err := s.indices(len(*value))
+			if err != nil {
+				return nil, err
+			}
+			res := make([]Value, 0, len(indices))
+			for _, i := range indices {
+				res = append(res, (*value)[i])
+			}
+			return Array(res...), nil
 		}
-		return Text(string(runes[int(i)])), nil
 
-	case []Value:
-		i, err := index.Int()
+		i, err := elementIndex(index, len(*value))
 		if err != nil {
 			return nil, err
 		}
-		if i < 0 || int(i) >= len(value) {
-			return nil, indexOutOfRange()
-		}
-		return value[int(i)], nil
+		return (*value)[i], nil
 
 	case map[string]Value:
+		if isSlice {
+			return nil, noSliceSupport(v.Type())
+		}
+
 		v, ok := value[index.Text()]
 		if !ok {
 			return Null(), nil
 		}
 		return v, nil
 
+	case errorValue:
+		if isSlice {
+			return nil, noSliceSupport(v.Type())
+		}
+		return value.field(index.Text()), nil
+
 	default:
 		return nil, noIndexSupport(v.Type())
 	}
 }
 
 func (v value[T]) SetElByIndex(index, value Value) error {
+	s, isSlice := sliceOf(index)
+
 	switch target := any(v.value).(type) {
-	case []Value:
-		i, err := index.Int()
+	case *[]Value:
+		if isSlice {
+			return setSlice(target, s, value)
+		}
+
+		i, err := elementIndex(index, len(*target))
 		if err != nil {
 			return err
 		}
-		if i < 0 || int(i) >= len(target) {
-			return indexOutOfRange()
-		}
-		target[int(i)] = value
+		(*target)[i] = value
 		return nil
 
 	case map[string]Value:
+		if isSlice {
+			return noSliceSupport(v.Type())
+		}
+
 		target[index.Text()] = value
 		return nil
 
@@ -297,6 +503,45 @@ func (v value[T]) SetElByIndex(index, value Value) error {
 	}
 }
 
+// присваивание срезу: при шаге 1 элементы среза заменяются элементами
+// массива value (размер массива может измениться), при другом шаге
+// количество элементов должно совпадать
+func setSlice(target *[]Value, s slice, v Value) error {
+	src, ok := v.(value[*[]Value])
+	if !ok {
+		return sliceValueExpected(v.Type())
+	}
+	//копия на случай присваивания массива самому себе: a[1:] = a
+	values := append([]Value(nil), *src.value...)
+
+	start, end, step, err := s.bounds(len(*target))
+	if err != nil {
+		return err
+	}
+
+	if step == 1 {
+		end = max(end, start)
+		res := make([]Value, 0, len(*target)-(end-start)+len(values))
+		res = append(res, (*target)[:start]...)
+		res = append(res, values...)
+		res = append(res, (*target)[end:]...)
+		*target = res
+		return nil
+	}
+
+	indices, err := s.indices(len(*target))
+	if err != nil {
+		return err
+	}
+	if len(indices) != len(values) {
+		return sliceSizeMismatch(len(indices), len(values))
+	}
+	for i, index := range indices {
+		(*target)[index] = values[i]
+	}
+	return nil
+}
+
 //МЕТОДЫ ИТЕРАЦИИ:
 
 func noIterSupport(typ string) error {
@@ -325,7 +570,7 @@ func (v value[T]) Iter() (iter.Seq[Value], error) {
 		}
 		return Int(i).Iter()
 
-	case string, []Value:
+	case string, *[]Value:
 		l, err := v.Len()
 		if err != nil {
 			return nil, err
@@ -348,7 +593,7 @@ func (v value[T]) Iter() (iter.Seq[Value], error) {
 
 func (v value[T]) Iter2() (iter.Seq2[Value, Value], error) {
 	switch any(v.value).(type) {
-	case string, []Value, map[string]Value:
+	case string, *[]Value, map[string]Value:
 		return func(yield func(Value, Value) bool) {
 			iter, err := v.Iter()
 			if err != nil {
@@ -378,12 +623,52 @@ func noCallSupport(typ string) error {
 	return fmt.Errorf("тип %s не поддерживает вызовы", typ)
 }
 
+// функция; params - имена параметров, по которым передаются
+// именованные аргументы, у параметра-шаблона имя пустое
+type function struct {
+	call   func(args ...Value) (Value, error)
+	params []string
+}
+
 func (v value[T]) Call(args ...Value) (Value, error) {
-	fun, ok := any(v.value).(func(...Value) (Value, error))
+	fun, ok := any(v.value).(function)
 	if !ok {
 		return nil, noCallSupport(v.Type())
 	}
-	return fun(args...)
+	return fun.call(args...)
+}
+
+func (v value[T]) Params() ([]string, error) {
+	fun, ok := any(v.value).(function)
+	if !ok {
+		return nil, noCallSupport(v.Type())
+	}
+	return fun.params, nil
+}
+
+//МЕТОДЫ РАБОТЫ С ОШИБКАМИ:
+
+// ошибка: сообщение, вид (например, runtime или заданный в throw)
+// и позиция в исходном коде
+type errorValue struct {
+	message, kind string
+	line, column  int64
+}
+
+// поле ошибки: message, kind, line, column; остальные равны null
+func (e errorValue) field(name string) Value {
+	switch name {
+	case "message":
+		return Text(e.message)
+	case "kind":
+		return Text(e.kind)
+	case "line":
+		return Int(e.line)
+	case "column":
+		return Int(e.column)
+	default:
+		return Null()
+	}
 }
 
 //ПОЛУЧЕНИЕ ТИПА ЗНАЧЕНИЯ:
@@ -400,12 +685,16 @@ func (v value[T]) Type() string {
 		return BoolType
 	case struct{}:
 		return NullType
-	case []Value:
+	case *[]Value:
 		return ArrayType
 	case map[string]Value:
 		return ObjectType
-	case func(...Value) (Value, error):
+	case function:
 		return FunctionType
+	case slice:
+		return SliceType
+	case errorValue:
+		return ErrorType
 	default:
 		panic("неизвестный тип данных")
 	}
@@ -421,8 +710,8 @@ func (v value[T]) Len() (int64, error) {
 	switch target := any(v.value).(type) {
 	case string:
 		return int64(len([]rune(target))), nil
-	case []Value:
-		return int64(len(target)), nil
+	case *[]Value:
+		return int64(len(*target)), nil
 	case map[string]Value:
 		return int64(len(target)), nil
 	default:
@@ -441,7 +730,7 @@ func Array(v ...Value) Value {
 	if v == nil {
 		v = make([]Value, 0)
 	}
-	return value[[]Value]{v}
+	return value[*[]Value]{&v}
 }
 
 type KV struct{ Key, Value Value }
@@ -457,11 +746,27 @@ func Object(v ...KV) Value {
 }
 
 func Function(v func(args ...Value) (Value, error)) Value {
-	return value[func(...Value) (Value, error)]{v}
+	return value[function]{function{call: v}}
+}
+
+// функция с именованными параметрами; аргумент, не переданный при вызове
+// (пропущенный между именованными), равен nil
+func FunctionWithParams(params []string, v func(args ...Value) (Value, error)) Value {
+	return value[function]{function{call: v, params: params}}
 }
 
 func Null() Value { return value[struct{}]{} }
 
+// ошибка; line и column равны 0, если позиция неизвестна
+func Error(message, kind string, line, column int64) Value {
+	return value[errorValue]{errorValue{
+		message: message,
+		kind:    kind,
+		line:    line,
+		column:  column,
+	}}
+}
+
 //ВСПОМОГАТЕЛЬНЫЕ ФУНКЦИИ ДЛЯ РАБОТЫ СО СТРОКАМИ:
 
 func skip(sl []rune, index int, fun func(rune) bool) int {
@@ -548,6 +853,9 @@ func Of(v any) (Value, error) {
 	if v == nil {
 		return Null(), nil
 	}
+	if v, ok := v.(Value); ok {
+		return v, nil
+	}
 
 	switch val := reflect.ValueOf(v); val.Kind() {
 	case
@@ -558,7 +866,20 @@ func Of(v any) (Value, error) {
 		reflect.Int64:
 		return Int(val.Int()), nil
 
-	case reflect.Float64:
+	case
+		reflect.Uint,
+		reflect.Uint8,
+		reflect.Uint16,
+		reflect.Uint32,
+		reflect.Uint64,
+		reflect.Uintptr:
+		n := val.Uint()
+		if n > math.MaxInt64 {
+			return nil, overflow(n, reflect.TypeFor[int64]())
+		}
+		return Int(int64(n)), nil
+
+	case reflect.Float32, reflect.Float64:
 		return Real(val.Float()), nil
 
 	case reflect.Bool:
@@ -597,9 +918,220 @@ func Of(v any) (Value, error) {
 			values = append(values, KV{Key: k, Value: v})
 		}
 
+		//поля добавляются в порядке возрастания ключей, как в dpl.Object
+		slices.SortStableFunc(values, func(a, b KV) int {
+			return strings.Compare(a.Key.Text(), b.Key.Text())
+		})
 		return Object(values...), nil
 
 	default:
 		return nil, conversionError(val.Kind().String(), "Value")
 	}
 }
+
+var (
+	valueType = reflect.TypeFor[Value]()
+	errorType = reflect.TypeFor[error]()
+)
+
+func unsupportedType(t reflect.Type) error {
+	return fmt.Errorf("тип Go %s не поддерживается", t)
+}
+
+func overflow[T int64 | uint64](n T, t reflect.Type) error {
+	return fmt.Errorf("число %d не помещается в %s", n, t)
+}
+
+// преобразует значение в значение Go типа t; поддерживаются Value,
+// any (значение Value()), целые и вещественные числа, string, bool,
+// срезы из массивов и map с ключами-строками из объектов
+func To(v Value, t reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		v = Null()
+	}
+
+	if t == valueType {
+		return reflect.ValueOf(&v).Elem(), nil
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		if t.NumMethod() != 0 {
+			return reflect.Value{}, unsupportedType(t)
+		}
+		x := v.Value()
+		if x == nil {
+			return reflect.Zero(t), nil
+		}
+		return reflect.ValueOf(x), nil
+
+	case
+		reflect.Int,
+		reflect.Int8,
+		reflect.Int16,
+		reflect.Int32,
+		reflect.Int64:
+		n, err := v.Int()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		res := reflect.New(t).Elem()
+		if res.OverflowInt(n) {
+			return reflect.Value{}, overflow(n, t)
+		}
+		res.SetInt(n)
+		return res, nil
+
+	case
+		reflect.Uint,
+		reflect.Uint8,
+		reflect.Uint16,
+		reflect.Uint32,
+		reflect.Uint64,
+		reflect.Uintptr:
+		n, err := v.Int()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		res := reflect.New(t).Elem()
+		if n < 0 || res.OverflowUint(uint64(n)) {
+			return reflect.Value{}, overflow(n, t)
+		}
+		res.SetUint(uint64(n))
+		return res, nil
+
+	case reflect.Float32, reflect.Float64:
+		n, err := v.Real()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(n).Convert(t), nil
+
+	case reflect.String:
+		return reflect.ValueOf(v.Text()).Convert(t), nil
+
+	case reflect.Bool:
+		b, err := v.Bool()
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		return reflect.ValueOf(b).Convert(t), nil
+
+	case reflect.Slice:
+		if v.Type() != ArrayType {
+			return reflect.Value{}, conversionError(v.Type(), t.String())
+		}
+
+		elems, _ := v.Iter2()
+		res := reflect.MakeSlice(t, 0, 0)
+		for _, el := range elems {
+			x, err := To(el, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			res = reflect.Append(res, x)
+		}
+		return res, nil
+
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return reflect.Value{}, unsupportedType(t)
+		}
+		if v.Type() != ObjectType {
+			return reflect.Value{}, conversionError(v.Type(), t.String())
+		}
+
+		fields, _ := v.Iter2()
+		res := reflect.MakeMap(t)
+		for k, el := range fields {
+			x, err := To(el, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			res.SetMapIndex(reflect.ValueOf(k.Text()).Convert(t.Key()), x)
+		}
+		return res, nil
+
+	default:
+		return reflect.Value{}, unsupportedType(t)
+	}
+}
+
+func notFunction(t reflect.Type) error {
+	return fmt.Errorf("%s не является функцией", t)
+}
+
+func wrongResults(t reflect.Type) error {
+	return fmt.Errorf("функция %s должна возвращать значение, ошибку или значение и ошибку", t)
+}
+
+func wrongArgCount(expected, got int) error {
+	return fmt.Errorf("ожидалось аргументов: %d, получено: %d", expected, got)
+}
+
+func wrongArg(i int, err error) error {
+	return fmt.Errorf("аргумент %d: %w", i, err)
+}
+
+// функция из функции Go: аргументы преобразуются функцией To,
+// результат - функцией Of; функция может возвращать ничего, значение,
+// ошибку или значение и ошибку
+func FunctionOf(fn any) (Value, error) {
+	if fn, ok := fn.(func(args ...Value) (Value, error)); ok {
+		return Function(fn), nil
+	}
+
+	val := reflect.ValueOf(fn)
+	if val.Kind() != reflect.Func {
+		return nil, notFunction(reflect.TypeOf(fn))
+	}
+	t := val.Type()
+
+	switch {
+	case t.NumOut() <= 1:
+	case t.NumOut() == 2 && t.Out(1) == errorType && t.Out(0) != errorType:
+	default:
+		return nil, wrongResults(t)
+	}
+
+	fixed := t.NumIn()
+	if t.IsVariadic() {
+		fixed--
+	}
+
+	return Function(func(args ...Value) (Value, error) {
+		if len(args) < fixed || !t.IsVariadic() && len(args) > fixed {
+			return nil, wrongArgCount(fixed, len(args))
+		}
+
+		in := make([]reflect.Value, 0, len(args))
+		for i, arg := range args {
+			var pt reflect.Type
+			if i < fixed {
+				pt = t.In(i)
+			} else {
+				pt = t.In(fixed).Elem()
+			}
+
+			x, err := To(arg, pt)
+			if err != nil {
+				return nil, wrongArg(i+1, err)
+			}
+			in = append(in, x)
+		}
+
+		out := val.Call(in)
+
+		if len(out) != 0 && out[len(out)-1].Type() == errorType {
+			if err, _ := out[len(out)-1].Interface().(error); err != nil {
+				return nil, err
+			}
+			out = out[:len(out)-1]
+		}
+
+		if len(out) == 0 {
+			return Null(), nil
+		}
+		return Of(out[0].Interface())
+	}), nil
+}
@@ -1,8 +1,11 @@
 package value
 
 import (
+	"errors"
 	"github.com/stretchr/testify/assert"
+	"math"
 	"reflect"
+	"strings"
 	"testing"
 	"unicode"
 )
@@ -23,6 +26,7 @@ func Test_Type(t *testing.T) {
 		{Array(Int(81)), ArrayType},
 		{Object(), ObjectType},
 		{Object(KV{Text("text"), Int(81)}), ObjectType},
+		{Error("сообщение", ErrorKind, 0, 0), ErrorType},
 		{Function(nil), FunctionType},
 	}
 
@@ -143,6 +147,7 @@ func Test_Text(t *testing.T) {
 		{Bool(true), "true"},
 
 		{Null(), "null"},
+		{Error("деление на ноль", RuntimeErrorKind, 1, 5), "деление на ноль"},
 
 		{Array(), "[]"},
 		{Array(Int(81)), "[81]"},
@@ -278,14 +283,17 @@ func Test_ElByIndex(t *testing.T) {
 		expectedValue Value
 		expectedError error
 	}{
-		{Text("text"), Int(-1), nil, indexOutOfRange()},
+		{Text("text"), Int(-1), Text("t"), nil},
+		{Text("text"), Int(-5), nil, indexOutOfRange()},
 		{Text("text"), Int(0), Text("t"), nil},
 		{Text("text"), Int(1), Text("e"), nil},
 		{Text("text"), Int(2), Text("x"), nil},
 		{Text("text"), Int(3), Text("t"), nil},
 		{Text("text"), Int(4), nil, indexOutOfRange()},
 
-		{Text("текст"), Int(-1), nil, indexOutOfRange()},
+		{Text("текст"), Int(-1), Text("т"), nil},
+		{Text("текст"), Int(-4), Text("е"), nil},
+		{Text("текст"), Int(-6), nil, indexOutOfRange()},
 		{Text("текст"), Int(0), Text("т"), nil},
 		{Text("текст"), Int(1), Text("е"), nil},
 		{Text("текст"), Int(2), Text("к"), nil},
@@ -293,7 +301,15 @@ func Test_ElByIndex(t *testing.T) {
 		{Text("текст"), Int(4), Text("т"), nil},
 		{Text("текст"), Int(5), nil, indexOutOfRange()},
 
-		{Array(Int(81), Text("текст"), Bool(true)), Int(-1), nil, indexOutOfRange()},
+		{Error("сообщение", "io", 3, 7), Text("message"), Text("сообщение"), nil},
+		{Error("сообщение", "io", 3, 7), Text("kind"), Text("io"), nil},
+		{Error("сообщение", "io", 3, 7), Text("line"), Int(3), nil},
+		{Error("сообщение", "io", 3, 7), Text("column"), Int(7), nil},
+		{Error("сообщение", "io", 3, 7), Text("other"), Null(), nil},
+
+		{Array(Int(81), Text("текст"), Bool(true)), Int(-1), Bool(true), nil},
+		{Array(Int(81), Text("текст"), Bool(true)), Int(-3), Int(81), nil},
+		{Array(Int(81), Text("текст"), Bool(true)), Int(-4), nil, indexOutOfRange()},
 		{Array(Int(81), Text("текст"), Bool(true)), Int(0), Int(81), nil},
 		{Array(Int(81), Text("текст"), Bool(true)), Int(1), Text("текст"), nil},
 		{Array(Int(81), Text("текст"), Bool(true)), Int(2), Bool(true), nil},
@@ -314,6 +330,23 @@ func Test_ElByIndex(t *testing.T) {
 		{Bool(true), Int(0), nil, noIndexSupport(BoolType)},
 		{Null(), Int(0), nil, noIndexSupport(NullType)},
 		{Function(nil), Int(0), nil, noIndexSupport(FunctionType)},
+
+		{Text("текст"), Slice(Int(1), Int(3), nil), Text("ек"), nil},
+		{Text("текст"), Slice(nil, Int(-1), nil), Text("текс"), nil},
+		{Text("текст"), Slice(nil, nil, Int(-1)), Text("тскет"), nil},
+		{Text("текст"), Slice(Int(10), nil, nil), Text(""), nil},
+
+		{Array(Int(0), Int(1), Int(2), Int(3), Int(4)), Slice(Int(1), Int(3), nil), Array(Int(1), Int(2)), nil},
+		{Array(Int(0), Int(1), Int(2), Int(3), Int(4)), Slice(Int(-2), nil, nil), Array(Int(3), Int(4)), nil},
+		{Array(Int(0), Int(1), Int(2), Int(3), Int(4)), Slice(nil, nil, Int(2)), Array(Int(0), Int(2), Int(4)), nil},
+		{Array(Int(0), Int(1), Int(2), Int(3), Int(4)), Slice(Int(3), Int(0), Int(-1)), Array(Int(3), Int(2), Int(1)), nil},
+		{Array(Int(0), Int(1), Int(2), Int(3), Int(4)), Slice(Int(-100), Int(100), nil),
+			Array(Int(0), Int(1), Int(2), Int(3), Int(4)), nil},
+		{Array(Int(0), Int(1)), Slice(Int(1), Int(0), nil), Array(), nil},
+		{Array(Int(0), Int(1)), Slice(nil, nil, Int(0)), nil, zeroSliceStep()},
+
+		{Object(), Slice(nil, nil, nil), nil, noSliceSupport(ObjectType)},
+		{Int(81), Slice(nil, nil, nil), nil, noIndexSupport(IntType)},
 	}
 
 	for _, test := range tests {
@@ -335,7 +368,8 @@ func Test_SetElByIndex(t *testing.T) {
 		newElement Value
 		expected error
 	}{
-		{Array(Text("text"), Int(81)), Int(-1), nil, indexOutOfRange()},
+		{Array(Text("text"), Int(81)), Int(-1), Real(8.1), nil},
+		{Array(Text("text"), Int(81)), Int(-3), nil, indexOutOfRange()},
 		{Array(Text("text"), Int(81)), Int(0), Real(8.1), nil},
 		{Array(Text("text"), Int(81)), Int(2), nil, indexOutOfRange()},
 
@@ -367,6 +401,74 @@ func Test_SetElByIndex(t *testing.T) {
 	}
 }
 
+func Test_SetElByIndex_Slice(t *testing.T) {
+	tests := []struct {
+		value,
+		index,
+		newElements,
+		expectedValue Value
+		expectedError error
+	}{
+		{
+			Array(Int(0), Int(1), Int(2), Int(3)), Slice(Int(1), Int(3), nil),
+			Array(Text("x"), Text("y"), Text("z")),
+			Array(Int(0), Text("x"), Text("y"), Text("z"), Int(3)), nil,
+		},
+		{
+			Array(Int(0), Int(1), Int(2), Int(3)), Slice(Int(1), nil, nil),
+			Array(),
+			Array(Int(0)), nil,
+		},
+		{
+			Array(Int(0), Int(1)), Slice(Int(1), Int(1), nil),
+			Array(Int(9)),
+			Array(Int(0), Int(9), Int(1)), nil,
+		},
+		{
+			Array(Int(0), Int(1), Int(2), Int(3)), Slice(nil, nil, Int(2)),
+			Array(Text("a"), Text("b")),
+			Array(Text("a"), Int(1), Text("b"), Int(3)), nil,
+		},
+		{
+			Array(Int(0), Int(1), Int(2), Int(3)), Slice(nil, nil, Int(-1)),
+			Array(Int(5), Int(6), Int(7), Int(8)),
+			Array(Int(8), Int(7), Int(6), Int(5)), nil,
+		},
+
+		{
+			Array(Int(0), Int(1), Int(2), Int(3)), Slice(nil, nil, Int(2)),
+			Array(Text("a")),
+			nil, sliceSizeMismatch(2, 1),
+		},
+		{
+			Array(Int(0), Int(1)), Slice(nil, nil, nil),
+			Int(1),
+			nil, sliceValueExpected(IntType),
+		},
+		{
+			Object(), Slice(nil, nil, nil),
+			Array(),
+			nil, noSliceSupport(ObjectType),
+		},
+		{
+			Text("текст"), Slice(nil, nil, nil),
+			Array(),
+			nil, noSetIndexSupport(TextType),
+		},
+	}
+
+	for _, test := range tests {
+		err := test.value.SetElByIndex(test.index, test.newElements)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, test.value)
+		}
+	}
+}
+
 func Test_Iter(t *testing.T) {
 	tests := []struct {
 		value          Value
@@ -493,6 +595,34 @@ func Test_Call(t *testing.T) {
 	}
 }
 
+func Test_Params(t *testing.T) {
+	fun := func(...Value) (Value, error) { return Null(), nil }
+
+	tests := []struct {
+		value         Value
+		expectedValue []string
+		expectedError error
+	}{
+		{Function(fun), nil, nil},
+		{FunctionWithParams([]string{"x", "", "y"}, fun), []string{"x", "", "y"}, nil},
+
+		{Int(27), nil, noCallSupport(IntType)},
+		{Text("text"), nil, noCallSupport(TextType)},
+		{Null(), nil, noCallSupport(NullType)},
+	}
+
+	for _, test := range tests {
+		params, err := test.value.Params()
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, params)
+		}
+	}
+}
+
 func Test_skip(t *testing.T) {
 	tests := []struct {
 		data     string
@@ -871,6 +1001,10 @@ func Test_Of(t *testing.T) {
 		{int32(2147483647), Int(2147483647), nil},
 		{int64(9223372036854775807), Int(9223372036854775807), nil},
 
+		{uint8(255), Int(255), nil},
+		{uint32(4294967295), Int(4294967295), nil},
+
+		{float32(0.5), Real(0.5), nil},
 		{float64(32.767), Real(32.767), nil},
 
 		{false, Bool(false), nil},
@@ -879,6 +1013,7 @@ func Test_Of(t *testing.T) {
 		{"test", Text("test"), nil},
 
 		{nil, Null(), nil},
+		{Text("test"), Text("test"), nil},
 
 		{[]any(nil), Array(), nil},
 		{[]any{}, Array(), nil},
@@ -910,6 +1045,10 @@ func Test_Of(t *testing.T) {
 		},
 
 		{func() {}, nil, conversionError(reflect.Func.String(), "Value")},
+		{uint(5), Int(5), nil},
+		{uintptr(5), Int(5), nil},
+		{uint64(math.MaxInt64), Int(math.MaxInt64), nil},
+		{uint64(math.MaxUint64), nil, errors.New("число 18446744073709551615 не помещается в int64")},
 	}
 
 	for _, test := range tests {
@@ -923,3 +1062,118 @@ func Test_Of(t *testing.T) {
 		}
 	}
 }
+
+func Test_To(t *testing.T) {
+	tests := []struct {
+		value         Value
+		typ           reflect.Type
+		expectedValue any
+		expectedError error
+	}{
+		{Int(81), reflect.TypeFor[int](), 81, nil},
+		{Text("81"), reflect.TypeFor[int8](), int8(81), nil},
+		{Int(300), reflect.TypeFor[int8](), nil, errors.New("число 300 не помещается в int8")},
+		{Int(2), reflect.TypeFor[float64](), 2.0, nil},
+		{Real(2.5), reflect.TypeFor[float32](), float32(2.5), nil},
+		{Int(2), reflect.TypeFor[string](), "2", nil},
+		{Int(0), reflect.TypeFor[bool](), false, nil},
+		{Array(), reflect.TypeFor[int](), nil, conversionError(ArrayType, IntType)},
+
+		{Null(), reflect.TypeFor[any](), nil, nil},
+		{Array(Int(1), Text("a")), reflect.TypeFor[any](), []any{int64(1), "a"}, nil},
+		{Int(1), reflect.TypeFor[Value](), Int(1), nil},
+		{nil, reflect.TypeFor[Value](), Null(), nil},
+
+		{Array(Int(1), Text("2")), reflect.TypeFor[[]int](), []int{1, 2}, nil},
+		{Array(), reflect.TypeFor[[]Value](), []Value{}, nil},
+		{Int(1), reflect.TypeFor[[]int](), nil, conversionError(IntType, "[]int")},
+		{Array(Array()), reflect.TypeFor[[]int](), nil, conversionError(ArrayType, IntType)},
+		{
+			Object(KV{Text("a"), Int(1)}),
+			reflect.TypeFor[map[string]float64](),
+			map[string]float64{"a": 1},
+			nil,
+		},
+		{Array(), reflect.TypeFor[map[string]int](), nil, conversionError(ArrayType, "map[string]int")},
+		{Object(), reflect.TypeFor[map[int]int](), nil, errors.New("тип Go map[int]int не поддерживается")},
+
+		{Int(1), reflect.TypeFor[uint](), uint(1), nil},
+		{Text("255"), reflect.TypeFor[uint8](), uint8(255), nil},
+		{Int(256), reflect.TypeFor[uint8](), nil, errors.New("число 256 не помещается в uint8")},
+		{Int(-1), reflect.TypeFor[uint64](), nil, errors.New("число -1 не помещается в uint64")},
+		{Int(1), reflect.TypeFor[error](), nil, errors.New("тип Go error не поддерживается")},
+	}
+
+	for _, test := range tests {
+		v, err := To(test.value, test.typ)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else if assert.NoError(t, err) {
+			if test.expectedValue == nil {
+				assert.True(t, v.IsZero())
+			} else {
+				assert.Equal(t, test.expectedValue, v.Interface())
+			}
+		}
+	}
+}
+
+func Test_FunctionOf(t *testing.T) {
+	failed := errors.New("ошибка")
+
+	tests := []struct {
+		fn            any
+		args          []Value
+		expectedValue Value
+		expectedError error
+	}{
+		{func(a, b int) int { return a + b }, []Value{Int(1), Text("2")}, Int(3), nil},
+		{func(a, b int) int { return a + b }, []Value{Int(1)}, nil,
+			errors.New("ожидалось аргументов: 2, получено: 1")},
+		{func(a int) int { return a }, []Value{Array()}, nil,
+			errors.New("аргумент 1: невозможно преобразовать array в int")},
+
+		{func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+			[]Value{Text("-"), Text("a"), Int(1)}, Text("a-1"), nil},
+		{func(sep string, parts ...string) string { return strings.Join(parts, sep) },
+			nil, nil, errors.New("ожидалось аргументов: 1, получено: 0")},
+
+		{func() {}, nil, Null(), nil},
+		{func() error { return nil }, nil, Null(), nil},
+		{func() error { return failed }, nil, nil, failed},
+		{func() (float64, error) { return 1.5, nil }, nil, Real(1.5), nil},
+		{func() ([]string, error) { return nil, failed }, nil, nil, failed},
+		{func(v Value) map[string]any { return map[string]any{"v": v} }, []Value{Int(1)},
+			Object(KV{Text("v"), Int(1)}), nil},
+
+		{func(args ...Value) (Value, error) { return Int(int64(len(args))), nil },
+			[]Value{Null(), Null()}, Int(2), nil},
+	}
+
+	for _, test := range tests {
+		fn, err := FunctionOf(test.fn)
+		if !assert.NoError(t, err) {
+			continue
+		}
+
+		v, err := fn.Call(test.args...)
+
+		if test.expectedError != nil {
+			assert.EqualError(t, err, test.expectedError.Error())
+		} else {
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedValue, v)
+		}
+	}
+
+	for _, fn := range []any{
+		1,
+		func() (int, int) { return 0, 0 },
+		func() (error, error) { return nil, nil },
+		func() (int, int, error) { return 0, 0, nil },
+	} {
+		_, err := FunctionOf(fn)
+		assert.Error(t, err)
+	}
+}